@@ -25,6 +25,14 @@
 	AuthorizationHeaderKey = "Authorization"
 	// IdentityHeaderKey is the identity header key
 	IdentityHeaderKey = "Identity"
+	// AudienceHeaderKey is the header key of the audience a validated token must be intended for
+	AudienceHeaderKey = "Audience"
+	// ScopeHeaderKey is the header key of the space-delimited scopes a validated token must carry
+	ScopeHeaderKey = "Scope"
+	// DPoPHeaderKey is the header key of the DPoP proof of a request, see RFC 9449
+	DPoPHeaderKey = "DPoP"
+	// DPoPNonceHeaderKey is the header key of the nonce clients put in their next DPoP proof
+	DPoPNonceHeaderKey = "DPoP-Nonce"
 )
 
 // InsertAccessToken inserts the access token correctly formatted into the request header
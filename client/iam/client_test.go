@@ -27,6 +27,7 @@
 	"github.com/stretchr/testify/assert"
 
 	"github.com/ingka-group/iam-proxy/client/health"
+	"github.com/ingka-group/iam-proxy/client/iamerrors"
 	"github.com/ingka-group/iam-proxy/client/paths"
 )
 
@@ -110,6 +111,154 @@ type test struct {
 	}
 }
 
+func TestClient_Token(t *testing.T) {
+	t.Parallel()
+
+	type test struct {
+		response   string
+		statusCode int
+		token      string
+		err        error
+	}
+
+	tests := map[string]test{
+		"response": {
+			response:   `{"access_token":"token","token_type":"Bearer","expires_in":3600}`,
+			statusCode: http.StatusOK,
+			token:      "token",
+		},
+		"legacy_response": {
+			response:   `{"accessToken":"token","tokenType":"Bearer","expiresIn":3600}`,
+			statusCode: http.StatusOK,
+			token:      "token",
+		},
+		"empty_response": {
+			response:   `{}`,
+			statusCode: http.StatusOK,
+			err:        iamerrors.ErrBadResponse,
+		},
+		"invalid_client": {
+			response:   `{"error":"invalid_client"}`,
+			statusCode: http.StatusUnauthorized,
+			err:        iamerrors.ErrUnauthorized,
+		},
+	}
+
+	assertForm := func(t *testing.T, request *http.Request) {
+		assert.Equal(t, "application/x-www-form-urlencoded", request.Header.Get("Content-Type"))
+		assert.NoError(t, request.ParseForm())
+		assert.Equal(t, "client_credentials", request.PostForm.Get(GrantTypeKey))
+		assert.Equal(t, "client", request.PostForm.Get(ClientIDKey))
+		assert.Equal(t, "s&cret=", request.PostForm.Get(ClientSecretKey))
+	}
+
+	for name, tt := range tests {
+		// pin loop variable
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			url, port, clb := mockServerWithResponse(t, tt.response, tt.statusCode, assertURL(paths.FullPath(paths.OAuthToken)), assertForm)
+			defer clb()
+
+			client := New(fmt.Sprintf("http://%s:%d", url, port), http.DefaultClient)
+
+			token, err := client.Token("client", "s&cret=")
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.token, token)
+			}
+		})
+	}
+}
+
+func TestClient_TokenWithAssertion(t *testing.T) {
+	t.Parallel()
+
+	assertForm := func(t *testing.T, request *http.Request) {
+		assert.NoError(t, request.ParseForm())
+		assert.Equal(t, "client_credentials", request.PostForm.Get(GrantTypeKey))
+		assert.Equal(t, ClientAssertionTypeJWTBearer, request.PostForm.Get(ClientAssertionTypeKey))
+		assert.Equal(t, "assertion", request.PostForm.Get(ClientAssertionKey))
+		assert.False(t, request.PostForm.Has(ClientSecretKey))
+	}
+	url, port, clb := mockServerWithResponse(t, `{"access_token":"token","token_type":"Bearer","expires_in":3600}`, http.StatusOK,
+		assertURL(paths.FullPath(paths.OAuthToken)), assertForm)
+	defer clb()
+
+	client := New(fmt.Sprintf("http://%s:%d", url, port), http.DefaultClient)
+	token, err := client.TokenWithAssertion("assertion")
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token)
+}
+
+func TestClient_TokenWithCertificate(t *testing.T) {
+	t.Parallel()
+
+	assertForm := func(t *testing.T, request *http.Request) {
+		assert.NoError(t, request.ParseForm())
+		assert.Equal(t, "client_credentials", request.PostForm.Get(GrantTypeKey))
+		assert.Equal(t, "client", request.PostForm.Get(ClientIDKey))
+		assert.False(t, request.PostForm.Has(ClientSecretKey))
+	}
+	url, port, clb := mockServerWithResponse(t, `{"access_token":"token","token_type":"Bearer","expires_in":3600}`, http.StatusOK,
+		assertURL(paths.FullPath(paths.OAuthToken)), assertForm)
+	defer clb()
+
+	client := New(fmt.Sprintf("http://%s:%d", url, port), http.DefaultClient)
+	token, err := client.TokenWithCertificate("client")
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token)
+}
+
+func TestClient_Metadata(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		response   string
+		statusCode int
+		want       *Metadata
+		err        bool
+	}{
+		"metadata": {
+			response:   `{"issuer":"https://iam.example.com/iam/v1","token_endpoint":"https://iam.example.com/iam/v1/oauth2/token","grant_types_supported":["client_credentials"]}`,
+			statusCode: http.StatusOK,
+			want: &Metadata{
+				Issuer:        "https://iam.example.com/iam/v1",
+				TokenEndpoint: "https://iam.example.com/iam/v1/oauth2/token",
+				GrantTypes:    []string{"client_credentials"},
+			},
+		},
+		"not_found": {
+			statusCode: http.StatusNotFound,
+			err:        true,
+		},
+		"bad_response": {
+			response:   `{"issuer":`,
+			statusCode: http.StatusOK,
+			err:        true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			url, port, clb := mockServerWithResponse(t, tt.response, tt.statusCode, assertURL(paths.FullPath(paths.AuthorizationServerMetadata)))
+			defer clb()
+
+			client := New(fmt.Sprintf("http://%s:%d", url, port), http.DefaultClient)
+			metadata, err := client.Metadata()
+			if tt.err {
+				assert.Error(t, err)
+				assert.Nil(t, metadata)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, metadata)
+		})
+	}
+}
+
 func mockServerWithResponse(t *testing.T, response string, code int, requestAssertions ...func(t *testing.T, request *http.Request)) (string, int, func()) {
 	ts := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		for _, assertion := range requestAssertions {
@@ -15,11 +15,11 @@
 package iam
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 
 	jwt "github.com/ingka-group/iam-proxy/client/http"
 	"github.com/ingka-group/iam-proxy/client/iamerrors"
@@ -28,8 +28,32 @@
 
 // Token calls the iam service and returns the access token based on the provided clientID and clientSecret.
 func (c *Client) Token(clientID, clientSecret string) (string, error) {
+	return c.token(buildOauthRequestBody(clientID, clientSecret))
+}
+
+// TokenWithAssertion calls the iam service and returns the access token, the client authenticating with a JWT
+// signed by its private key (private_key_jwt), see RFC 7523. The assertion must have a new jti every time.
+func (c *Client) TokenWithAssertion(assertion string) (string, error) {
+	return c.token(url.Values{
+		GrantTypeKey:           {"client_credentials"},
+		ClientAssertionTypeKey: {ClientAssertionTypeJWTBearer},
+		ClientAssertionKey:     {assertion},
+	})
+}
+
+// TokenWithCertificate calls the iam service and returns the access token, the client authenticating with
+// the TLS client certificate of the HTTP client (tls_client_auth), see RFC 8705. The access token is bound to
+// the certificate.
+func (c *Client) TokenWithCertificate(clientID string) (string, error) {
+	return c.token(url.Values{
+		GrantTypeKey: {"client_credentials"},
+		ClientIDKey:  {clientID},
+	})
+}
+
+func (c *Client) token(body url.Values) (string, error) {
 	url := c.URL + paths.FullPath(paths.OAuthToken)
-	resp, err := c.HTTPClient.Post(url, "text/plain", bytes.NewBuffer(buildOauthRequestBody(clientID, clientSecret)))
+	resp, err := c.HTTPClient.PostForm(url, body)
 	if err != nil {
 		return "", fmt.Errorf("could not complete request for %s: %w", paths.OAuthToken, err)
 	}
@@ -43,7 +67,7 @@ func (c *Client) Token(clientID, clientSecret string) (string, error) {
 		return "", fmt.Errorf("unhandled error returned http %d: %w", status, iamerrors.ErrInternal)
 	}
 
-	token := new(Token)
+	token := new(TokenResponse)
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return "", iamerrors.ErrServiceUnavailable
@@ -53,7 +77,16 @@ func (c *Client) Token(clientID, clientSecret string) (string, error) {
 	if err != nil {
 		return "", iamerrors.ErrBadResponse
 	}
-	return token.AccessToken, nil
+	if len(token.AccessToken) > 0 {
+		return token.AccessToken, nil
+	}
+
+	// servers in the legacy mode respond with camelCase fields
+	legacy := new(Token)
+	if err := json.Unmarshal(bodyBytes, legacy); err != nil || len(legacy.AccessToken) == 0 {
+		return "", iamerrors.ErrBadResponse
+	}
+	return legacy.AccessToken, nil
 }
 
 // Validate calls the iam service and validates the given token.
@@ -109,6 +142,35 @@ func (c *Client) Identity(token string) (string, error) {
 	return m["subject"], nil
 }
 
-func buildOauthRequestBody(clientID, clientSecret string) []byte {
-	return []byte(fmt.Sprintf("client_id=%s&client_secret=%s&grant_type=client_credentials", clientID, clientSecret))
+// Metadata calls the iam service and returns its authorization server metadata, see RFC 8414, telling its
+// endpoints and capabilities.
+func (c *Client) Metadata() (*Metadata, error) {
+	url := c.URL + paths.FullPath(paths.AuthorizationServerMetadata)
+	resp, err := c.HTTPClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("could not complete request for %s: %w", paths.AuthorizationServerMetadata, err)
+	}
+	defer resp.Body.Close()
+
+	status := resp.StatusCode
+	if status != http.StatusOK {
+		if err, ok := iamerrors.Codes[status]; ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("unhandled error returned http %d: %w", status, iamerrors.ErrInternal)
+	}
+
+	metadata := new(Metadata)
+	if err := json.NewDecoder(resp.Body).Decode(metadata); err != nil {
+		return nil, fmt.Errorf("%s: %w", paths.AuthorizationServerMetadata, err)
+	}
+	return metadata, nil
+}
+
+func buildOauthRequestBody(clientID, clientSecret string) url.Values {
+	return url.Values{
+		GrantTypeKey:    {"client_credentials"},
+		ClientIDKey:     {clientID},
+		ClientSecretKey: {clientSecret},
+	}
 }
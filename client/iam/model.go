@@ -14,22 +14,140 @@
 
 package iam
 
+import "time"
+
 const (
+	// GrantTypeKey is the key for the grant type of the token request.
+	GrantTypeKey = "grant_type"
 	// ClientIDKey is the key for the property client id.
 	ClientIDKey = "client_id"
 	// ClientSecretKey is the key for the property client secret.
 	ClientSecretKey = "client_secret"
+	// ExpiresInKey is the key for the optional lifetime in seconds of the requested access token.
+	ExpiresInKey = "expires_in"
+	// AudienceKey is the key for an audience of the requested access token or of a validated token.
+	AudienceKey = "audience"
+	// ScopeKey is the key for the space-delimited scopes of the requested access token or of a validated token.
+	ScopeKey = "scope"
+	// OverlapKey is the key for how many seconds the previous secrets of a client stay valid after a rotation.
+	OverlapKey = "overlap"
+	// TokenKey is the key for the token of an introspection or revocation request.
+	TokenKey = "token"
+	// TokenTypeHintKey is the key for the optional type of the token of an introspection or revocation request.
+	TokenTypeHintKey = "token_type_hint"
+	// RefreshTokenKey is the key for the refresh token of a token request with the refresh_token grant.
+	RefreshTokenKey = "refresh_token"
+	// SubjectTokenKey is the key for the token exchanged with the token exchange grant, see RFC 8693.
+	SubjectTokenKey = "subject_token"
+	// SubjectTokenTypeKey is the key for the type of the exchanged token.
+	SubjectTokenTypeKey = "subject_token_type"
+	// ActorTokenKey is the key for the token of the actor of a token exchange, which is not supported.
+	ActorTokenKey = "actor_token"
+	// RequestedTokenTypeKey is the key for the optional type of the token requested by a token exchange.
+	RequestedTokenTypeKey = "requested_token_type"
+	// ClientAssertionKey is the key for the signed JWT authenticating the client, see RFC 7523.
+	ClientAssertionKey = "client_assertion"
+	// ClientAssertionTypeKey is the key for the type of the client assertion.
+	ClientAssertionTypeKey = "client_assertion_type"
+
+	// ClientAssertionTypeJWTBearer is the only supported type of client assertions.
+	ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+// Error codes of the token endpoint, see RFC 6749 section 5.2.
+const (
+	ErrorCodeInvalidRequest       = "invalid_request"
+	ErrorCodeInvalidClient        = "invalid_client"
+	ErrorCodeInvalidGrant         = "invalid_grant"
+	ErrorCodeUnauthorizedClient   = "unauthorized_client"
+	ErrorCodeUnsupportedGrantType = "unsupported_grant_type"
+	ErrorCodeInvalidScope         = "invalid_scope"
+	// ErrorCodeInvalidTarget is returned for audiences the client may not request, see RFC 8707.
+	ErrorCodeInvalidTarget = "invalid_target"
+	ErrorCodeServerError   = "server_error"
+	// ErrorCodeTemporarilyUnavailable is returned while the service is overloaded.
+	ErrorCodeTemporarilyUnavailable = "temporarily_unavailable"
+	// ErrorCodeInvalidDPoPProof is returned for invalid DPoP proofs, ErrorCodeUseDPoPNonce for proofs lacking
+	// the nonce of the DPoP-Nonce header, see RFC 9449.
+	ErrorCodeInvalidDPoPProof = "invalid_dpop_proof"
+	ErrorCodeUseDPoPNonce     = "use_dpop_nonce"
 )
 
 // Example request : $ curl -d "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials" https://<domain>/iam/v1/oauth2/token
 // Example response : {
+//    "access_token": "<long text>",
 //    "token_type": "Bearer",
-//    "expires_in": 3599,
-//    "ext_expires_in": 3599,
-//    "access_token": "<long text>"
+//    "expires_in": 3600,
+//    "scope": "<scope>",
+//    "id_token": "<long text>"
 // }
 
-// Token for IAM verification
+// TokenResponse is the response of the token endpoint, see RFC 6749 section 5.1.
+// swagger:model tokenResponse
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	// Scope is the space-delimited list of scopes granted to the access token.
+	Scope string `json:"scope,omitempty"`
+	// IdentityToken carries the application name of the client as subject.
+	IdentityToken string `json:"id_token,omitempty"`
+	// RefreshToken obtains the next tokens with the refresh_token grant, issued to clients allowed it.
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// IssuedTokenType is the type of the token issued by a token exchange, see RFC 8693.
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+// TokenError is an error response of the token endpoint, see RFC 6749 section 5.2.
+// swagger:model tokenError
+type TokenError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// Introspection is the response of the introspection endpoint, see RFC 7662. Inactive tokens are described by
+// active only.
+// swagger:model introspection
+type Introspection struct {
+	Active bool `json:"active"`
+	// Scope is the space-delimited list of scopes granted to the token.
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	// Subject is the application name of the client the token was issued to.
+	Subject   string   `json:"sub,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	JWTID     string   `json:"jti,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	// Actor is the chain of actors of an exchanged token.
+	Actor *Actor `json:"act,omitempty"`
+	// Confirmation is the key the token is bound to, if any.
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+}
+
+// Confirmation is the key a sender-constrained token is bound to, see RFC 7800.
+// swagger:model confirmation
+type Confirmation struct {
+	// X509Thumbprint is the SHA-256 thumbprint of the client certificate the token is bound to, see RFC 8705.
+	X509Thumbprint string `json:"x5t#S256,omitempty"`
+	// JWKThumbprint is the SHA-256 thumbprint of the DPoP key the token is bound to, see RFC 9449.
+	JWKThumbprint string `json:"jkt,omitempty"`
+}
+
+// Actor is the party acting on behalf of the subject of an exchanged token, see RFC 8693 section 4.1.
+// swagger:model actor
+type Actor struct {
+	// Subject is the application name of the acting client.
+	Subject  string `json:"sub"`
+	ClientID string `json:"client_id,omitempty"`
+	// Actor is the prior actor, if any.
+	Actor *Actor `json:"act,omitempty"`
+}
+
+// Token is the response of the token endpoint in the legacy mode.
 // swagger:model token
 type Token struct {
 	TokenType     string `json:"tokenType"`
@@ -39,8 +157,105 @@ type Token struct {
 	ExtExpiresIn  int64  `json:"extExpiresIn"`
 }
 
+// Metadata is the authorization server metadata, see RFC 8414. The service has no authorization endpoint, so
+// it supports no response types.
+// swagger:model metadata
+type Metadata struct {
+	// Issuer is the iss claim of the tokens, the URL of the service under its public URL.
+	Issuer                string   `json:"issuer"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	IntrospectionEndpoint string   `json:"introspection_endpoint"`
+	RevocationEndpoint    string   `json:"revocation_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	ResponseTypes         []string `json:"response_types_supported"`
+	GrantTypes            []string `json:"grant_types_supported"`
+	// TokenEndpointAuthMethods are the client authentication methods, the same at all endpoints.
+	TokenEndpointAuthMethods             []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgs         []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	IntrospectionEndpointAuthMethods     []string `json:"introspection_endpoint_auth_methods_supported"`
+	IntrospectionEndpointAuthSigningAlgs []string `json:"introspection_endpoint_auth_signing_alg_values_supported"`
+	RevocationEndpointAuthMethods        []string `json:"revocation_endpoint_auth_methods_supported"`
+	RevocationEndpointAuthSigningAlgs    []string `json:"revocation_endpoint_auth_signing_alg_values_supported"`
+	// AccessTokenSigningAlgs are the signing algorithms of access tokens.
+	AccessTokenSigningAlgs []string `json:"access_token_signing_alg_values_supported"`
+	// DPoPSigningAlgs are the accepted signing algorithms of DPoP proofs, see RFC 9449.
+	DPoPSigningAlgs []string `json:"dpop_signing_alg_values_supported"`
+	// TLSClientCertificateBoundAccessTokens tells whether access tokens may be bound to client certificates,
+	// see RFC 8705.
+	TLSClientCertificateBoundAccessTokens bool `json:"tls_client_certificate_bound_access_tokens"`
+}
+
 // TokenIdentity for getting the IAM token identity
 // swagger:model tokenIdentity
 type TokenIdentity struct {
 	Identity string `json:"identity"`
 }
+
+// AdminClient is a client managed through the admin API. Client secrets are only returned once, when generated.
+// swagger:model client
+type AdminClient struct {
+	ClientID string `json:"client_id"`
+	// ClientSecret is the generated client secret, returned when the client is created or its secret rotated.
+	ClientSecret string      `json:"client_secret,omitempty"`
+	AppName      string      `json:"app_name"`
+	Description  string      `json:"description,omitempty"`
+	Owner        ClientOwner `json:"owner,omitzero"`
+	// CreatedAt is set by the service when the client is created.
+	CreatedAt         time.Time         `json:"created_at,omitzero"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Disabled          bool              `json:"disabled"`
+	GrantTypes        []string          `json:"grant_types,omitempty"`
+	ExpiresIn         int64             `json:"expires_in,omitempty"`
+	IdentityExpiresIn int64             `json:"identity_expires_in,omitempty"`
+	Audiences         []string          `json:"audiences,omitempty"`
+	Scopes            []string          `json:"scopes,omitempty"`
+	// TokenExchange is the policy of the client exchanging the tokens of its callers.
+	TokenExchange ClientTokenExchange `json:"token_exchange,omitzero"`
+	// TokenEndpointAuthMethod is client_secret_basic, the default, private_key_jwt or tls_client_auth.
+	TokenEndpointAuthMethod string `json:"token_endpoint_auth_method,omitempty"`
+	// PublicKey is the PEM encoded public key verifying the client assertions of private_key_jwt.
+	PublicKey string `json:"public_key,omitempty"`
+	// JWKSURI is the URL of the key set verifying the client assertions, instead of PublicKey.
+	JWKSURI string `json:"jwks_uri,omitempty"`
+	// TLSClientAuth tells the certificate of a client of tls_client_auth.
+	TLSClientAuth ClientTLSClientAuth `json:"tls_client_auth,omitzero"`
+	// TLSClientCertificateBoundAccessTokens binds the access tokens of the client to its certificate.
+	TLSClientCertificateBoundAccessTokens bool `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+	// DPoPBoundAccessTokens requires DPoP proofs with the token requests of the client, see RFC 9449.
+	DPoPBoundAccessTokens bool `json:"dpop_bound_access_tokens,omitempty"`
+	// Secrets tells when the client secrets are valid.
+	Secrets []ClientSecretValidity `json:"secrets,omitempty"`
+}
+
+// ClientOwner is the team responsible for a client.
+// swagger:model clientOwner
+type ClientOwner struct {
+	Team    string `json:"team,omitempty"`
+	Contact string `json:"contact,omitempty"`
+}
+
+// ClientTokenExchange lists the audiences a client may exchange tokens for and, optionally, the clients whose
+// tokens it may exchange.
+// swagger:model clientTokenExchange
+type ClientTokenExchange struct {
+	Audiences []string `json:"audiences,omitempty"`
+	Subjects  []string `json:"subjects,omitempty"`
+}
+
+// ClientTLSClientAuth is the subject distinguished name or one subject alternative name of the certificate of
+// a client, see RFC 8705 section 2.1.2.
+// swagger:model clientTLSClientAuth
+type ClientTLSClientAuth struct {
+	SubjectDN string `json:"subject_dn,omitempty"`
+	SANDNS    string `json:"san_dns,omitempty"`
+	SANURI    string `json:"san_uri,omitempty"`
+	SANIP     string `json:"san_ip,omitempty"`
+	SANEmail  string `json:"san_email,omitempty"`
+}
+
+// ClientSecretValidity is the validity period of a client secret.
+// swagger:model clientSecretValidity
+type ClientSecretValidity struct {
+	NotBefore time.Time `json:"not_before,omitzero"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
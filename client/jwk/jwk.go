@@ -0,0 +1,224 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jwk implements JSON Web Keys (RFC 7517) for the public keys that verify iam-proxy tokens.
+package jwk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Key types and curves
+const (
+	KeyTypeRSA = "RSA"
+	KeyTypeEC  = "EC"
+	KeyTypeOKP = "OKP"
+
+	CurveP256    = "P-256"
+	CurveP384    = "P-384"
+	CurveEd25519 = "Ed25519"
+
+	// UseSignature marks a key as a signature verification key.
+	UseSignature = "sig"
+)
+
+// ErrUnsupportedKey is returned for key types that cannot be represented or used.
+var ErrUnsupportedKey = errors.New("unsupported key")
+
+// Key is a JSON Web Key holding a public key.
+// swagger:model jwk
+type Key struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC and OKP curve and coordinates
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// Set is a JSON Web Key Set.
+// swagger:model jwks
+type Set struct {
+	Keys []Key `json:"keys"`
+}
+
+// New creates the JSON Web Key for an RSA, ECDSA or Ed25519 public key.
+func New(pub crypto.PublicKey) (Key, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return Key{
+			KeyType: KeyTypeRSA,
+			N:       encode(k.N.Bytes()),
+			E:       encode(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		var crv string
+		switch k.Curve {
+		case elliptic.P256():
+			crv = CurveP256
+		case elliptic.P384():
+			crv = CurveP384
+		default:
+			return Key{}, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, k.Curve.Params().Name)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return Key{
+			KeyType: KeyTypeEC,
+			Curve:   crv,
+			X:       encode(k.X.FillBytes(make([]byte, size))),
+			Y:       encode(k.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		return Key{
+			KeyType: KeyTypeOKP,
+			Curve:   CurveEd25519,
+			X:       encode(k),
+		}, nil
+	default:
+		return Key{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, pub)
+	}
+}
+
+// PublicKey returns the public key the JSON Web Key describes.
+func (k Key) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case KeyTypeRSA:
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case KeyTypeEC:
+		var curve elliptic.Curve
+		switch k.Curve {
+		case CurveP256:
+			curve = elliptic.P256()
+		case CurveP384:
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, k.Curve)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return pub, nil
+	case KeyTypeOKP:
+		if k.Curve != CurveEd25519 {
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, k.Curve)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("%w: key type %s", ErrUnsupportedKey, k.KeyType)
+	}
+}
+
+// Thumbprint computes the RFC 7638 SHA-256 thumbprint of the key, base64url encoded.
+func (k Key) Thumbprint() (string, error) {
+	// The members are in lexicographic order, as the RFC requires.
+	var members interface{}
+	switch k.KeyType {
+	case KeyTypeRSA:
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.KeyType, k.N}
+	case KeyTypeEC:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Curve, k.KeyType, k.X, k.Y}
+	case KeyTypeOKP:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{k.Curve, k.KeyType, k.X}
+	default:
+		return "", fmt.Errorf("%w: key type %s", ErrUnsupportedKey, k.KeyType)
+	}
+
+	b, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return encode(sum[:]), nil
+}
+
+// Lookup returns the key with the given key id.
+func (s Set) Lookup(kid string) (Key, bool) {
+	for _, k := range s.Keys {
+		if k.KeyID == kid {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode key parameter: %w", err)
+	}
+	return b, nil
+}
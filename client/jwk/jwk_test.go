@@ -0,0 +1,111 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKey_RoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	tests := map[string]crypto.PublicKey{
+		"rsa":     &rsaKey.PublicKey,
+		"p256":    &p256Key.PublicKey,
+		"p384":    &p384Key.PublicKey,
+		"ed25519": edPub,
+	}
+
+	for name, pub := range tests {
+		t.Run(name, func(t *testing.T) {
+			key, err := New(pub)
+			assert.NoError(t, err)
+
+			b, err := json.Marshal(Set{Keys: []Key{key}})
+			assert.NoError(t, err)
+
+			var set Set
+			assert.NoError(t, json.Unmarshal(b, &set))
+			assert.Len(t, set.Keys, 1)
+
+			decoded, err := set.Keys[0].PublicKey()
+			assert.NoError(t, err)
+			assert.True(t, decoded.(interface{ Equal(crypto.PublicKey) bool }).Equal(pub))
+
+			thumbprint, err := key.Thumbprint()
+			assert.NoError(t, err)
+			assert.NotEmpty(t, thumbprint)
+		})
+	}
+}
+
+func TestKey_Thumbprint(t *testing.T) {
+	// Example from RFC 7638, section 3.1
+	key := Key{
+		KeyType: KeyTypeRSA,
+		N:       "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:       "AQAB",
+		KeyID:   "2011-04-29",
+		Use:     UseSignature,
+	}
+
+	thumbprint, err := key.Thumbprint()
+	assert.NoError(t, err)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", thumbprint)
+}
+
+func TestKey_PublicKey_Invalid(t *testing.T) {
+	tests := map[string]Key{
+		"unknown type":       {KeyType: "oct"},
+		"unknown curve":      {KeyType: KeyTypeEC, Curve: "P-521"},
+		"point not on curve": {KeyType: KeyTypeEC, Curve: CurveP256, X: "AQ", Y: "AQ"},
+		"short ed25519":      {KeyType: KeyTypeOKP, Curve: CurveEd25519, X: "AQ"},
+		"bad encoding":       {KeyType: KeyTypeRSA, N: "!!", E: "AQAB"},
+	}
+
+	for name, key := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := key.PublicKey()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSet_Lookup(t *testing.T) {
+	set := Set{Keys: []Key{{KeyID: "a"}, {KeyID: "b"}}}
+
+	k, ok := set.Lookup("b")
+	assert.True(t, ok)
+	assert.Equal(t, "b", k.KeyID)
+
+	_, ok = set.Lookup("c")
+	assert.False(t, ok)
+}
@@ -19,6 +19,16 @@
 	OAuthToken = "oauth2/token"
 	// ValidateToken is the endpoint path for validating a token
 	ValidateToken = "oauth2/validate"
+	// Introspect is the endpoint describing a token, see RFC 7662
+	Introspect = "oauth2/introspect"
+	// Revoke is the endpoint revoking a token, see RFC 7009
+	Revoke = "oauth2/revoke"
 	// Identity is the endpoint extracting the identity information from a jwt token
 	Identity = "oauth2/identity"
+	// JWKS is the endpoint publishing the token verification keys as a JSON Web Key Set
+	JWKS = ".well-known/jwks.json"
+	// AuthorizationServerMetadata is the endpoint describing the service and its endpoints, see RFC 8414
+	AuthorizationServerMetadata = ".well-known/oauth-authorization-server"
+	// AdminClients is the endpoint managing the clients
+	AdminClients = "admin/clients"
 )
@@ -0,0 +1,43 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command iam-hash reads a client secret from stdin and prints its argon2id hash for IAM_USERS.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ingka-group/iam-proxy/internal/secret"
+)
+
+func main() {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && len(line) == 0 {
+		log.Fatalf("Could not read the client secret: %v", err)
+	}
+	clientSecret := strings.TrimRight(line, "\r\n")
+	if len(clientSecret) == 0 {
+		log.Fatal("The client secret is empty")
+	}
+
+	hash, err := secret.Hash(clientSecret)
+	if err != nil {
+		log.Fatalf("Could not hash the client secret: %v", err)
+	}
+	fmt.Println(hash)
+}
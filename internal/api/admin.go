@@ -0,0 +1,369 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	jwt "github.com/ingka-group/iam-proxy/client/http"
+	"github.com/ingka-group/iam-proxy/client/iam"
+	"github.com/ingka-group/iam-proxy/internal/credentials"
+	"github.com/ingka-group/iam-proxy/internal/logger"
+	"github.com/ingka-group/iam-proxy/internal/models"
+	"github.com/ingka-group/iam-proxy/internal/service"
+)
+
+// clientIDParam is the path parameter of the managed client.
+const clientIDParam = "id"
+
+// authorizeAdmin rejects requests without an access token of this service carrying the admin scope, and those
+// without the certificate or the DPoP proof of the key the token is bound to.
+func (cl *Client) authorizeAdmin(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context()).Sugar()
+	token, err := jwt.ExtractAccessToken(c.Request)
+	if err != nil {
+		log.Errorw("token missing", zap.Error(err))
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	proof, err := cl.dpopProof(c.Request)
+	if err != nil {
+		log.Errorw("Invalid DPoP proof", zap.Error(err))
+		c.Header("WWW-Authenticate", `DPoP error="`+iam.ErrorCodeInvalidDPoPProof+`"`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	err = cl.cfg.Service.AuthorizeAdmin(c.Request.Context(), models.ValidationRequest{Token: token, ClientCertificate: cl.clientCertificate(c.Request), DPoP: proof})
+	if errors.Is(err, service.ErrInsufficientScope) {
+		log.Errorw("Admin access denied", zap.Error(err))
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Errorw("Failed to validate token", zap.Error(err))
+		cl.dpopChallenge(c, err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	c.Next()
+}
+
+// swagger:route GET /admin/clients admin listClients
+//
+// Responds with all clients, without their secrets.
+// Requires an access token with the iam:admin scope.
+//
+//		Produces:
+//		- application/json
+//
+//		Responses:
+//		  200: body:[]client
+//	      401:
+//	      403:
+//	      500:
+func (cl *Client) ListClients(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context()).Sugar()
+	clients, err := cl.cfg.Service.Clients(c.Request.Context())
+	if err != nil {
+		log.Errorw("Failed to list clients", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	list := make([]iam.AdminClient, 0, len(clients))
+	for id, client := range clients {
+		list = append(list, toClient(id, client))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ClientID < list[j].ClientID })
+	c.JSON(http.StatusOK, list)
+}
+
+// swagger:route POST /admin/clients admin createClient
+//
+// Creates a client with a generated secret, responding with the secret once.
+// The client id is generated when none is given. Requires an access token with the iam:admin scope.
+//
+//		Consumes:
+//		- application/json
+//
+//		Produces:
+//		- application/json
+//
+//		Responses:
+//		  201: body:client
+//	      400:
+//	      401:
+//	      403:
+//	      409:
+//	      501:
+func (cl *Client) CreateClient(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context()).Sugar()
+	var req iam.AdminClient
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorw("Failed to parse client", zap.Error(err))
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	id, clientSecret, err := cl.cfg.Service.CreateClient(c.Request.Context(), models.ClientID(req.ClientID), fromClient(req))
+	if err != nil {
+		cl.adminError(c, "Failed to create client", err)
+		return
+	}
+	client, err := cl.cfg.Service.Client(c.Request.Context(), id)
+	if err != nil {
+		cl.adminError(c, "Failed to read created client", err)
+		return
+	}
+	log.Infow("Created client", zap.String("client-id", string(id)))
+
+	resp := toClient(id, client)
+	resp.ClientSecret = clientSecret
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, resp)
+}
+
+// swagger:route GET /admin/clients/{id} admin getClient
+//
+// Responds with the client, without its secrets.
+// Requires an access token with the iam:admin scope.
+//
+//		Produces:
+//		- application/json
+//
+//		Responses:
+//		  200: body:client
+//	      401:
+//	      403:
+//	      404:
+func (cl *Client) GetClient(c *gin.Context) {
+	id := models.ClientID(c.Param(clientIDParam))
+	client, err := cl.cfg.Service.Client(c.Request.Context(), id)
+	if err != nil {
+		cl.adminError(c, "Failed to read client", err)
+		return
+	}
+	c.JSON(http.StatusOK, toClient(id, client))
+}
+
+// swagger:route PUT /admin/clients/{id} admin updateClient
+//
+// Replaces the settings of the client, keeping its secrets.
+// Requires an access token with the iam:admin scope.
+//
+//		Consumes:
+//		- application/json
+//
+//		Produces:
+//		- application/json
+//
+//		Responses:
+//		  200: body:client
+//	      400:
+//	      401:
+//	      403:
+//	      404:
+//	      409:
+//	      501:
+func (cl *Client) UpdateClient(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context()).Sugar()
+	var req iam.AdminClient
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorw("Failed to parse client", zap.Error(err))
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	id := models.ClientID(c.Param(clientIDParam))
+	client, err := cl.cfg.Service.UpdateClient(c.Request.Context(), id, fromClient(req))
+	if err != nil {
+		cl.adminError(c, "Failed to update client", err)
+		return
+	}
+	log.Infow("Updated client", zap.String("client-id", string(id)))
+	c.JSON(http.StatusOK, toClient(id, client))
+}
+
+// swagger:route POST /admin/clients/{id}/disable admin disableClient
+//
+// Disables the client, so it cannot obtain tokens anymore.
+// Requires an access token with the iam:admin scope.
+//
+//		Responses:
+//		  204:
+//	      401:
+//	      403:
+//	      404:
+//	      409:
+//	      501:
+func (cl *Client) DisableClient(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context()).Sugar()
+	id := models.ClientID(c.Param(clientIDParam))
+	if err := cl.cfg.Service.DisableClient(c.Request.Context(), id); err != nil {
+		cl.adminError(c, "Failed to disable client", err)
+		return
+	}
+	log.Infow("Disabled client", zap.String("client-id", string(id)))
+	c.Status(http.StatusNoContent)
+}
+
+// swagger:route DELETE /admin/clients/{id} admin deleteClient
+//
+// Deletes the client.
+// Requires an access token with the iam:admin scope.
+//
+//		Responses:
+//		  204:
+//	      401:
+//	      403:
+//	      404:
+//	      409:
+//	      501:
+func (cl *Client) DeleteClient(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context()).Sugar()
+	id := models.ClientID(c.Param(clientIDParam))
+	if err := cl.cfg.Service.DeleteClient(c.Request.Context(), id); err != nil {
+		cl.adminError(c, "Failed to delete client", err)
+		return
+	}
+	log.Infow("Deleted client", zap.String("client-id", string(id)))
+	c.Status(http.StatusNoContent)
+}
+
+// swagger:route POST /admin/clients/{id}/rotate-secret admin rotateClientSecret
+//
+// Replaces the secrets of the client with a generated one, responding with the secret once.
+// The optional overlap parameter keeps the previous secrets valid for as many seconds.
+// Requires an access token with the iam:admin scope.
+//
+//		Produces:
+//		- application/json
+//
+//		Responses:
+//		  200: body:client
+//	      400:
+//	      401:
+//	      403:
+//	      404:
+//	      409:
+//	      501:
+func (cl *Client) RotateClientSecret(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context()).Sugar()
+	var overlap time.Duration
+	if v, ok := c.GetQuery(iam.OverlapKey); ok {
+		seconds, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || seconds < 0 || seconds > maxSeconds {
+			log.Errorw("Invalid secret overlap", zap.String(iam.OverlapKey, v))
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		overlap = time.Duration(seconds) * time.Second
+	}
+
+	id := models.ClientID(c.Param(clientIDParam))
+	clientSecret, err := cl.cfg.Service.RotateClientSecret(c.Request.Context(), id, overlap)
+	if err != nil {
+		cl.adminError(c, "Failed to rotate client secret", err)
+		return
+	}
+	client, err := cl.cfg.Service.Client(c.Request.Context(), id)
+	if err != nil {
+		cl.adminError(c, "Failed to read rotated client", err)
+		return
+	}
+	log.Infow("Rotated client secret", zap.String("client-id", string(id)))
+
+	resp := toClient(id, client)
+	resp.ClientSecret = clientSecret
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+// adminError responds with the status matching the error of a client change.
+func (cl *Client) adminError(c *gin.Context, msg string, err error) {
+	logger.FromContext(c.Request.Context()).Sugar().Errorw(msg, zap.Error(err))
+	switch {
+	case errors.Is(err, credentials.ErrNotFound):
+		c.AbortWithStatus(http.StatusNotFound)
+	case errors.Is(err, credentials.ErrExists), errors.Is(err, credentials.ErrStale):
+		c.AbortWithStatus(http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidClient):
+		c.AbortWithStatus(http.StatusBadRequest)
+	case errors.Is(err, credentials.ErrReadOnly):
+		c.AbortWithStatus(http.StatusNotImplemented)
+	default:
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
+
+// toClient returns the client as shown by the admin API, leaving out the secrets.
+func toClient(id models.ClientID, client models.Secret) iam.AdminClient {
+	c := iam.AdminClient{
+		ClientID:                              string(id),
+		AppName:                               client.AppName,
+		Description:                           client.Description,
+		Owner:                                 iam.ClientOwner(client.Owner),
+		CreatedAt:                             client.CreatedAt,
+		Labels:                                client.Labels,
+		Disabled:                              client.Disabled,
+		GrantTypes:                            client.GrantTypes,
+		ExpiresIn:                             client.ExpiresIn,
+		IdentityExpiresIn:                     client.IdentityExpiresIn,
+		Audiences:                             client.Audiences,
+		Scopes:                                client.Scopes,
+		TokenExchange:                         iam.ClientTokenExchange(client.TokenExchange),
+		TokenEndpointAuthMethod:               client.TokenEndpointAuthMethod,
+		PublicKey:                             client.PublicKey,
+		JWKSURI:                               client.JWKSURI,
+		TLSClientAuth:                         iam.ClientTLSClientAuth(client.TLSClientAuth),
+		TLSClientCertificateBoundAccessTokens: client.TLSClientCertificateBoundAccessTokens,
+		DPoPBoundAccessTokens:                 client.DPoPBoundAccessTokens,
+	}
+	for _, cs := range client.Secrets() {
+		c.Secrets = append(c.Secrets, iam.ClientSecretValidity{NotBefore: cs.NotBefore, ExpiresAt: cs.ExpiresAt})
+	}
+	return c
+}
+
+// fromClient returns the settings of the client given to the admin API. Secrets and the creation time are
+// managed by the service.
+func fromClient(c iam.AdminClient) models.Secret {
+	return models.Secret{
+		AppName:                               c.AppName,
+		Description:                           c.Description,
+		Owner:                                 models.Owner(c.Owner),
+		Labels:                                c.Labels,
+		Disabled:                              c.Disabled,
+		GrantTypes:                            c.GrantTypes,
+		ExpiresIn:                             c.ExpiresIn,
+		IdentityExpiresIn:                     c.IdentityExpiresIn,
+		Audiences:                             c.Audiences,
+		Scopes:                                c.Scopes,
+		TokenExchange:                         models.TokenExchange(c.TokenExchange),
+		TokenEndpointAuthMethod:               c.TokenEndpointAuthMethod,
+		PublicKey:                             c.PublicKey,
+		JWKSURI:                               c.JWKSURI,
+		TLSClientAuth:                         models.TLSClientAuth(c.TLSClientAuth),
+		TLSClientCertificateBoundAccessTokens: c.TLSClientCertificateBoundAccessTokens,
+		DPoPBoundAccessTokens:                 c.DPoPBoundAccessTokens,
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	clienthttp "github.com/ingka-group/iam-proxy/client/http"
+	"github.com/ingka-group/iam-proxy/client/iam"
+	"github.com/ingka-group/iam-proxy/client/paths"
+	"github.com/ingka-group/iam-proxy/internal/config"
+	"github.com/ingka-group/iam-proxy/internal/credentials"
+	"github.com/ingka-group/iam-proxy/internal/database"
+	"github.com/ingka-group/iam-proxy/internal/models"
+	"github.com/ingka-group/iam-proxy/internal/service"
+	"github.com/ingka-group/iam-proxy/internal/service/mock_service"
+	"github.com/ingka-group/iam-proxy/internal/testutil"
+)
+
+func TestClient_Admin(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	auth := map[string]string{clienthttp.AuthorizationHeaderKey: "Bearer admin-token"}
+	admin := models.ValidationRequest{Token: "admin-token"}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		header   map[string]string
+		expect   func(m *mock_service.MockServicer)
+		wantCode int
+	}{
+		{
+			name:     "token_missing",
+			method:   http.MethodGet,
+			path:     paths.AdminClients,
+			expect:   func(m *mock_service.MockServicer) {},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "token_invalid",
+			method: http.MethodGet,
+			path:   paths.AdminClients,
+			header: auth,
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().AuthorizeAdmin(gomock.Any(), admin).Return(errors.New("some error"))
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "scope_missing",
+			method: http.MethodGet,
+			path:   paths.AdminClients,
+			header: auth,
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().AuthorizeAdmin(gomock.Any(), admin).Return(service.ErrInsufficientScope)
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:   "list",
+			method: http.MethodGet,
+			path:   paths.AdminClients,
+			header: auth,
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().AuthorizeAdmin(gomock.Any(), admin).Return(nil)
+				m.EXPECT().Clients(gomock.Any()).Return(models.IAM{"a": {ClientSecret: "hash", AppName: "app"}}, nil)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:   "not_found",
+			method: http.MethodGet,
+			path:   paths.AdminClients + "/missing",
+			header: auth,
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().AuthorizeAdmin(gomock.Any(), admin).Return(nil)
+				m.EXPECT().Client(gomock.Any(), models.ClientID("missing")).Return(models.Secret{}, credentials.ErrNotFound)
+			},
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:   "update_stale",
+			method: http.MethodPut,
+			path:   paths.AdminClients + "/a",
+			body:   `{"app_name": "app"}`,
+			header: auth,
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().AuthorizeAdmin(gomock.Any(), admin).Return(nil)
+				m.EXPECT().UpdateClient(gomock.Any(), models.ClientID("a"), models.Secret{AppName: "app"}).Return(models.Secret{}, credentials.ErrStale)
+			},
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:   "create_exists",
+			method: http.MethodPost,
+			path:   paths.AdminClients,
+			body:   `{"client_id": "a", "app_name": "app"}`,
+			header: auth,
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().AuthorizeAdmin(gomock.Any(), admin).Return(nil)
+				m.EXPECT().CreateClient(gomock.Any(), models.ClientID("a"), models.Secret{AppName: "app"}).Return(models.ClientID(""), "", credentials.ErrExists)
+			},
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:   "create_malformed",
+			method: http.MethodPost,
+			path:   paths.AdminClients,
+			body:   `{"client_id": `,
+			header: auth,
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().AuthorizeAdmin(gomock.Any(), admin).Return(nil)
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:   "update_invalid",
+			method: http.MethodPut,
+			path:   paths.AdminClients + "/a",
+			body:   `{"app_name": "app", "expires_in": -1}`,
+			header: auth,
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().AuthorizeAdmin(gomock.Any(), admin).Return(nil)
+				m.EXPECT().UpdateClient(gomock.Any(), models.ClientID("a"), models.Secret{AppName: "app", ExpiresIn: -1}).Return(models.Secret{}, service.ErrInvalidClient)
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:   "read_only",
+			method: http.MethodDelete,
+			path:   paths.AdminClients + "/a",
+			header: auth,
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().AuthorizeAdmin(gomock.Any(), admin).Return(nil)
+				m.EXPECT().DeleteClient(gomock.Any(), models.ClientID("a")).Return(credentials.ErrReadOnly)
+			},
+			wantCode: http.StatusNotImplemented,
+		},
+		{
+			name:   "rotate_overlap_invalid",
+			method: http.MethodPost,
+			path:   paths.AdminClients + "/a/rotate-secret?overlap=-1",
+			header: auth,
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().AuthorizeAdmin(gomock.Any(), admin).Return(nil)
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:   "rotate_overlap_overflow",
+			method: http.MethodPost,
+			path:   paths.AdminClients + "/a/rotate-secret?overlap=9223372036854775807",
+			header: auth,
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().AuthorizeAdmin(gomock.Any(), admin).Return(nil)
+			},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mock_service.NewMockServicer(ctrl)
+			tt.expect(mock)
+			c, err := New(Config{Config: testutil.SampleConfig(), Service: mock})
+			assert.NoError(t, err)
+
+			resp, err := doRequest(tt.method, paths.FullPath(tt.path), []byte(tt.body), tt.header, c)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantCode, resp.Code)
+		})
+	}
+}
+
+func TestClient_AdminEnd2End(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "clients.db")
+	srv, err := service.New(context.TODO(), defaultConfig(config.IAM{UsersDriver: database.DriverSQLite, UsersDSN: dsn, Secret: "test"}))
+	assert.NoError(t, err)
+	_, adminSecret, err := srv.CreateClient(t.Context(), "admin", models.Secret{AppName: "admin", Scopes: []string{models.ScopeAdmin}})
+	assert.NoError(t, err)
+
+	c, err := New(Config{Config: testutil.SampleConfig(), Service: srv})
+	assert.NoError(t, err)
+
+	token := func(clientID, clientSecret string, scope string) (int, iam.TokenResponse) {
+		form := url.Values{iam.GrantTypeKey: {models.GrantTypeClientCredentials}, iam.ClientIDKey: {clientID}, iam.ClientSecretKey: {clientSecret}, iam.ScopeKey: {scope}}
+		resp, err := doRequest(http.MethodPost, paths.FullPath(paths.OAuthToken), []byte(form.Encode()), formHeader, c)
+		assert.NoError(t, err)
+		var tok iam.TokenResponse
+		if resp.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &tok))
+		}
+		return resp.Code, tok
+	}
+	code, admin := token("admin", adminSecret, models.ScopeAdmin)
+	assert.Equal(t, http.StatusOK, code)
+	auth := map[string]string{clienthttp.AuthorizationHeaderKey: fmt.Sprintf("Bearer %s", admin.AccessToken)}
+	manage := func(method, path, body string) (int, iam.AdminClient) {
+		resp, err := doRequest(method, paths.FullPath(paths.AdminClients+path), []byte(body), auth, c)
+		assert.NoError(t, err)
+		var client iam.AdminClient
+		if resp.Code == http.StatusOK || resp.Code == http.StatusCreated {
+			assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &client))
+		}
+		return resp.Code, client
+	}
+
+	// the secret is returned once, on creation
+	code, created := manage(http.MethodPost, "", `{"client_id": "billing", "app_name": "billing", "audiences": ["orders"]}`)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.NotEmpty(t, created.ClientSecret)
+	assert.Len(t, created.Secrets, 1)
+	code, read := manage(http.MethodGet, "/billing", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, read.ClientSecret)
+	assert.Equal(t, []string{"orders"}, read.Audiences)
+	code, _ = token("billing", created.ClientSecret, "")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, updated := manage(http.MethodPut, "/billing", `{"app_name": "billing-v2"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "billing-v2", updated.AppName)
+	assert.Empty(t, updated.Audiences)
+
+	code, rotated := manage(http.MethodPost, "/billing/rotate-secret", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotEmpty(t, rotated.ClientSecret)
+	code, _ = token("billing", created.ClientSecret, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = token("billing", rotated.ClientSecret, "")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = manage(http.MethodPost, "/billing/disable", "")
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _ = token("billing", rotated.ClientSecret, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = manage(http.MethodDelete, "/billing", "")
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _ = manage(http.MethodGet, "/billing", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// tokens without the admin scope are refused
+	code, plain := token("admin", adminSecret, "")
+	assert.Equal(t, http.StatusOK, code)
+	auth[clienthttp.AuthorizationHeaderKey] = fmt.Sprintf("Bearer %s", plain.AccessToken)
+	code, _ = manage(http.MethodGet, "", "")
+	assert.Equal(t, http.StatusForbidden, code)
+}
@@ -18,8 +18,16 @@
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 
 	ginzap "github.com/gin-contrib/zap"
@@ -57,6 +65,10 @@ type Client struct {
 	cfg    Config
 	server http.Server
 	tracer trace.Tracer
+	// proxies are trusted to forward the request of their callers in the X-Forwarded headers
+	proxies trustedProxies
+	// forwarded reads the client certificates forwarded by trusted proxies, nil unless configured
+	forwarded *forwardedCertificates
 }
 
 // New creates a new HTTP Server
@@ -65,6 +77,16 @@ func New(cfg Config) (*Client, error) {
 		cfg:    cfg,
 		tracer: otel.Tracer("api"),
 	}
+	proxies, err := newTrustedProxies(cfg.TLS.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("configure trusted proxies: %w", err)
+	}
+	c.proxies = proxies
+	forwarded, err := newForwardedCertificates(cfg.TLS, proxies)
+	if err != nil {
+		return nil, fmt.Errorf("configure forwarded client certificates: %w", err)
+	}
+	c.forwarded = forwarded
 
 	router := c.setupRouter()
 
@@ -80,10 +102,150 @@ func New(cfg Config) (*Client, error) {
 		Addr:    cfg.ListenAddr,
 		Handler: handler,
 	}
+	if cfg.TLS.Enabled() {
+		tlsConfig, err := newTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("configure TLS: %w", err)
+		}
+		c.server.TLSConfig = tlsConfig
+	}
 
 	return c, nil
 }
 
+// newTLSConfig returns the TLS configuration of the server. Client certificates are requested when client
+// certificate authorities are given, but not required: clients may still authenticate otherwise.
+func newTLSConfig(cfg config.TLS) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load server certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{certificate},
+	}
+	if len(cfg.ClientCAFile) == 0 {
+		return tlsConfig, nil
+	}
+	pool, err := clientCAs(cfg.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
+
+// clientCAs loads the certificate authorities of client certificates.
+func clientCAs(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read client certificate authorities: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificate found in %s", file)
+	}
+	return pool, nil
+}
+
+// trustedProxies are the IP addresses and CIDR ranges of the proxies in front of the service.
+type trustedProxies []netip.Prefix
+
+func newTrustedProxies(proxies []string) (trustedProxies, error) {
+	var t trustedProxies
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			t = append(t, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		t = append(t, prefix.Masked())
+	}
+	return t, nil
+}
+
+// trusts tells whether the request comes from a trusted proxy.
+func (t trustedProxies) trusts(r *http.Request) bool {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, proxy := range t {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedCertificates reads the client certificates that proxies terminating TLS forward in a header. Only
+// the header of requests from trusted proxies is read, and the certificate is verified like one presented
+// over TLS.
+type forwardedCertificates struct {
+	header  string
+	proxies trustedProxies
+	roots   *x509.CertPool
+}
+
+// newForwardedCertificates returns nil when no header is configured, which otherwise requires the trusted
+// proxies and the certificate authorities of client certificates.
+func newForwardedCertificates(cfg config.TLS, proxies trustedProxies) (*forwardedCertificates, error) {
+	if len(cfg.ClientCertHeader) == 0 {
+		return nil, nil
+	}
+	if len(proxies) == 0 {
+		return nil, errors.New("the trusted proxies forwarding client certificates must be configured")
+	}
+	if len(cfg.ClientCAFile) == 0 {
+		return nil, errors.New("the client certificate authorities must be configured")
+	}
+	roots, err := clientCAs(cfg.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	return &forwardedCertificates{header: cfg.ClientCertHeader, proxies: proxies, roots: roots}, nil
+}
+
+// trusts tells whether the request comes from a trusted proxy.
+func (f *forwardedCertificates) trusts(r *http.Request) bool {
+	return f.proxies.trusts(r)
+}
+
+// certificate returns the verified certificate forwarded in the header, nil when there is none.
+func (f *forwardedCertificates) certificate(r *http.Request) (*x509.Certificate, error) {
+	value := r.Header.Get(f.header)
+	if len(value) == 0 {
+		return nil, nil
+	}
+	if unescaped, err := url.PathUnescape(value); err == nil {
+		value = unescaped
+	}
+	block, _ := pem.Decode([]byte(value))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM certificate in the forwarded header")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse forwarded certificate: %w", err)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:     f.roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return nil, fmt.Errorf("could not verify forwarded certificate: %w", err)
+	}
+	return cert, nil
+}
+
 func (cl *Client) setupRouter() *gin.Engine {
 	router := gin.New()
 
@@ -107,8 +269,14 @@ func (cl *Client) setupRouter() *gin.Engine {
 		k8s.GET("/"+paths.ReadyPath, cl.Ready)
 		k8s.POST("/"+paths.OAuthToken, cl.Token)
 		k8s.POST("/"+paths.ValidateToken, cl.Validate)
+		k8s.POST("/"+paths.Introspect, cl.Introspect)
+		k8s.POST("/"+paths.Revoke, cl.Revoke)
 		k8s.POST("/"+paths.Identity, cl.Identity)
+		k8s.GET("/"+paths.JWKS, cl.JWKS)
+		k8s.GET("/"+paths.AuthorizationServerMetadata, cl.Metadata)
 	}
+	// The metadata of an issuer with a path is found by inserting the well-known path, see RFC 8414 section 3.1
+	router.GET("/"+paths.AuthorizationServerMetadata+paths.PathPrefix, cl.Metadata)
 
 	// Group /stocklevel-store/v1
 	v1 := router.Group(paths.PathPrefix)
@@ -130,6 +298,18 @@ func (cl *Client) setupRouter() *gin.Engine {
 	//   - stack means whether output the stack info.
 	v1.Use(ginzap.RecoveryWithZap(l, true))
 
+	// Client management, logged for auditing
+	admin := v1.Group("/"+paths.AdminClients, cl.authorizeAdmin)
+	{
+		admin.GET("", cl.ListClients)
+		admin.POST("", cl.CreateClient)
+		admin.GET("/:"+clientIDParam, cl.GetClient)
+		admin.PUT("/:"+clientIDParam, cl.UpdateClient)
+		admin.DELETE("/:"+clientIDParam, cl.DeleteClient)
+		admin.POST("/:"+clientIDParam+"/disable", cl.DisableClient)
+		admin.POST("/:"+clientIDParam+"/rotate-secret", cl.RotateClientSecret)
+	}
+
 	return router
 }
 
@@ -152,8 +332,11 @@ func (cl *Client) registerMetrics() error {
 	return err
 }
 
-// ListenAndServe long-running process that listens and accepts incoming requests
+// ListenAndServe long-running process that listens and accepts incoming requests, over TLS when configured
 func (cl *Client) ListenAndServe() error {
+	if cl.server.TLSConfig != nil {
+		return cl.server.ListenAndServeTLS("", "")
+	}
 	return cl.server.ListenAndServe()
 }
 
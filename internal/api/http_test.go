@@ -16,21 +16,31 @@
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 
 	"github.com/ingka-group/iam-proxy/client/health"
+	clienthttp "github.com/ingka-group/iam-proxy/client/http"
 	"github.com/ingka-group/iam-proxy/client/paths"
 	"github.com/ingka-group/iam-proxy/internal/config"
 	"github.com/ingka-group/iam-proxy/internal/logger"
+	"github.com/ingka-group/iam-proxy/internal/models"
+	"github.com/ingka-group/iam-proxy/internal/service"
 	"github.com/ingka-group/iam-proxy/internal/service/mock_service"
 	"github.com/ingka-group/iam-proxy/internal/testutil"
 )
@@ -205,3 +215,206 @@ func doRequest(method, uri string, body []byte, header map[string]string, c *Cli
 
 	return resp, nil
 }
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	_, serverPEM, serverKey, err := testutil.Certificate(&x509.Certificate{Subject: pkix.Name{CommonName: "localhost"}, DNSNames: []string{"localhost"}})
+	assert.NoError(t, err)
+	_, caPEM, _, err := testutil.Certificate(&x509.Certificate{Subject: pkix.Name{CommonName: "ca"}, IsCA: true, BasicConstraintsValid: true})
+	assert.NoError(t, err)
+	files := map[string][]byte{"server.pem": serverPEM, "server.key": serverKey, "ca.pem": caPEM, "empty.pem": nil}
+	for name, data := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := map[string]struct {
+		cfg        config.TLS
+		clientAuth tls.ClientAuthType
+		err        bool
+	}{
+		"server": {
+			cfg:        config.TLS{CertFile: path("server.pem"), KeyFile: path("server.key")},
+			clientAuth: tls.NoClientCert,
+		},
+		"client_certificates": {
+			cfg:        config.TLS{CertFile: path("server.pem"), KeyFile: path("server.key"), ClientCAFile: path("ca.pem")},
+			clientAuth: tls.VerifyClientCertIfGiven,
+		},
+		"key_missing": {
+			cfg: config.TLS{CertFile: path("server.pem"), KeyFile: path("missing.key")},
+			err: true,
+		},
+		"ca_missing": {
+			cfg: config.TLS{CertFile: path("server.pem"), KeyFile: path("server.key"), ClientCAFile: path("missing.pem")},
+			err: true,
+		},
+		"ca_empty": {
+			cfg: config.TLS{CertFile: path("server.pem"), KeyFile: path("server.key"), ClientCAFile: path("empty.pem")},
+			err: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tlsConfig, err := newTLSConfig(tt.cfg)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.clientAuth, tlsConfig.ClientAuth)
+			assert.Len(t, tlsConfig.Certificates, 1)
+		})
+	}
+}
+
+func TestClient_TLS(t *testing.T) {
+	dir := t.TempDir()
+	_, serverPEM, serverKey, err := testutil.Certificate(&x509.Certificate{Subject: pkix.Name{CommonName: "localhost"}, IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}})
+	assert.NoError(t, err)
+	clientCertificate, clientPEM, clientKey, err := testutil.Certificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "billing"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	assert.NoError(t, err)
+	for name, data := range map[string][]byte{"server.pem": serverPEM, "server.key": serverKey, "client.pem": clientPEM} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+	}
+
+	cfg := testutil.SampleConfig()
+	// the self-signed client certificate is its own authority
+	cfg.TLS = config.TLS{CertFile: filepath.Join(dir, "server.pem"), KeyFile: filepath.Join(dir, "server.key"), ClientCAFile: filepath.Join(dir, "client.pem")}
+	mock := mock_service.NewMockServicer(gomock.NewController(t))
+	c, err := New(Config{Config: cfg, Service: mock})
+	assert.NoError(t, err)
+	server := httptest.NewUnstartedServer(c.server.Handler)
+	server.TLS = c.server.TLSConfig
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	assert.True(t, roots.AppendCertsFromPEM(serverPEM))
+	keyPair, err := tls.X509KeyPair(clientPEM, clientKey)
+	assert.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{keyPair}}}}
+
+	// clients of tls_client_auth send their client id only
+	mock.EXPECT().GenerateToken(gomock.Any(), models.TokenRequest{
+		GrantType:         models.GrantTypeClientCredentials,
+		ClientID:          "billing",
+		ClientCertificate: clientCertificate,
+	}).Return(models.Token{AccessToken: "access-token", ExpiresIn: 1}, nil)
+	resp, err := client.PostForm(server.URL+paths.FullPath(paths.OAuthToken), url.Values{"grant_type": {"client_credentials"}, "client_id": {"billing"}})
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// validation checks the certificate the token is bound to
+	mock.EXPECT().ValidateToken(gomock.Any(), models.ValidationRequest{Token: "access-token", ClientCertificate: clientCertificate}).Return(nil)
+	req, err := http.NewRequest(http.MethodPost, server.URL+paths.FullPath(paths.ValidateToken), nil)
+	assert.NoError(t, err)
+	req.Header.Set(clienthttp.AuthorizationHeaderKey, "Bearer access-token")
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	mock.EXPECT().ValidateToken(gomock.Any(), models.ValidationRequest{Token: "access-token"}).Return(service.ErrCertificateRequired)
+	plain := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	resp, err = plain.Do(req)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// so does the admin API
+	mock.EXPECT().AuthorizeAdmin(gomock.Any(), models.ValidationRequest{Token: "access-token", ClientCertificate: clientCertificate}).Return(nil)
+	mock.EXPECT().Clients(gomock.Any()).Return(models.IAM{}, nil)
+	req, err = http.NewRequest(http.MethodGet, server.URL+paths.FullPath(paths.AdminClients), nil)
+	assert.NoError(t, err)
+	req.Header.Set(clienthttp.AuthorizationHeaderKey, "Bearer access-token")
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	mock.EXPECT().AuthorizeAdmin(gomock.Any(), models.ValidationRequest{Token: "access-token"}).Return(service.ErrCertificateRequired)
+	resp, err = plain.Do(req)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestClient_ForwardedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	clientCertificate, clientPEM, _, err := testutil.Certificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "billing"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	assert.NoError(t, err)
+	_, otherPEM, _, err := testutil.Certificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "billing"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	assert.NoError(t, err)
+	// the self-signed client certificate is its own authority
+	caFile := filepath.Join(dir, "client.pem")
+	assert.NoError(t, os.WriteFile(caFile, clientPEM, 0o600))
+
+	cfg := testutil.SampleConfig()
+	cfg.TLS = config.TLS{ClientCAFile: caFile, ClientCertHeader: "X-Forwarded-Client-Cert", TrustedProxies: []string{"192.0.2.0/24", "2001:db8::1"}}
+	mock := mock_service.NewMockServicer(gomock.NewController(t))
+	c, err := New(Config{Config: cfg, Service: mock})
+	assert.NoError(t, err)
+
+	tests := map[string]struct {
+		remoteAddr  string
+		certificate string
+		want        *x509.Certificate
+	}{
+		"trusted_proxy": {
+			remoteAddr:  "192.0.2.10:443",
+			certificate: url.PathEscape(string(clientPEM)),
+			want:        clientCertificate,
+		},
+		"trusted_proxy_ipv6": {
+			remoteAddr:  "[2001:db8::1]:443",
+			certificate: url.PathEscape(string(clientPEM)),
+			want:        clientCertificate,
+		},
+		"malformed_certificate": {
+			remoteAddr:  "192.0.2.10:443",
+			certificate: "not-a-certificate",
+		},
+		"untrusted_caller": {
+			remoteAddr:  "198.51.100.1:443",
+			certificate: url.PathEscape(string(clientPEM)),
+		},
+		"untrusted_certificate": {
+			remoteAddr:  "192.0.2.10:443",
+			certificate: url.PathEscape(string(otherPEM)),
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			mock.EXPECT().ValidateToken(gomock.Any(), models.ValidationRequest{Token: "access-token", ClientCertificate: tt.want}).Return(nil)
+			req := httptest.NewRequest(http.MethodPost, paths.FullPath(paths.ValidateToken), nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set(clienthttp.AuthorizationHeaderKey, "Bearer access-token")
+			req.Header.Set("X-Forwarded-Client-Cert", tt.certificate)
+			resp := httptest.NewRecorder()
+			c.setupRouter().ServeHTTP(resp, req)
+			assert.Equal(t, http.StatusOK, resp.Code)
+		})
+	}
+
+	// forwarded certificates need trusted proxies and authorities
+	for _, tlsConfig := range []config.TLS{
+		{ClientCertHeader: "X-Forwarded-Client-Cert", ClientCAFile: caFile},
+		{ClientCertHeader: "X-Forwarded-Client-Cert", TrustedProxies: []string{"192.0.2.0/24"}},
+		{ClientCertHeader: "X-Forwarded-Client-Cert", ClientCAFile: caFile, TrustedProxies: []string{"proxy"}},
+	} {
+		cfg.TLS = tlsConfig
+		_, err := New(Config{Config: cfg, Service: mock})
+		assert.Error(t, err)
+	}
+}
@@ -31,88 +31,382 @@
 package api
 
 import (
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
 	jwt "github.com/ingka-group/iam-proxy/client/http"
 	"github.com/ingka-group/iam-proxy/client/iam"
+	"github.com/ingka-group/iam-proxy/client/paths"
+	"github.com/ingka-group/iam-proxy/internal/config"
 	"github.com/ingka-group/iam-proxy/internal/logger"
+	"github.com/ingka-group/iam-proxy/internal/models"
+	"github.com/ingka-group/iam-proxy/internal/service"
+)
+
+const (
+	// jwksMaxAge is how long consumers may cache the key set.
+	jwksMaxAge = 5 * time.Minute
+	// formContentType is the content type of token requests.
+	formContentType = "application/x-www-form-urlencoded"
+	// maxSeconds is the longest duration in seconds that converts to a time.Duration without overflowing.
+	maxSeconds = int64(math.MaxInt64 / time.Second)
 )
 
 // swagger:route POST /oauth2/token token
 //
-// Responds with an access token.
+// Responds with an access token, see RFC 6749.
+// Clients authenticate with HTTP Basic authentication or the client_id and client_secret parameters of the
+// application/x-www-form-urlencoded body, or private_key_jwt clients with client_assertion and
+// client_assertion_type, see RFC 7523, or tls_client_auth clients with their TLS client certificate, see
+// RFC 8705. The client_credentials, refresh_token and token exchange grant types are supported.
+// Clients allowed the refresh_token grant receive a refresh_token, exchanged once for new tokens.
+// The token exchange grant exchanges the access token in subject_token for an access token for the requested
+// audience, on behalf of its subject, see RFC 8693.
+// The optional expires_in parameter requests a lifetime in seconds shorter than the client's maximum.
+// The optional audience parameters restrict the token to audiences the client is allowed.
+// The optional scope parameter requests space-delimited scopes the client is allowed, the granted
+// scopes are returned in scope.
+// A proof in the DPoP header binds the access token to its key, with token_type DPoP, see RFC 9449.
+// Errors are responded as in RFC 6749 section 5.2. In the legacy mode the response has camelCase fields
+// and errors are bare status codes.
+//
+//		Consumes:
+//		- application/x-www-form-urlencoded
 //
 //		Produces:
 //		- application/json
 //
 //		Responses:
-//		  200: body:token
-//	      400:
-//	      401:
+//		  200: body:tokenResponse
+//	      400: body:tokenError
+//	      401: body:tokenError
+//	      500: body:tokenError
+//	      503: body:tokenError
 //
-// Example: $ curl -d "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials" https://<domain>/iam/v1/oauth2/token
+// Example: $ curl -u "<your-client-id>:<your-client-secret>" -d "grant_type=client_credentials" https://<domain>/iam/v1/oauth2/token
 func (cl *Client) Token(c *gin.Context) {
 	log := logger.FromContext(c.Request.Context()).Sugar()
+	legacy := cl.cfg.IAM.LegacyTokenEndpoint
 
 	defer c.Request.Body.Close()
 
+	if !legacy && c.ContentType() != formContentType {
+		log.Errorw("Unsupported content type", zap.String("content-type", c.ContentType()))
+		cl.tokenError(c, http.StatusBadRequest, iam.ErrorCodeInvalidRequest, "content type must be "+formContentType)
+		return
+	}
+
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		log.Errorw("Failed to read body", zap.Error(err))
-		c.AbortWithStatus(http.StatusBadRequest)
+		cl.tokenError(c, http.StatusBadRequest, iam.ErrorCodeInvalidRequest, "body cannot be read")
 		return
 	}
 
 	v, err := url.ParseQuery(string(body))
 	if err != nil {
 		log.Errorw("Failed to parse data", zap.Error(err))
-		c.AbortWithStatus(http.StatusBadRequest)
+		cl.tokenError(c, http.StatusBadRequest, iam.ErrorCodeInvalidRequest, "body is not form encoded")
 		return
 	}
 
-	if clID, ok := v[iam.ClientIDKey]; !ok || len(clID) == 0 {
-		log.Errorw("client id '%s' is missing", iam.ClientIDKey, zap.Error(err))
-		c.AbortWithStatus(http.StatusBadRequest)
+	grantType := v.Get(iam.GrantTypeKey)
+	if len(grantType) == 0 && legacy {
+		grantType = models.GrantTypeClientCredentials
+	}
+	switch grantType {
+	case models.GrantTypeClientCredentials:
+	case models.GrantTypeRefreshToken:
+		if len(v.Get(iam.RefreshTokenKey)) == 0 {
+			log.Errorw("refresh token is missing")
+			cl.tokenError(c, http.StatusBadRequest, iam.ErrorCodeInvalidRequest, iam.RefreshTokenKey+" is missing")
+			return
+		}
+	case models.GrantTypeTokenExchange:
+		if err := exchangeParameters(v); err != nil {
+			log.Errorw("Invalid token exchange", zap.Error(err))
+			cl.tokenError(c, http.StatusBadRequest, iam.ErrorCodeInvalidRequest, err.Error())
+			return
+		}
+	case "":
+		log.Errorw("grant type is missing")
+		cl.tokenError(c, http.StatusBadRequest, iam.ErrorCodeInvalidRequest, iam.GrantTypeKey+" is missing")
+		return
+	default:
+		log.Errorw("Unsupported grant type", zap.String(iam.GrantTypeKey, grantType))
+		cl.tokenError(c, http.StatusBadRequest, iam.ErrorCodeUnsupportedGrantType, "")
 		return
 	}
 
-	if clSecret, ok := v[iam.ClientSecretKey]; !ok || len(clSecret) == 0 {
-		log.Errorw("client secret '%s' is missing", iam.ClientSecretKey, zap.Error(err))
-		c.AbortWithStatus(http.StatusBadRequest)
+	auth, err := cl.clientCredentials(c.Request, v)
+	if err != nil {
+		log.Errorw("Invalid client authentication", zap.Error(err))
+		cl.tokenError(c, http.StatusBadRequest, iam.ErrorCodeInvalidRequest, err.Error())
+		return
+	}
+	if auth.missing() {
+		log.Errorw("client credentials are missing")
+		cl.tokenError(c, http.StatusUnauthorized, iam.ErrorCodeInvalidClient, "client authentication is missing")
+		return
+	}
+	proof, err := cl.dpopProof(c.Request)
+	if err != nil {
+		log.Errorw("Invalid DPoP proof", zap.Error(err))
+		cl.tokenError(c, http.StatusBadRequest, iam.ErrorCodeInvalidDPoPProof, err.Error())
 		return
 	}
 
-	accessToken, identityToken, expiresIn, err := cl.cfg.Service.GenerateToken(c.Request.Context(), v[iam.ClientIDKey][0], v[iam.ClientSecretKey][0])
+	req := models.TokenRequest{
+		GrantType:         grantType,
+		ClientID:          auth.ID,
+		ClientSecret:      auth.Secret,
+		ClientAssertion:   auth.Assertion,
+		ClientCertificate: auth.Certificate,
+		RefreshToken:      v.Get(iam.RefreshTokenKey),
+		SubjectToken:      v.Get(iam.SubjectTokenKey),
+		DPoP:              proof,
+	}
+	if v.Has(iam.ExpiresInKey) {
+		expiresIn, err := strconv.ParseInt(v.Get(iam.ExpiresInKey), 10, 64)
+		if err != nil || expiresIn <= 0 || expiresIn > maxSeconds {
+			log.Errorw("Invalid token lifetime", zap.String(iam.ExpiresInKey, v.Get(iam.ExpiresInKey)))
+			cl.tokenError(c, http.StatusBadRequest, iam.ErrorCodeInvalidRequest, iam.ExpiresInKey+" must be a positive number of seconds")
+			return
+		}
+		req.ExpiresIn = time.Duration(expiresIn) * time.Second
+	}
+	req.Audience = v[iam.AudienceKey]
+	if scope := strings.Fields(v.Get(iam.ScopeKey)); len(scope) > 0 {
+		req.Scope = scope
+	}
+
+	token, err := cl.cfg.Service.GenerateToken(c.Request.Context(), req)
 	if err != nil {
-		log.Errorw("Failed to generate token", zap.Error(err),
-			zap.String("client-id", v[iam.ClientIDKey][0]),
-			zap.String("client-secret", v[iam.ClientSecretKey][0]))
-		c.AbortWithStatus(http.StatusUnauthorized)
+		log.Errorw("Failed to generate token", zap.Error(err), zap.String("client-id", auth.ID))
+		if errors.Is(err, service.ErrDPoPNonceRequired) {
+			cl.setDPoPNonce(c)
+		}
+		status, code := tokenErrorCode(err)
+		cl.tokenError(c, status, code, "")
 		return
 	}
-	c.JSON(http.StatusOK, iam.Token{
-		TokenType:     "Bearer",
-		ExpiresIn:     expiresIn,
-		ExtExpiresIn:  expiresIn,
-		AccessToken:   accessToken,
-		IdentityToken: identityToken,
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	if legacy {
+		c.JSON(http.StatusOK, iam.Token{
+			TokenType:     "Bearer",
+			ExpiresIn:     token.ExpiresIn,
+			ExtExpiresIn:  token.ExpiresIn,
+			AccessToken:   token.AccessToken,
+			IdentityToken: token.IdentityToken,
+		})
+		return
+	}
+	tokenType := "Bearer"
+	if token.DPoP {
+		tokenType = "DPoP"
+	}
+	c.JSON(http.StatusOK, iam.TokenResponse{
+		AccessToken:     token.AccessToken,
+		TokenType:       tokenType,
+		ExpiresIn:       token.ExpiresIn,
+		Scope:           strings.Join(token.Scope, " "),
+		IdentityToken:   token.IdentityToken,
+		RefreshToken:    token.RefreshToken,
+		IssuedTokenType: token.IssuedTokenType,
 	})
 }
 
+// exchangeParameters checks the parameters of a token exchange, see RFC 8693 section 2.1. Access tokens of
+// this service are exchanged for access tokens, the authenticated client being the actor.
+func exchangeParameters(v url.Values) error {
+	if len(v.Get(iam.SubjectTokenKey)) == 0 {
+		return errors.New(iam.SubjectTokenKey + " is missing")
+	}
+	switch v.Get(iam.SubjectTokenTypeKey) {
+	case models.TokenTypeAccessToken, models.TokenTypeJWT:
+	default:
+		return errors.New(iam.SubjectTokenTypeKey + " must be an access token")
+	}
+	switch v.Get(iam.RequestedTokenTypeKey) {
+	case "", models.TokenTypeAccessToken, models.TokenTypeJWT:
+	default:
+		return errors.New(iam.RequestedTokenTypeKey + " must be an access token")
+	}
+	if v.Has(iam.ActorTokenKey) {
+		return errors.New(iam.ActorTokenKey + " is not supported, the client is the actor")
+	}
+	return nil
+}
+
+// clientAuthentication holds the credentials a client authenticates with.
+type clientAuthentication struct {
+	ID     string
+	Secret string
+	// Assertion is the signed JWT of private_key_jwt authentication, which tells the client id when ID is empty.
+	Assertion string
+	// Certificate is the verified TLS client certificate, if any, authenticating clients of tls_client_auth.
+	Certificate *x509.Certificate
+}
+
+// missing tells whether the client gave no credentials.
+func (a clientAuthentication) missing() bool {
+	return len(a.Assertion) == 0 && (len(a.ID) == 0 || (len(a.Secret) == 0 && a.Certificate == nil))
+}
+
+// clientCertificate returns the verified TLS client certificate of the request, nil when none was presented. For
+// requests of trusted proxies it is the certificate they forward, not their own.
+func (cl *Client) clientCertificate(r *http.Request) *x509.Certificate {
+	if cl.forwarded != nil && cl.forwarded.trusts(r) {
+		cert, err := cl.forwarded.certificate(r)
+		if err != nil {
+			logger.FromContext(r.Context()).Sugar().Errorw("Invalid forwarded client certificate", zap.Error(err))
+		}
+		return cert
+	}
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
+// clientCredentials returns the client credentials of the token request, from HTTP Basic authentication
+// (client_secret_basic), the body (client_secret_post) or a client assertion (private_key_jwt). Using more
+// than one is an error. The TLS client certificate (tls_client_auth) is passed along with any of them.
+func (cl *Client) clientCredentials(r *http.Request, v url.Values) (clientAuthentication, error) {
+	auth, err := clientSecretOrAssertion(r, v)
+	auth.Certificate = cl.clientCertificate(r)
+	return auth, err
+}
+
+// clientSecretOrAssertion returns the client id along with the client secret or the client assertion.
+func clientSecretOrAssertion(r *http.Request, v url.Values) (clientAuthentication, error) {
+	user, password, ok := r.BasicAuth()
+	if v.Has(iam.ClientAssertionKey) || v.Has(iam.ClientAssertionTypeKey) {
+		if ok || v.Has(iam.ClientSecretKey) {
+			return clientAuthentication{}, errors.New("client authenticated with more than one method")
+		}
+		if v.Get(iam.ClientAssertionTypeKey) != iam.ClientAssertionTypeJWTBearer {
+			return clientAuthentication{}, errors.New(iam.ClientAssertionTypeKey + " must be " + iam.ClientAssertionTypeJWTBearer)
+		}
+		if len(v.Get(iam.ClientAssertionKey)) == 0 {
+			return clientAuthentication{}, errors.New(iam.ClientAssertionKey + " is missing")
+		}
+		return clientAuthentication{ID: v.Get(iam.ClientIDKey), Assertion: v.Get(iam.ClientAssertionKey)}, nil
+	}
+	if !ok {
+		return clientAuthentication{ID: v.Get(iam.ClientIDKey), Secret: v.Get(iam.ClientSecretKey)}, nil
+	}
+	if v.Has(iam.ClientSecretKey) {
+		return clientAuthentication{}, errors.New("client authenticated with more than one method")
+	}
+	// the credentials are form encoded before they are put in the header, see RFC 6749 section 2.3.1
+	clientID, err := url.QueryUnescape(user)
+	if err != nil {
+		return clientAuthentication{}, fmt.Errorf("client id is not form encoded: %w", err)
+	}
+	clientSecret, err := url.QueryUnescape(password)
+	if err != nil {
+		return clientAuthentication{}, fmt.Errorf("client secret is not form encoded: %w", err)
+	}
+	if v.Has(iam.ClientIDKey) && v.Get(iam.ClientIDKey) != clientID {
+		return clientAuthentication{}, errors.New("client id of the body does not match the authentication")
+	}
+	return clientAuthentication{ID: clientID, Secret: clientSecret}, nil
+}
+
+// tokenErrorCode returns the status and the RFC 6749 error code of a failed request about a token.
+func tokenErrorCode(err error) (int, string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidCredentials):
+		return http.StatusUnauthorized, iam.ErrorCodeInvalidClient
+	case errors.Is(err, service.ErrInvalidGrant):
+		return http.StatusBadRequest, iam.ErrorCodeInvalidGrant
+	case errors.Is(err, service.ErrInvalidSubjectToken), errors.Is(err, service.ErrCertificateRequired),
+		errors.Is(err, service.ErrDPoPProofRequired):
+		return http.StatusBadRequest, iam.ErrorCodeInvalidRequest
+	case errors.Is(err, service.ErrInvalidDPoPProof):
+		return http.StatusBadRequest, iam.ErrorCodeInvalidDPoPProof
+	case errors.Is(err, service.ErrDPoPNonceRequired):
+		return http.StatusBadRequest, iam.ErrorCodeUseDPoPNonce
+	case errors.Is(err, service.ErrUnsupportedGrantType):
+		return http.StatusBadRequest, iam.ErrorCodeUnsupportedGrantType
+	case errors.Is(err, service.ErrGrantTypeNotAllowed):
+		return http.StatusBadRequest, iam.ErrorCodeUnauthorizedClient
+	case errors.Is(err, service.ErrScopeNotAllowed):
+		return http.StatusBadRequest, iam.ErrorCodeInvalidScope
+	case errors.Is(err, service.ErrAudienceNotAllowed):
+		return http.StatusBadRequest, iam.ErrorCodeInvalidTarget
+	case errors.Is(err, service.ErrTokenNotIssuedToClient):
+		return http.StatusBadRequest, iam.ErrorCodeUnauthorizedClient
+	case errors.Is(err, service.ErrBusy):
+		return http.StatusServiceUnavailable, iam.ErrorCodeTemporarilyUnavailable
+	}
+	return http.StatusInternalServerError, iam.ErrorCodeServerError
+}
+
+// tokenError responds with the error of a token request. The legacy mode responds with the bare status,
+// unauthorized for any refused request.
+func (cl *Client) tokenError(c *gin.Context, status int, code, description string) {
+	if cl.cfg.IAM.LegacyTokenEndpoint {
+		if code != iam.ErrorCodeInvalidRequest && code != iam.ErrorCodeUnsupportedGrantType &&
+			code != iam.ErrorCodeTemporarilyUnavailable {
+			status = http.StatusUnauthorized
+		}
+		c.AbortWithStatus(status)
+		return
+	}
+	oauthError(c, status, code, description)
+}
+
+// formValue returns the parameter of the form body, falling back to the query string.
+func formValue(c *gin.Context, key string) string {
+	if v, ok := c.GetPostForm(key); ok {
+		return v
+	}
+	return c.Query(key)
+}
+
+// oauthError responds with an error as in RFC 6749 section 5.2, challenging clients that failed HTTP Basic
+// authentication.
+func oauthError(c *gin.Context, status int, code, description string) {
+	if code == iam.ErrorCodeInvalidClient {
+		if _, _, basic := c.Request.BasicAuth(); basic {
+			c.Header("WWW-Authenticate", `Basic realm="`+config.ServiceName+`"`)
+		}
+	}
+	c.Header("Cache-Control", "no-store")
+	c.AbortWithStatusJSON(status, iam.TokenError{Error: code, ErrorDescription: description})
+}
+
 // swagger:route POST /oauth2/validate validate
 //
-// Responds with an error if the token is not valid.
+// Responds with an error if the token is not a valid access token.
+// Identity tokens are rejected. When an audience is given in the Audience header or the audience
+// parameter, tokens not intended for it are rejected as well. When space-delimited scopes are given in
+// the Scope header or the scope parameter, tokens lacking any of them are forbidden. Tokens bound to a
+// client certificate are rejected unless the request presents that certificate, see RFC 8705. Tokens
+// bound to a DPoP key are rejected unless the DPoP header has a proof of that key for the request, see
+// RFC 9449, where gateways among the trusted proxies give the original request in X-Forwarded-Method and
+// X-Forwarded-Uri.
 //
 //		Responses:
 //		  200:
 //	      400:
 //	      401:
+//	      403:
 func (cl *Client) Validate(c *gin.Context) {
 	log := logger.FromContext(c.Request.Context()).Sugar()
 	token, err := jwt.ExtractAccessToken(c.Request)
@@ -121,19 +415,238 @@ func (cl *Client) Validate(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	_, err = cl.cfg.Service.ParseToken(token)
+	audience := c.GetHeader(jwt.AudienceHeaderKey)
+	if len(audience) == 0 {
+		audience = formValue(c, iam.AudienceKey)
+	}
+	scope := c.GetHeader(jwt.ScopeHeaderKey)
+	if len(scope) == 0 {
+		scope = formValue(c, iam.ScopeKey)
+	}
+	proof, err := cl.dpopProof(c.Request)
+	if err != nil {
+		log.Errorw("Invalid DPoP proof", zap.Error(err))
+		c.Header("WWW-Authenticate", `DPoP error="`+iam.ErrorCodeInvalidDPoPProof+`"`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	req := models.ValidationRequest{Token: token, Audience: audience, ClientCertificate: cl.clientCertificate(c.Request), DPoP: proof}
+	if scopes := strings.Fields(scope); len(scopes) > 0 {
+		req.Scope = scopes
+	}
+	err = cl.cfg.Service.ValidateToken(c.Request.Context(), req)
+	if errors.Is(err, service.ErrInsufficientScope) {
+		log.Errorw("Token lacks the required scope", zap.Error(err))
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		log.Errorw("Failed to validate token", zap.Error(err))
+		cl.dpopChallenge(c, err)
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 	c.JSON(http.StatusOK, nil)
 }
 
+// swagger:route POST /oauth2/introspect introspect
+//
+// Responds with the description of a token, see RFC 7662.
+// The token parameter of the application/x-www-form-urlencoded body is introspected. Clients authenticate
+// as on the token endpoint. Only access tokens of this service are active, any other token is described
+// as inactive. When the DPoP header has a proof, tokens bound to a DPoP key are inactive unless it is a
+// proof of that key for the request, see RFC 9449.
+//
+//		Consumes:
+//		- application/x-www-form-urlencoded
+//
+//		Produces:
+//		- application/json
+//
+//		Responses:
+//		  200: body:introspection
+//	      400: body:tokenError
+//	      401: body:tokenError
+//	      500: body:tokenError
+//	      503: body:tokenError
+//
+// Example: $ curl -u "<your-client-id>:<your-client-secret>" -d "token=<access-token>" https://<domain>/iam/v1/oauth2/introspect
+func (cl *Client) Introspect(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context()).Sugar()
+
+	v, auth, ok := cl.tokenForm(c)
+	if !ok {
+		return
+	}
+	proof, err := cl.dpopProof(c.Request)
+	if err != nil {
+		log.Errorw("Invalid DPoP proof", zap.Error(err))
+		oauthError(c, http.StatusBadRequest, iam.ErrorCodeInvalidDPoPProof, err.Error())
+		return
+	}
+
+	introspection, err := cl.cfg.Service.IntrospectToken(c.Request.Context(), models.IntrospectionRequest{
+		ClientID:          auth.ID,
+		ClientSecret:      auth.Secret,
+		ClientAssertion:   auth.Assertion,
+		ClientCertificate: auth.Certificate,
+		Token:             v.Get(iam.TokenKey),
+		TokenTypeHint:     v.Get(iam.TokenTypeHintKey),
+		DPoP:              proof,
+	})
+	if err != nil {
+		log.Errorw("Failed to introspect token", zap.Error(err), zap.String("client-id", auth.ID))
+		if errors.Is(err, service.ErrDPoPNonceRequired) {
+			cl.setDPoPNonce(c)
+		}
+		status, code := tokenErrorCode(err)
+		oauthError(c, status, code, "")
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, toIntrospection(introspection))
+}
+
+// swagger:route POST /oauth2/revoke revoke
+//
+// Revokes a token, see RFC 7009.
+// The token parameter of the application/x-www-form-urlencoded body is revoked until it expires. Clients
+// authenticate as on the token endpoint and revoke the access and identity tokens issued to them, clients
+// allowed the iam:admin scope any token. Invalid tokens are ignored. Revoking a refresh token revokes the
+// tokens refreshed from the same grant.
+//
+//		Consumes:
+//		- application/x-www-form-urlencoded
+//
+//		Responses:
+//		  200:
+//	      400: body:tokenError
+//	      401: body:tokenError
+//	      500: body:tokenError
+//	      503: body:tokenError
+//
+// Example: $ curl -u "<your-client-id>:<your-client-secret>" -d "token=<access-token>" https://<domain>/iam/v1/oauth2/revoke
+func (cl *Client) Revoke(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context()).Sugar()
+
+	v, auth, ok := cl.tokenForm(c)
+	if !ok {
+		return
+	}
+
+	err := cl.cfg.Service.RevokeToken(c.Request.Context(), models.RevocationRequest{
+		ClientID:          auth.ID,
+		ClientSecret:      auth.Secret,
+		ClientAssertion:   auth.Assertion,
+		ClientCertificate: auth.Certificate,
+		Token:             v.Get(iam.TokenKey),
+		TokenTypeHint:     v.Get(iam.TokenTypeHintKey),
+	})
+	if err != nil {
+		log.Errorw("Failed to revoke token", zap.Error(err), zap.String("client-id", auth.ID))
+		status, code := tokenErrorCode(err)
+		oauthError(c, status, code, "")
+		return
+	}
+	log.Infow("Revoked token", zap.String("client-id", auth.ID))
+	c.Status(http.StatusOK)
+}
+
+// tokenForm parses the form of a request about a token, authenticating the client. It responds with an
+// error when the request is malformed or the client credentials or the token are missing.
+func (cl *Client) tokenForm(c *gin.Context) (url.Values, clientAuthentication, bool) {
+	log := logger.FromContext(c.Request.Context()).Sugar()
+
+	if c.ContentType() != formContentType {
+		log.Errorw("Unsupported content type", zap.String("content-type", c.ContentType()))
+		oauthError(c, http.StatusBadRequest, iam.ErrorCodeInvalidRequest, "content type must be "+formContentType)
+		return nil, clientAuthentication{}, false
+	}
+	if err := c.Request.ParseForm(); err != nil {
+		log.Errorw("Failed to parse data", zap.Error(err))
+		oauthError(c, http.StatusBadRequest, iam.ErrorCodeInvalidRequest, "body is not form encoded")
+		return nil, clientAuthentication{}, false
+	}
+	v := c.Request.PostForm
+
+	auth, err := cl.clientCredentials(c.Request, v)
+	if err != nil {
+		log.Errorw("Invalid client authentication", zap.Error(err))
+		oauthError(c, http.StatusBadRequest, iam.ErrorCodeInvalidRequest, err.Error())
+		return nil, clientAuthentication{}, false
+	}
+	if auth.missing() {
+		log.Errorw("client credentials are missing")
+		oauthError(c, http.StatusUnauthorized, iam.ErrorCodeInvalidClient, "client authentication is missing")
+		return nil, clientAuthentication{}, false
+	}
+	if len(v.Get(iam.TokenKey)) == 0 {
+		log.Errorw("token is missing")
+		oauthError(c, http.StatusBadRequest, iam.ErrorCodeInvalidRequest, iam.TokenKey+" is missing")
+		return nil, clientAuthentication{}, false
+	}
+	return v, auth, true
+}
+
+// toIntrospection converts the description of a token to its response.
+func toIntrospection(in models.Introspection) iam.Introspection {
+	if !in.Active {
+		return iam.Introspection{}
+	}
+	return iam.Introspection{
+		Active:       true,
+		Scope:        strings.Join(in.Scope, " "),
+		ClientID:     in.ClientID,
+		Subject:      in.Subject,
+		Audience:     in.Audience,
+		Issuer:       in.Issuer,
+		ExpiresAt:    unixTime(in.ExpiresAt),
+		IssuedAt:     unixTime(in.IssuedAt),
+		NotBefore:    unixTime(in.NotBefore),
+		JWTID:        in.JWTID,
+		TokenType:    introspectionTokenType(in.Confirmation),
+		Actor:        toActor(in.Actor),
+		Confirmation: toConfirmation(in.Confirmation),
+	}
+}
+
+// introspectionTokenType returns DPoP for tokens bound to a DPoP key, Bearer otherwise.
+func introspectionTokenType(cnf *models.Confirmation) string {
+	if cnf != nil && len(cnf.JWKThumbprint) > 0 {
+		return "DPoP"
+	}
+	return "Bearer"
+}
+
+// toConfirmation returns the key a bound token is bound to, nil for bearer tokens.
+func toConfirmation(in *models.Confirmation) *iam.Confirmation {
+	if in == nil {
+		return nil
+	}
+	return &iam.Confirmation{X509Thumbprint: in.X509Thumbprint, JWKThumbprint: in.JWKThumbprint}
+}
+
+// toActor returns the chain of actors of an exchanged token, nil for other tokens.
+func toActor(in *models.Actor) *iam.Actor {
+	if in == nil {
+		return nil
+	}
+	return &iam.Actor{Subject: in.Subject, ClientID: in.ClientID, Actor: toActor(in.Actor)}
+}
+
+// unixTime returns the seconds since the epoch, zero for the zero time.
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
 // swagger:route POST /oauth2/identity identity
 //
 // Responds with the subject embedded in the token claims, if there is one.
-// If the token is invalid, an error is returned.
+// If the token is not a valid identity token, an error is returned.
 //
 //		Produces:
 //		- application/json
@@ -150,7 +663,7 @@ func (cl *Client) Identity(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	sub, err := cl.cfg.Service.ParseToken(token)
+	sub, err := cl.cfg.Service.ParseToken(c.Request.Context(), token, models.TokenUseIdentity, "")
 	if err != nil {
 		log.Errorw("Failed to validate token", zap.Error(err))
 		c.AbortWithStatus(http.StatusUnauthorized)
@@ -165,3 +678,157 @@ func (cl *Client) Identity(c *gin.Context) {
 		Identity: sub,
 	})
 }
+
+// swagger:route GET /.well-known/jwks.json jwks
+//
+// Responds with the public keys that verify the issued tokens, as a JSON Web Key Set.
+// The set is empty when tokens are signed with a shared secret.
+//
+//		Produces:
+//		- application/json
+//
+//		Responses:
+//		  200: body:jwks
+//	      500:
+func (cl *Client) JWKS(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context()).Sugar()
+	set, err := cl.cfg.Service.JWKS(c.Request.Context())
+	if err != nil {
+		log.Errorw("Failed to get verification keys", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksMaxAge.Seconds())))
+	c.JSON(http.StatusOK, set)
+}
+
+// swagger:route GET /.well-known/oauth-authorization-server metadata
+//
+// Responds with the authorization server metadata, see RFC 8414.
+// It lists the endpoints of the service, the supported grant types, client authentication methods and signing
+// algorithms. The same document is served at /.well-known/oauth-authorization-server/iam/v1 on the root path.
+// It is not found unless the public URL of the service is configured, as the issuer must be an https URL.
+//
+//		Produces:
+//		- application/json
+//
+//		Responses:
+//		  200: body:metadata
+//	      404:
+//	      500:
+func (cl *Client) Metadata(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context()).Sugar()
+	metadata, err := cl.cfg.Service.Metadata(c.Request.Context())
+	if errors.Is(err, service.ErrNoIssuerURL) {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorw("Failed to get server metadata", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksMaxAge.Seconds())))
+	c.JSON(http.StatusOK, toMetadata(cl.serviceURL(c.Request), metadata))
+}
+
+// serviceURL returns the URL of the service, under the configured public URL or else the URL of the request.
+func (cl *Client) serviceURL(r *http.Request) string {
+	return cl.baseURL(r) + paths.PathPrefix
+}
+
+// baseURL returns the configured public URL, or else the scheme and host of the request.
+func (cl *Client) baseURL(r *http.Request) string {
+	if base := strings.TrimSuffix(cl.cfg.IAM.PublicURL, "/"); len(base) > 0 {
+		return base
+	}
+	return cl.requestScheme(r) + "://" + r.Host
+}
+
+// requestScheme returns https for requests over TLS, or forwarded from HTTPS by a trusted proxy, http otherwise.
+func (cl *Client) requestScheme(r *http.Request) string {
+	if r.TLS != nil || (cl.proxies.trusts(r) && r.Header.Get("X-Forwarded-Proto") == "https") {
+		return "https"
+	}
+	return "http"
+}
+
+// toMetadata returns the server metadata with the endpoints under the service URL. The issuer is the iss claim of
+// the tokens, see RFC 8414 section 3.3.
+func toMetadata(serviceURL string, in models.Metadata) iam.Metadata {
+	return iam.Metadata{
+		Issuer:                                in.Issuer,
+		TokenEndpoint:                         serviceURL + "/" + paths.OAuthToken,
+		IntrospectionEndpoint:                 serviceURL + "/" + paths.Introspect,
+		RevocationEndpoint:                    serviceURL + "/" + paths.Revoke,
+		JWKSURI:                               serviceURL + "/" + paths.JWKS,
+		ResponseTypes:                         []string{},
+		GrantTypes:                            in.GrantTypes,
+		TokenEndpointAuthMethods:              in.AuthMethods,
+		TokenEndpointAuthSigningAlgs:          in.AssertionSigningAlgs,
+		IntrospectionEndpointAuthMethods:      in.AuthMethods,
+		IntrospectionEndpointAuthSigningAlgs:  in.AssertionSigningAlgs,
+		RevocationEndpointAuthMethods:         in.AuthMethods,
+		RevocationEndpointAuthSigningAlgs:     in.AssertionSigningAlgs,
+		AccessTokenSigningAlgs:                in.TokenSigningAlgs,
+		DPoPSigningAlgs:                       in.DPoPSigningAlgs,
+		TLSClientCertificateBoundAccessTokens: in.CertificateBoundAccessTokens,
+	}
+}
+
+// dpopProof returns the DPoP proof of the request along with the method and URL it must be made for, see
+// RFC 9449. Gateways validating the tokens of their callers tell the method and the URI called in the
+// X-Forwarded-Method and X-Forwarded-Uri headers, under X-Forwarded-Proto and X-Forwarded-Host, which are only
+// read from trusted proxies. It is empty for requests without a proof.
+func (cl *Client) dpopProof(r *http.Request) (models.DPoPProof, error) {
+	proofs := r.Header.Values(jwt.DPoPHeaderKey)
+	switch len(proofs) {
+	case 0:
+		return models.DPoPProof{}, nil
+	case 1:
+	default:
+		return models.DPoPProof{}, errors.New("more than one DPoP proof")
+	}
+	proof := models.DPoPProof{Proof: proofs[0], Method: r.Method, URL: cl.baseURL(r) + r.URL.EscapedPath()}
+	if !cl.proxies.trusts(r) {
+		return proof, nil
+	}
+	if uri := r.Header.Get("X-Forwarded-Uri"); len(uri) > 0 {
+		host := r.Header.Get("X-Forwarded-Host")
+		if len(host) == 0 {
+			host = r.Host
+		}
+		proof.URL = cl.requestScheme(r) + "://" + host + uri
+	}
+	if method := r.Header.Get("X-Forwarded-Method"); len(method) > 0 {
+		proof.Method = method
+	}
+	return proof, nil
+}
+
+// setDPoPNonce tells the client the nonce to put in its next DPoP proof, see RFC 9449 section 8.
+func (cl *Client) setDPoPNonce(c *gin.Context) {
+	nonce, err := cl.cfg.Service.DPoPNonce(c.Request.Context())
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Sugar().Errorw("Failed to issue DPoP nonce", zap.Error(err))
+		return
+	}
+	if len(nonce) > 0 {
+		c.Header(jwt.DPoPNonceHeaderKey, nonce)
+	}
+}
+
+// dpopChallenge challenges the client of a DPoP-bound token whose proof failed, see RFC 9449 section 7.1.
+func (cl *Client) dpopChallenge(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrDPoPNonceRequired):
+		cl.setDPoPNonce(c)
+		c.Header("WWW-Authenticate", `DPoP error="`+iam.ErrorCodeUseDPoPNonce+`"`)
+	case errors.Is(err, service.ErrInvalidDPoPProof):
+		c.Header("WWW-Authenticate", `DPoP error="`+iam.ErrorCodeInvalidDPoPProof+`"`)
+	case errors.Is(err, service.ErrDPoPProofRequired):
+		c.Header("WWW-Authenticate", `DPoP error="invalid_token"`)
+	}
+}
@@ -29,6 +29,7 @@
 	"github.com/ingka-group/iam-proxy/client/jwt"
 	"github.com/ingka-group/iam-proxy/client/paths"
 	"github.com/ingka-group/iam-proxy/internal/config"
+	"github.com/ingka-group/iam-proxy/internal/models"
 	"github.com/ingka-group/iam-proxy/internal/service"
 	"github.com/ingka-group/iam-proxy/internal/testutil"
 )
@@ -73,7 +74,7 @@ type args struct {
 			},
 			body:       "client_secret=<client_secret>&grant_type=client_credentials",
 			parsingErr: true,
-			wantCode:   400,
+			wantCode:   401,
 		},
 		{
 			name: "client_secret_missing",
@@ -92,7 +93,7 @@ type args struct {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			srv, err := service.New(defaultConfig(tt.iam))
+			srv, err := service.New(context.TODO(), defaultConfig(tt.iam))
 			if err != nil {
 				t.Errorf("could not create service instance: %s", err.Error())
 			}
@@ -104,7 +105,7 @@ type args struct {
 				return
 			}
 
-			resp, err := doRequest("POST", paths.FullPath(paths.OAuthToken), []byte(tt.body), map[string]string{}, c)
+			resp, err := doRequest("POST", paths.FullPath(paths.OAuthToken), []byte(tt.body), formHeader, c)
 			if err != nil {
 				t.Error("Failed to perform request", err)
 			}
@@ -191,7 +192,7 @@ type args struct {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			srv, err := service.New(defaultConfig(tt.iam))
+			srv, err := service.New(context.TODO(), defaultConfig(tt.iam))
 			if err != nil {
 				t.Errorf("could not create service instance: %s", err.Error())
 			}
@@ -304,7 +305,7 @@ type args struct {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			srv, err := service.New(defaultConfig(tt.iam))
+			srv, err := service.New(context.TODO(), defaultConfig(tt.iam))
 			if err != nil {
 				t.Errorf("could not create service instance: %s", err.Error())
 			}
@@ -318,7 +319,8 @@ type args struct {
 
 			if tt.header == nil {
 				// generate an identity token
-				_, id, _, err := srv.GenerateToken(context.TODO(), "<client_id>", "<client_secret>")
+				issued, err := srv.GenerateToken(context.TODO(), models.TokenRequest{ClientID: "<client_id>", ClientSecret: "<client_secret>"})
+				id := issued.IdentityToken
 				assert.NoError(t, err)
 				tt.header = map[string]string{
 					clienthttp.IdentityHeaderKey: fmt.Sprintf("%s %s", clienthttp.IdentityHeaderKey, id),
@@ -350,10 +352,10 @@ type args struct {
 
 func TestClient_End2End(t *testing.T) {
 	cfg := config.IAM{
-		Users: jwt.Base64Encode([]byte(`{"<client_id>" : { "client_secret" : "<client_secret>" , "app_name" : "<ocp>" } }`)),
+		Users: jwt.Base64Encode([]byte(`{"<client_id>" : { "client_secret" : "<client_secret>" , "app_name" : "<ocp>" , "grant_types" : ["client_credentials", "refresh_token"] } }`)),
 	}
 
-	srv, err := service.New(defaultConfig(cfg))
+	srv, err := service.New(context.TODO(), defaultConfig(cfg))
 	if err != nil {
 		t.Errorf("could not create service instance: %s", err.Error())
 	}
@@ -365,12 +367,12 @@ func TestClient_End2End(t *testing.T) {
 	assert.NoError(t, err)
 
 	// generate the token
-	resp, err := doRequest("POST", paths.FullPath(paths.OAuthToken), []byte("client_id=<client_id>&client_secret=<client_secret>&grant_type=client_credentials"), map[string]string{}, c)
+	resp, err := doRequest("POST", paths.FullPath(paths.OAuthToken), []byte("client_id=<client_id>&client_secret=<client_secret>&grant_type=client_credentials"), formHeader, c)
 	if err != nil {
 		t.Error("Failed to perform `generate token` request", err)
 	}
 
-	token := new(iam.Token)
+	token := new(iam.TokenResponse)
 
 	if resp.Code == http.StatusOK {
 		bodyBytes, err := io.ReadAll(resp.Body)
@@ -390,6 +392,79 @@ func TestClient_End2End(t *testing.T) {
 	}
 
 	assert.Equal(t, resp.Code, http.StatusOK)
+
+	// the identity token is not an access token
+	resp, err = doRequest("POST", paths.FullPath(paths.ValidateToken), nil, map[string]string{
+		clienthttp.AuthorizationHeaderKey: fmt.Sprintf("Authorization %s", token.IdentityToken),
+	}, c)
+	if err != nil {
+		t.Error("Failed to perform `validate token` request", err)
+	}
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	// and the access token is not an identity token
+	resp, err = doRequest("POST", paths.FullPath(paths.Identity), nil, map[string]string{
+		clienthttp.IdentityHeaderKey: fmt.Sprintf("%s %s", clienthttp.IdentityHeaderKey, token.AccessToken),
+	}, c)
+	if err != nil {
+		t.Error("Failed to perform `identity` request", err)
+	}
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	// the access token is introspected by an authenticated client
+	resp, err = doRequest("POST", paths.FullPath(paths.Introspect), []byte("client_id=<client_id>&client_secret=<client_secret>&token="+token.AccessToken), formHeader, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	introspection := new(iam.Introspection)
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), introspection))
+	assert.True(t, introspection.Active)
+	assert.Equal(t, "<client_id>", introspection.ClientID)
+	assert.Equal(t, "<ocp>", introspection.Subject)
+
+	// and the identity token is inactive
+	resp, err = doRequest("POST", paths.FullPath(paths.Introspect), []byte("client_id=<client_id>&client_secret=<client_secret>&token="+token.IdentityToken), formHeader, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"active":false}`, resp.Body.String())
+
+	// once revoked, the access token is neither valid nor active
+	resp, err = doRequest("POST", paths.FullPath(paths.Revoke), []byte("client_id=<client_id>&client_secret=<client_secret>&token="+token.AccessToken), formHeader, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp, err = doRequest("POST", paths.FullPath(paths.ValidateToken), nil, map[string]string{
+		clienthttp.AuthorizationHeaderKey: fmt.Sprintf("Authorization %s", token.AccessToken),
+	}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	resp, err = doRequest("POST", paths.FullPath(paths.Introspect), []byte("client_id=<client_id>&client_secret=<client_secret>&token="+token.AccessToken), formHeader, c)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"active":false}`, resp.Body.String())
+
+	// the refresh token obtains new tokens once
+	assert.NotEmpty(t, token.RefreshToken)
+	refreshBody := []byte("client_id=<client_id>&client_secret=<client_secret>&grant_type=refresh_token&refresh_token=" + token.RefreshToken)
+	resp, err = doRequest("POST", paths.FullPath(paths.OAuthToken), refreshBody, formHeader, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	refreshed := new(iam.TokenResponse)
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), refreshed))
+	assert.NotEqual(t, token.RefreshToken, refreshed.RefreshToken)
+	resp, err = doRequest("POST", paths.FullPath(paths.ValidateToken), nil, map[string]string{
+		clienthttp.AuthorizationHeaderKey: fmt.Sprintf("Authorization %s", refreshed.AccessToken),
+	}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// reusing it revokes the tokens refreshed with it
+	resp, err = doRequest("POST", paths.FullPath(paths.OAuthToken), refreshBody, formHeader, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.JSONEq(t, `{"error":"invalid_grant"}`, resp.Body.String())
+	resp, err = doRequest("POST", paths.FullPath(paths.ValidateToken), nil, map[string]string{
+		clienthttp.AuthorizationHeaderKey: fmt.Sprintf("Authorization %s", refreshed.AccessToken),
+	}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
 }
 
 func defaultConfig(iam config.IAM) service.Config {
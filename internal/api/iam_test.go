@@ -15,18 +15,331 @@
 package api
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
 
 	clienthttp "github.com/ingka-group/iam-proxy/client/http"
+	"github.com/ingka-group/iam-proxy/client/iam"
+	"github.com/ingka-group/iam-proxy/client/jwk"
 	"github.com/ingka-group/iam-proxy/client/paths"
+	"github.com/ingka-group/iam-proxy/internal/models"
+	"github.com/ingka-group/iam-proxy/internal/service"
 	"github.com/ingka-group/iam-proxy/internal/service/mock_service"
 	"github.com/ingka-group/iam-proxy/internal/testutil"
 )
 
+// formHeader is the header of token requests.
+var formHeader = map[string]string{"Content-Type": formContentType}
+
 func TestClient_Generate(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	basic := map[string]string{
+		"Content-Type":  formContentType,
+		"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("%3Cyour-client-id%3E:%3Cyour-client-secret%3E")),
+	}
+	tests := []struct {
+		name   string
+		legacy bool
+		header map[string]string
+		body   string
+		// req is the expected request of the service, none is expected when empty
+		req       models.TokenRequest
+		genErr    error
+		wantCode  int
+		wantError string
+	}{
+		{
+			name:     "token",
+			body:     "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials",
+			req:      models.TokenRequest{GrantType: models.GrantTypeClientCredentials, ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>"},
+			wantCode: 200,
+		},
+		{
+			name:     "token_basic",
+			header:   basic,
+			body:     "grant_type=client_credentials",
+			req:      models.TokenRequest{GrantType: models.GrantTypeClientCredentials, ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>"},
+			wantCode: 200,
+		},
+		{
+			name:      "token_basic_and_post",
+			header:    basic,
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials",
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+		{
+			name:     "token_expires_in",
+			body:     "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials&expires_in=300",
+			req:      models.TokenRequest{GrantType: models.GrantTypeClientCredentials, ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", ExpiresIn: 5 * time.Minute},
+			wantCode: 200,
+		},
+		{
+			name:     "token_audience",
+			body:     "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials&audience=billing&audience=orders",
+			req:      models.TokenRequest{GrantType: models.GrantTypeClientCredentials, ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", Audience: []string{"billing", "orders"}},
+			wantCode: 200,
+		},
+		{
+			name:     "token_scope",
+			body:     "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials&scope=read%20write",
+			req:      models.TokenRequest{GrantType: models.GrantTypeClientCredentials, ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", Scope: []string{"read", "write"}},
+			wantCode: 200,
+		},
+		{
+			name:     "token_refresh",
+			body:     "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=refresh_token&refresh_token=<refresh-token>",
+			req:      models.TokenRequest{GrantType: models.GrantTypeRefreshToken, ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", RefreshToken: "<refresh-token>"},
+			wantCode: 200,
+		},
+		{
+			name:      "refresh_token_missing",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=refresh_token",
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+		{
+			name:      "refresh_token_invalid",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=refresh_token&refresh_token=<refresh-token>",
+			req:       models.TokenRequest{GrantType: models.GrantTypeRefreshToken, ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", RefreshToken: "<refresh-token>"},
+			genErr:    fmt.Errorf("%w: %w", service.ErrInvalidGrant, service.ErrTokenNotIssuedToClient),
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidGrant,
+		},
+		{
+			name:     "token_exchange",
+			body:     "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=urn%3Aietf%3Aparams%3Aoauth%3Agrant-type%3Atoken-exchange&subject_token=<subject-token>&subject_token_type=urn%3Aietf%3Aparams%3Aoauth%3Atoken-type%3Aaccess_token&audience=stock",
+			req:      models.TokenRequest{GrantType: models.GrantTypeTokenExchange, ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", SubjectToken: "<subject-token>", Audience: []string{"stock"}},
+			wantCode: 200,
+		},
+		{
+			name:      "subject_token_missing",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=urn%3Aietf%3Aparams%3Aoauth%3Agrant-type%3Atoken-exchange&subject_token_type=urn%3Aietf%3Aparams%3Aoauth%3Atoken-type%3Aaccess_token",
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+		{
+			name:      "subject_token_type_unsupported",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=urn%3Aietf%3Aparams%3Aoauth%3Agrant-type%3Atoken-exchange&subject_token=<subject-token>&subject_token_type=urn%3Aietf%3Aparams%3Aoauth%3Atoken-type%3Asaml2",
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+		{
+			name:      "actor_token_unsupported",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=urn%3Aietf%3Aparams%3Aoauth%3Agrant-type%3Atoken-exchange&subject_token=<subject-token>&subject_token_type=urn%3Aietf%3Aparams%3Aoauth%3Atoken-type%3Aaccess_token&actor_token=<actor-token>",
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+		{
+			name:      "subject_token_invalid",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=urn%3Aietf%3Aparams%3Aoauth%3Agrant-type%3Atoken-exchange&subject_token=<subject-token>&subject_token_type=urn%3Aietf%3Aparams%3Aoauth%3Atoken-type%3Aaccess_token&audience=stock",
+			req:       models.TokenRequest{GrantType: models.GrantTypeTokenExchange, ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", SubjectToken: "<subject-token>", Audience: []string{"stock"}},
+			genErr:    service.ErrInvalidSubjectToken,
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+		{
+			name:     "token_client_assertion",
+			body:     "client_assertion_type=urn%3Aietf%3Aparams%3Aoauth%3Aclient-assertion-type%3Ajwt-bearer&client_assertion=<client-assertion>&grant_type=client_credentials",
+			req:      models.TokenRequest{GrantType: models.GrantTypeClientCredentials, ClientAssertion: "<client-assertion>"},
+			wantCode: 200,
+		},
+		{
+			name:     "token_client_assertion_client_id",
+			body:     "client_id=<your-client-id>&client_assertion_type=urn%3Aietf%3Aparams%3Aoauth%3Aclient-assertion-type%3Ajwt-bearer&client_assertion=<client-assertion>&grant_type=client_credentials",
+			req:      models.TokenRequest{GrantType: models.GrantTypeClientCredentials, ClientID: "<your-client-id>", ClientAssertion: "<client-assertion>"},
+			wantCode: 200,
+		},
+		{
+			name:      "client_assertion_and_secret",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&client_assertion_type=urn%3Aietf%3Aparams%3Aoauth%3Aclient-assertion-type%3Ajwt-bearer&client_assertion=<client-assertion>&grant_type=client_credentials",
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+		{
+			name:      "client_assertion_and_basic",
+			header:    basic,
+			body:      "client_assertion_type=urn%3Aietf%3Aparams%3Aoauth%3Aclient-assertion-type%3Ajwt-bearer&client_assertion=<client-assertion>&grant_type=client_credentials",
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+		{
+			name:      "client_assertion_type_unsupported",
+			body:      "client_assertion_type=urn%3Aietf%3Aparams%3Aoauth%3Aclient-assertion-type%3Asaml2-bearer&client_assertion=<client-assertion>&grant_type=client_credentials",
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+		{
+			name:      "client_assertion_missing",
+			body:      "client_assertion_type=urn%3Aietf%3Aparams%3Aoauth%3Aclient-assertion-type%3Ajwt-bearer&grant_type=client_credentials",
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+		{
+			name:      "client_assertion_invalid",
+			body:      "client_assertion_type=urn%3Aietf%3Aparams%3Aoauth%3Aclient-assertion-type%3Ajwt-bearer&client_assertion=<client-assertion>&grant_type=client_credentials",
+			req:       models.TokenRequest{GrantType: models.GrantTypeClientCredentials, ClientAssertion: "<client-assertion>"},
+			genErr:    fmt.Errorf("%w: %w", service.ErrInvalidCredentials, service.ErrAssertionReplayed),
+			wantCode:  401,
+			wantError: iam.ErrorCodeInvalidClient,
+		},
+		{
+			name:      "expires_in_invalid",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials&expires_in=-5",
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+		{
+			name:      "expires_in_overflow",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials&expires_in=9223372036854775807",
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+		{
+			name:      "token_error",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials",
+			req:       models.TokenRequest{GrantType: models.GrantTypeClientCredentials, ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>"},
+			genErr:    fmt.Errorf("%w: %w", service.ErrInvalidCredentials, service.ErrSecretMismatch),
+			wantCode:  401,
+			wantError: iam.ErrorCodeInvalidClient,
+		},
+		{
+			name:      "busy",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials",
+			req:       models.TokenRequest{GrantType: models.GrantTypeClientCredentials, ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>"},
+			genErr:    service.ErrBusy,
+			wantCode:  503,
+			wantError: iam.ErrorCodeTemporarilyUnavailable,
+		},
+		{
+			name:      "busy_legacy",
+			legacy:    true,
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials",
+			req:       models.TokenRequest{GrantType: models.GrantTypeClientCredentials, ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>"},
+			genErr:    service.ErrBusy,
+			wantCode:  503,
+			wantError: iam.ErrorCodeTemporarilyUnavailable,
+		},
+		{
+			name:      "scope_not_allowed",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials&scope=write",
+			req:       models.TokenRequest{GrantType: models.GrantTypeClientCredentials, ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", Scope: []string{"write"}},
+			genErr:    service.ErrScopeNotAllowed,
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidScope,
+		},
+		{
+			name:      "server_error",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials",
+			req:       models.TokenRequest{GrantType: models.GrantTypeClientCredentials, ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>"},
+			genErr:    errors.New("some error"),
+			wantCode:  500,
+			wantError: iam.ErrorCodeServerError,
+		},
+		{
+			name:      "client_id_missing",
+			body:      "client_secret=<your-client-secret>&grant_type=client_credentials",
+			wantCode:  401,
+			wantError: iam.ErrorCodeInvalidClient,
+		},
+		{
+			name:      "grant_type_missing",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>",
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+		{
+			name:      "grant_type_unsupported",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=password",
+			wantCode:  400,
+			wantError: iam.ErrorCodeUnsupportedGrantType,
+		},
+		{
+			name:      "content_type_unsupported",
+			header:    map[string]string{"Content-Type": "text/plain"},
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials",
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+		{
+			name:     "legacy",
+			legacy:   true,
+			header:   map[string]string{"Content-Type": "text/plain"},
+			body:     "client_id=<your-client-id>&client_secret=<your-client-secret>",
+			req:      models.TokenRequest{GrantType: models.GrantTypeClientCredentials, ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>"},
+			wantCode: 200,
+		},
+		{
+			name:     "legacy_error",
+			legacy:   true,
+			body:     "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials&scope=write",
+			req:      models.TokenRequest{GrantType: models.GrantTypeClientCredentials, ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", Scope: []string{"write"}},
+			genErr:   service.ErrScopeNotAllowed,
+			wantCode: 401,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testutil.SampleConfig()
+			cfg.IAM.LegacyTokenEndpoint = tt.legacy
+			mock := mock_service.NewMockServicer(ctrl)
+			c, err := New(Config{Config: cfg, Service: mock})
+			assert.NoError(t, err)
+
+			if len(tt.req.ClientID) > 0 || len(tt.req.ClientAssertion) > 0 {
+				token := models.Token{AccessToken: "access-token", IdentityToken: "identity-token", ExpiresIn: 1, Scope: tt.req.Scope, RefreshToken: "refresh-token"}
+				mock.EXPECT().GenerateToken(gomock.Any(), gomock.Eq(tt.req)).Return(token, tt.genErr)
+			}
+			header := tt.header
+			if header == nil {
+				header = formHeader
+			}
+
+			resp, err := doRequest("POST", paths.FullPath(paths.OAuthToken), []byte(tt.body), header, c)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantCode, resp.Code)
+
+			switch {
+			case tt.legacy && resp.Code == http.StatusOK:
+				var token iam.Token
+				assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &token))
+				assert.Equal(t, "access-token", token.AccessToken)
+			case tt.legacy:
+				assert.Empty(t, resp.Body.Bytes())
+			case resp.Code == http.StatusOK:
+				var token iam.TokenResponse
+				assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &token))
+				assert.Equal(t, iam.TokenResponse{
+					AccessToken:   "access-token",
+					TokenType:     "Bearer",
+					ExpiresIn:     1,
+					Scope:         strings.Join(tt.req.Scope, " "),
+					IdentityToken: "identity-token",
+					RefreshToken:  "refresh-token",
+				}, token)
+				assert.Equal(t, "no-store", resp.Header().Get("Cache-Control"))
+			default:
+				var tokenErr iam.TokenError
+				assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &tokenErr))
+				assert.Equal(t, tt.wantError, tokenErr.Error)
+			}
+		})
+	}
+}
+
+func TestClient_Parse(t *testing.T) {
 	t.Parallel()
 	type args struct {
 		cfg  Config
@@ -39,7 +352,12 @@ type args struct {
 		wantCode   int
 		wantErr    bool
 		parsingErr bool
+		header     map[string]string
 		body       string
+		audience   string
+		scopes     []string
+		// err is the error of the service, a generic one when empty
+		err error
 	}{
 		{
 			name: "token",
@@ -49,44 +367,103 @@ type args struct {
 				},
 				mock: mock_service.NewMockServicer(ctrl),
 			},
-			body:     "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials",
+			header: map[string]string{
+				clienthttp.AuthorizationHeaderKey: "Authorization token",
+			},
 			wantCode: 200,
 		},
 		{
-			name: "token_error",
+			name: "token_audience",
 			args: args{
 				cfg: Config{
 					Config: testutil.SampleConfig(),
 				},
 				mock: mock_service.NewMockServicer(ctrl),
 			},
-			body:     "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials",
-			wantErr:  true,
-			wantCode: 401,
+			header: map[string]string{
+				clienthttp.AuthorizationHeaderKey: "Authorization token",
+				clienthttp.AudienceHeaderKey:      "billing",
+			},
+			audience: "billing",
+			wantCode: 200,
+		},
+		{
+			name: "token_audience_form",
+			args: args{
+				cfg: Config{
+					Config: testutil.SampleConfig(),
+				},
+				mock: mock_service.NewMockServicer(ctrl),
+			},
+			header: map[string]string{
+				clienthttp.AuthorizationHeaderKey: "Authorization token",
+				"Content-Type":                    formContentType,
+			},
+			body:     "audience=billing",
+			audience: "billing",
+			wantCode: 200,
+		},
+		{
+			name: "token_scope",
+			args: args{
+				cfg: Config{
+					Config: testutil.SampleConfig(),
+				},
+				mock: mock_service.NewMockServicer(ctrl),
+			},
+			header: map[string]string{
+				clienthttp.AuthorizationHeaderKey: "Authorization token",
+				clienthttp.ScopeHeaderKey:         "read write",
+			},
+			scopes:   []string{"read", "write"},
+			wantCode: 200,
+		},
+		{
+			name: "token_scope_form",
+			args: args{
+				cfg: Config{
+					Config: testutil.SampleConfig(),
+				},
+				mock: mock_service.NewMockServicer(ctrl),
+			},
+			header: map[string]string{
+				clienthttp.AuthorizationHeaderKey: "Authorization token",
+				"Content-Type":                    formContentType,
+			},
+			body:     "scope=read+write",
+			scopes:   []string{"read", "write"},
+			wantCode: 200,
 		},
 		{
-			name: "client_id_missing",
+			name: "token_error",
 			args: args{
 				cfg: Config{
 					Config: testutil.SampleConfig(),
 				},
 				mock: mock_service.NewMockServicer(ctrl),
 			},
-			body:       "client_secret=<your-client-secret>&grant_type=client_credentials",
-			parsingErr: true,
-			wantCode:   400,
+			header: map[string]string{
+				clienthttp.AuthorizationHeaderKey: "Authorization token",
+			},
+			wantErr:  true,
+			wantCode: 401,
 		},
 		{
-			name: "client_secret_missing",
+			name: "token_insufficient_scope",
 			args: args{
 				cfg: Config{
 					Config: testutil.SampleConfig(),
 				},
 				mock: mock_service.NewMockServicer(ctrl),
 			},
-			body:       "client_id=<your-client-id>",
-			parsingErr: true,
-			wantCode:   400,
+			header: map[string]string{
+				clienthttp.AuthorizationHeaderKey: "Authorization token",
+				clienthttp.ScopeHeaderKey:         "write",
+			},
+			scopes:   []string{"write"},
+			wantErr:  true,
+			err:      fmt.Errorf("%w: write", service.ErrInsufficientScope),
+			wantCode: 403,
 		},
 	}
 	for _, tt := range tests {
@@ -100,13 +477,17 @@ type args struct {
 
 			if !tt.parsingErr {
 				if tt.wantErr {
-					tt.args.mock.EXPECT().GenerateToken(gomock.Any(), gomock.Any(), gomock.Any()).Return("", "", int64(0), errors.New("some error"))
+					parseErr := tt.err
+					if parseErr == nil {
+						parseErr = errors.New("some error")
+					}
+					tt.args.mock.EXPECT().ValidateToken(gomock.Any(), models.ValidationRequest{Token: "token", Audience: tt.audience, Scope: tt.scopes}).Return(parseErr)
 				} else {
-					tt.args.mock.EXPECT().GenerateToken(gomock.Any(), gomock.Eq("<your-client-id>"), gomock.Eq("<your-client-secret>")).Return("access-token", "identity-token", int64(1), nil)
+					tt.args.mock.EXPECT().ValidateToken(gomock.Any(), models.ValidationRequest{Token: "token", Audience: tt.audience, Scope: tt.scopes}).Return(nil)
 				}
 			}
 
-			resp, err := doRequest("POST", paths.FullPath(paths.OAuthToken), []byte(tt.body), map[string]string{}, c)
+			resp, err := doRequest("POST", paths.FullPath(paths.ValidateToken), []byte(tt.body), tt.header, c)
 			if err != nil {
 				t.Error("Failed to perform request", err)
 			}
@@ -118,7 +499,224 @@ type args struct {
 	}
 }
 
-func TestClient_Parse(t *testing.T) {
+func TestClient_Introspect(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	now := time.Now().Truncate(time.Second)
+	active := models.Introspection{
+		Active:    true,
+		ClientID:  "<client-id>",
+		Subject:   "<app-name>",
+		Scope:     []string{"read", "write"},
+		Audience:  []string{"billing"},
+		Issuer:    "iam-proxy",
+		ExpiresAt: now.Add(time.Hour),
+		IssuedAt:  now,
+		NotBefore: now,
+		JWTID:     "<jti>",
+	}
+	tests := []struct {
+		name   string
+		header map[string]string
+		body   string
+		// req is the expected request of the service, none is expected when empty
+		req           models.IntrospectionRequest
+		introspection models.Introspection
+		err           error
+		wantCode      int
+		want          iam.Introspection
+		wantError     string
+	}{
+		{
+			name:          "active",
+			body:          "client_id=<your-client-id>&client_secret=<your-client-secret>&token=<token>",
+			req:           models.IntrospectionRequest{ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", Token: "<token>"},
+			introspection: active,
+			wantCode:      200,
+			want: iam.Introspection{
+				Active:    true,
+				Scope:     "read write",
+				ClientID:  "<client-id>",
+				Subject:   "<app-name>",
+				Audience:  []string{"billing"},
+				Issuer:    "iam-proxy",
+				ExpiresAt: now.Add(time.Hour).Unix(),
+				IssuedAt:  now.Unix(),
+				NotBefore: now.Unix(),
+				JWTID:     "<jti>",
+				TokenType: "Bearer",
+			},
+		},
+		{
+			name: "active_exchanged",
+			body: "client_id=<your-client-id>&client_secret=<your-client-secret>&token=<token>",
+			req:  models.IntrospectionRequest{ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", Token: "<token>"},
+			introspection: models.Introspection{
+				Active:    true,
+				ClientID:  "<actor-id>",
+				Subject:   "<app-name>",
+				ExpiresAt: now.Add(time.Hour),
+				Actor:     &models.Actor{Subject: "<actor>", ClientID: "<actor-id>", Actor: &models.Actor{Subject: "<prior-actor>"}},
+			},
+			wantCode: 200,
+			want: iam.Introspection{
+				Active:    true,
+				ClientID:  "<actor-id>",
+				Subject:   "<app-name>",
+				ExpiresAt: now.Add(time.Hour).Unix(),
+				TokenType: "Bearer",
+				Actor:     &iam.Actor{Subject: "<actor>", ClientID: "<actor-id>", Actor: &iam.Actor{Subject: "<prior-actor>"}},
+			},
+		},
+		{
+			name: "inactive_basic",
+			header: map[string]string{
+				"Content-Type":  formContentType,
+				"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("<your-client-id>:<your-client-secret>")),
+			},
+			body:     "token=<token>&token_type_hint=access_token",
+			req:      models.IntrospectionRequest{ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", Token: "<token>", TokenTypeHint: "access_token"},
+			wantCode: 200,
+		},
+		{
+			name:      "invalid_client",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&token=<token>",
+			req:       models.IntrospectionRequest{ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", Token: "<token>"},
+			err:       fmt.Errorf("%w: %w", service.ErrInvalidCredentials, service.ErrSecretMismatch),
+			wantCode:  401,
+			wantError: iam.ErrorCodeInvalidClient,
+		},
+		{
+			name:      "client_missing",
+			body:      "token=<token>",
+			wantCode:  401,
+			wantError: iam.ErrorCodeInvalidClient,
+		},
+		{
+			name:      "token_missing",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>",
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+		{
+			name:      "content_type_unsupported",
+			header:    map[string]string{"Content-Type": "text/plain"},
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&token=<token>",
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mock_service.NewMockServicer(ctrl)
+			c, err := New(Config{Config: testutil.SampleConfig(), Service: mock})
+			assert.NoError(t, err)
+
+			if len(tt.req.ClientID) > 0 {
+				mock.EXPECT().IntrospectToken(gomock.Any(), gomock.Eq(tt.req)).Return(tt.introspection, tt.err)
+			}
+			header := tt.header
+			if header == nil {
+				header = formHeader
+			}
+
+			resp, err := doRequest("POST", paths.FullPath(paths.Introspect), []byte(tt.body), header, c)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Equal(t, "no-store", resp.Header().Get("Cache-Control"))
+
+			if resp.Code == http.StatusOK {
+				var introspection iam.Introspection
+				assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &introspection))
+				assert.Equal(t, tt.want, introspection)
+				return
+			}
+			var tokenErr iam.TokenError
+			assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &tokenErr))
+			assert.Equal(t, tt.wantError, tokenErr.Error)
+		})
+	}
+}
+
+func TestClient_Revoke(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	tests := []struct {
+		name   string
+		header map[string]string
+		body   string
+		// req is the expected request of the service, none is expected when empty
+		req       models.RevocationRequest
+		err       error
+		wantCode  int
+		wantError string
+	}{
+		{
+			name:     "revoke",
+			body:     "client_id=<your-client-id>&client_secret=<your-client-secret>&token=<token>&token_type_hint=access_token",
+			req:      models.RevocationRequest{ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", Token: "<token>", TokenTypeHint: "access_token"},
+			wantCode: 200,
+		},
+		{
+			name:      "other_client",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&token=<token>",
+			req:       models.RevocationRequest{ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", Token: "<token>"},
+			err:       service.ErrTokenNotIssuedToClient,
+			wantCode:  400,
+			wantError: iam.ErrorCodeUnauthorizedClient,
+		},
+		{
+			name:      "invalid_client",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&token=<token>",
+			req:       models.RevocationRequest{ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", Token: "<token>"},
+			err:       fmt.Errorf("%w: %w", service.ErrInvalidCredentials, service.ErrSecretMismatch),
+			wantCode:  401,
+			wantError: iam.ErrorCodeInvalidClient,
+		},
+		{
+			name:      "store_error",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>&token=<token>",
+			req:       models.RevocationRequest{ClientID: "<your-client-id>", ClientSecret: "<your-client-secret>", Token: "<token>"},
+			err:       errors.New("some error"),
+			wantCode:  500,
+			wantError: iam.ErrorCodeServerError,
+		},
+		{
+			name:      "token_missing",
+			body:      "client_id=<your-client-id>&client_secret=<your-client-secret>",
+			wantCode:  400,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mock_service.NewMockServicer(ctrl)
+			c, err := New(Config{Config: testutil.SampleConfig(), Service: mock})
+			assert.NoError(t, err)
+
+			if len(tt.req.ClientID) > 0 {
+				mock.EXPECT().RevokeToken(gomock.Any(), gomock.Eq(tt.req)).Return(tt.err)
+			}
+			header := tt.header
+			if header == nil {
+				header = formHeader
+			}
+
+			resp, err := doRequest("POST", paths.FullPath(paths.Revoke), []byte(tt.body), header, c)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantCode, resp.Code)
+			if resp.Code == http.StatusOK {
+				assert.Empty(t, resp.Body.Bytes())
+				return
+			}
+			var tokenErr iam.TokenError
+			assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &tokenErr))
+			assert.Equal(t, tt.wantError, tokenErr.Error)
+		})
+	}
+}
+
+func TestClient_JWKS(t *testing.T) {
 	t.Parallel()
 	type args struct {
 		cfg  Config
@@ -126,39 +724,33 @@ type args struct {
 	}
 	ctrl := gomock.NewController(t)
 	tests := []struct {
-		name       string
-		args       args
-		wantCode   int
-		wantErr    bool
-		parsingErr bool
-		header     map[string]string
+		name     string
+		args     args
+		wantCode int
+		wantErr  bool
+		want     jwk.Set
 	}{
 		{
-			name: "token",
+			name: "jwks",
 			args: args{
 				cfg: Config{
 					Config: testutil.SampleConfig(),
 				},
 				mock: mock_service.NewMockServicer(ctrl),
 			},
-			header: map[string]string{
-				clienthttp.AuthorizationHeaderKey: "Authorization token",
-			},
+			want:     jwk.Set{Keys: []jwk.Key{{KeyType: jwk.KeyTypeOKP, KeyID: "kid", Curve: jwk.CurveEd25519, X: "x"}}},
 			wantCode: 200,
 		},
 		{
-			name: "token_error",
+			name: "jwks_error",
 			args: args{
 				cfg: Config{
 					Config: testutil.SampleConfig(),
 				},
 				mock: mock_service.NewMockServicer(ctrl),
 			},
-			header: map[string]string{
-				clienthttp.AuthorizationHeaderKey: "Authorization token",
-			},
 			wantErr:  true,
-			wantCode: 401,
+			wantCode: 500,
 		},
 	}
 	for _, tt := range tests {
@@ -170,15 +762,13 @@ type args struct {
 				return
 			}
 
-			if !tt.parsingErr {
-				if tt.wantErr {
-					tt.args.mock.EXPECT().ParseToken(gomock.Any()).Return("", errors.New("some error"))
-				} else {
-					tt.args.mock.EXPECT().ParseToken(gomock.Any()).Return("<subject>", nil)
-				}
+			if tt.wantErr {
+				tt.args.mock.EXPECT().JWKS(gomock.Any()).Return(jwk.Set{}, errors.New("some error"))
+			} else {
+				tt.args.mock.EXPECT().JWKS(gomock.Any()).Return(tt.want, nil)
 			}
 
-			resp, err := doRequest("POST", paths.FullPath(paths.ValidateToken), nil, tt.header, c)
+			resp, err := doRequest("GET", paths.FullPath(paths.JWKS), nil, map[string]string{}, c)
 			if err != nil {
 				t.Error("Failed to perform request", err)
 			}
@@ -186,6 +776,394 @@ type args struct {
 			if resp.Code != tt.wantCode {
 				t.Errorf("Expected return code %v but got %v", tt.wantCode, resp.Code)
 			}
+
+			if !tt.wantErr {
+				var set jwk.Set
+				if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+					t.Error("Cannot decode response", err)
+				}
+				if diff := cmp.Diff(set, tt.want); diff != "" {
+					t.Error(diff)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_Metadata(t *testing.T) {
+	t.Parallel()
+	metadata := models.Metadata{
+		GrantTypes:                   []string{models.GrantTypeClientCredentials},
+		AuthMethods:                  []string{models.AuthMethodClientSecret, models.AuthMethodTLSClientAuth},
+		AssertionSigningAlgs:         []string{"ES256"},
+		DPoPSigningAlgs:              []string{"ES256"},
+		TokenSigningAlgs:             []string{"EdDSA"},
+		CertificateBoundAccessTokens: true,
+	}
+
+	type test struct {
+		path      string
+		publicURL string
+		header    map[string]string
+		// proxies are the trusted proxies, the request comes from 192.0.2.1
+		proxies []string
+		// issuer is the issuer of the service, published as is
+		issuer string
+		err    error
+		// base is the expected URL of the service, the endpoints are under it
+		base     string
+		wantCode int
+	}
+
+	tests := map[string]test{
+		"oauth_authorization_server": {
+			path:     paths.FullPath(paths.AuthorizationServerMetadata),
+			issuer:   "https://example.com/iam/v1",
+			base:     "http://example.com/iam/v1",
+			wantCode: http.StatusOK,
+		},
+		"path_inserted": {
+			path:     "/" + paths.AuthorizationServerMetadata + paths.PathPrefix,
+			issuer:   "https://example.com/iam/v1",
+			base:     "http://example.com/iam/v1",
+			wantCode: http.StatusOK,
+		},
+		"forwarded_https": {
+			path:     paths.FullPath(paths.AuthorizationServerMetadata),
+			header:   map[string]string{"X-Forwarded-Proto": "https"},
+			proxies:  []string{"192.0.2.1"},
+			issuer:   "https://example.com/iam/v1",
+			base:     "https://example.com/iam/v1",
+			wantCode: http.StatusOK,
+		},
+		"forwarded_https_untrusted": {
+			path:     paths.FullPath(paths.AuthorizationServerMetadata),
+			header:   map[string]string{"X-Forwarded-Proto": "https"},
+			issuer:   "https://example.com/iam/v1",
+			base:     "http://example.com/iam/v1",
+			wantCode: http.StatusOK,
+		},
+		"public_url": {
+			path:      paths.FullPath(paths.AuthorizationServerMetadata),
+			publicURL: "https://iam.example.com/",
+			issuer:    "https://iam.example.com/iam/v1",
+			base:      "https://iam.example.com/iam/v1",
+			wantCode:  http.StatusOK,
+		},
+		"no_issuer_url": {
+			path:     paths.FullPath(paths.AuthorizationServerMetadata),
+			err:      service.ErrNoIssuerURL,
+			wantCode: http.StatusNotFound,
+		},
+		"error": {
+			path:     paths.FullPath(paths.AuthorizationServerMetadata),
+			err:      errors.New("some error"),
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mock := mock_service.NewMockServicer(ctrl)
+			cfg := testutil.SampleConfig()
+			cfg.IAM.PublicURL = tt.publicURL
+			cfg.TLS.TrustedProxies = tt.proxies
+			c, err := New(Config{Config: cfg, Service: mock})
+			assert.NoError(t, err)
+			metadata := metadata
+			metadata.Issuer = tt.issuer
+			mock.EXPECT().Metadata(gomock.Any()).Return(metadata, tt.err)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			resp := httptest.NewRecorder()
+			c.setupRouter().ServeHTTP(resp, req)
+			assert.Equal(t, tt.wantCode, resp.Code)
+			if tt.err != nil {
+				return
+			}
+
+			var got iam.Metadata
+			assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &got))
+			assert.Equal(t, iam.Metadata{
+				Issuer:                                tt.issuer,
+				TokenEndpoint:                         tt.base + "/oauth2/token",
+				IntrospectionEndpoint:                 tt.base + "/oauth2/introspect",
+				RevocationEndpoint:                    tt.base + "/oauth2/revoke",
+				JWKSURI:                               tt.base + "/.well-known/jwks.json",
+				ResponseTypes:                         []string{},
+				GrantTypes:                            []string{"client_credentials"},
+				TokenEndpointAuthMethods:              []string{"client_secret_basic", "tls_client_auth"},
+				TokenEndpointAuthSigningAlgs:          []string{"ES256"},
+				IntrospectionEndpointAuthMethods:      []string{"client_secret_basic", "tls_client_auth"},
+				IntrospectionEndpointAuthSigningAlgs:  []string{"ES256"},
+				RevocationEndpointAuthMethods:         []string{"client_secret_basic", "tls_client_auth"},
+				RevocationEndpointAuthSigningAlgs:     []string{"ES256"},
+				AccessTokenSigningAlgs:                []string{"EdDSA"},
+				DPoPSigningAlgs:                       []string{"ES256"},
+				TLSClientCertificateBoundAccessTokens: true,
+			}, got)
+		})
+	}
+}
+
+func TestClient_DPoP(t *testing.T) {
+	t.Parallel()
+	tokenBody := "client_id=<your-client-id>&client_secret=<your-client-secret>&grant_type=client_credentials"
+	tokenReq := models.TokenRequest{
+		GrantType:    models.GrantTypeClientCredentials,
+		ClientID:     "<your-client-id>",
+		ClientSecret: "<your-client-secret>",
+		DPoP:         models.DPoPProof{Proof: "<proof>", Method: http.MethodPost, URL: "http://example.com/iam/v1/oauth2/token"},
+	}
+	forwarded := models.ValidationRequest{
+		Token: "<token>",
+		DPoP:  models.DPoPProof{Proof: "<proof>", Method: http.MethodGet, URL: "https://billing.example.com/invoices"},
+	}
+
+	type test struct {
+		path   string
+		header map[string]string
+		// remoteAddr is the peer of the request, a trusted proxy unless given
+		remoteAddr string
+		// proofs are the values of the DPoP header
+		proofs []string
+		body   string
+		expect func(m *mock_service.MockServicer)
+		// wantTokenType is the token_type of a token response
+		wantTokenType string
+		wantCode      int
+		wantError     string
+		wantNonce     string
+		// wantChallenge is the WWW-Authenticate header of a validation
+		wantChallenge string
+	}
+
+	tests := map[string]test{
+		"token": {
+			path:   paths.FullPath(paths.OAuthToken),
+			proofs: []string{"<proof>"},
+			body:   tokenBody,
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().GenerateToken(gomock.Any(), tokenReq).Return(models.Token{AccessToken: "<token>", ExpiresIn: 1, DPoP: true}, nil)
+			},
+			wantTokenType: "DPoP",
+			wantCode:      http.StatusOK,
+		},
+		"token_proof_invalid": {
+			path:   paths.FullPath(paths.OAuthToken),
+			proofs: []string{"<proof>"},
+			body:   tokenBody,
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().GenerateToken(gomock.Any(), tokenReq).Return(models.Token{}, fmt.Errorf("%w: jti is missing", service.ErrInvalidDPoPProof))
+			},
+			wantCode:  http.StatusBadRequest,
+			wantError: iam.ErrorCodeInvalidDPoPProof,
+		},
+		"token_proof_required": {
+			path: paths.FullPath(paths.OAuthToken),
+			body: tokenBody,
+			expect: func(m *mock_service.MockServicer) {
+				req := tokenReq
+				req.DPoP = models.DPoPProof{}
+				m.EXPECT().GenerateToken(gomock.Any(), req).Return(models.Token{}, service.ErrDPoPProofRequired)
+			},
+			wantCode:  http.StatusBadRequest,
+			wantError: iam.ErrorCodeInvalidRequest,
+		},
+		"token_nonce": {
+			path:   paths.FullPath(paths.OAuthToken),
+			proofs: []string{"<proof>"},
+			body:   tokenBody,
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().GenerateToken(gomock.Any(), tokenReq).Return(models.Token{}, service.ErrDPoPNonceRequired)
+				m.EXPECT().DPoPNonce(gomock.Any()).Return("<nonce>", nil)
+			},
+			wantCode:  http.StatusBadRequest,
+			wantError: iam.ErrorCodeUseDPoPNonce,
+			wantNonce: "<nonce>",
+		},
+		"token_proofs": {
+			path:      paths.FullPath(paths.OAuthToken),
+			proofs:    []string{"<proof>", "<other-proof>"},
+			body:      tokenBody,
+			expect:    func(m *mock_service.MockServicer) {},
+			wantCode:  http.StatusBadRequest,
+			wantError: iam.ErrorCodeInvalidDPoPProof,
+		},
+		"validate_forwarded": {
+			path: paths.FullPath(paths.ValidateToken),
+			header: map[string]string{
+				clienthttp.AuthorizationHeaderKey: "DPoP <token>",
+				"X-Forwarded-Proto":               "https",
+				"X-Forwarded-Host":                "billing.example.com",
+				"X-Forwarded-Method":              http.MethodGet,
+				"X-Forwarded-Uri":                 "/invoices",
+			},
+			proofs: []string{"<proof>"},
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().ValidateToken(gomock.Any(), forwarded).Return(nil)
+			},
+			wantCode: http.StatusOK,
+		},
+		"validate_forwarded_untrusted": {
+			path: paths.FullPath(paths.ValidateToken),
+			header: map[string]string{
+				clienthttp.AuthorizationHeaderKey: "DPoP <token>",
+				"X-Forwarded-Proto":               "https",
+				"X-Forwarded-Host":                "billing.example.com",
+				"X-Forwarded-Method":              http.MethodGet,
+				"X-Forwarded-Uri":                 "/invoices",
+			},
+			remoteAddr: "198.51.100.1:1234",
+			proofs:     []string{"<proof>"},
+			expect: func(m *mock_service.MockServicer) {
+				req := models.ValidationRequest{
+					Token: "<token>",
+					DPoP:  models.DPoPProof{Proof: "<proof>", Method: http.MethodPost, URL: "http://example.com/iam/v1/oauth2/validate"},
+				}
+				m.EXPECT().ValidateToken(gomock.Any(), req).Return(nil)
+			},
+			wantCode: http.StatusOK,
+		},
+		"validate_proof_invalid": {
+			path: paths.FullPath(paths.ValidateToken),
+			header: map[string]string{
+				clienthttp.AuthorizationHeaderKey: "DPoP <token>",
+			},
+			proofs: []string{"<proof>"},
+			expect: func(m *mock_service.MockServicer) {
+				req := models.ValidationRequest{
+					Token: "<token>",
+					DPoP:  models.DPoPProof{Proof: "<proof>", Method: http.MethodPost, URL: "http://example.com/iam/v1/oauth2/validate"},
+				}
+				m.EXPECT().ValidateToken(gomock.Any(), req).Return(fmt.Errorf("%w: htu does not match the request", service.ErrInvalidDPoPProof))
+			},
+			wantCode:      http.StatusUnauthorized,
+			wantChallenge: `DPoP error="invalid_dpop_proof"`,
+		},
+		"validate_proof_required": {
+			path: paths.FullPath(paths.ValidateToken),
+			header: map[string]string{
+				clienthttp.AuthorizationHeaderKey: "Bearer <token>",
+			},
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().ValidateToken(gomock.Any(), models.ValidationRequest{Token: "<token>"}).Return(service.ErrDPoPProofRequired)
+			},
+			wantCode:      http.StatusUnauthorized,
+			wantChallenge: `DPoP error="invalid_token"`,
+		},
+		"validate_nonce": {
+			path: paths.FullPath(paths.ValidateToken),
+			header: map[string]string{
+				clienthttp.AuthorizationHeaderKey: "DPoP <token>",
+				"X-Forwarded-Proto":               "https",
+				"X-Forwarded-Host":                "billing.example.com",
+				"X-Forwarded-Method":              http.MethodGet,
+				"X-Forwarded-Uri":                 "/invoices",
+			},
+			proofs: []string{"<proof>"},
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().ValidateToken(gomock.Any(), forwarded).Return(service.ErrDPoPNonceRequired)
+				m.EXPECT().DPoPNonce(gomock.Any()).Return("<nonce>", nil)
+			},
+			wantCode:      http.StatusUnauthorized,
+			wantNonce:     "<nonce>",
+			wantChallenge: `DPoP error="use_dpop_nonce"`,
+		},
+		"validate_proofs": {
+			path: paths.FullPath(paths.ValidateToken),
+			header: map[string]string{
+				clienthttp.AuthorizationHeaderKey: "DPoP <token>",
+			},
+			proofs:        []string{"<proof>", "<other-proof>"},
+			expect:        func(m *mock_service.MockServicer) {},
+			wantCode:      http.StatusUnauthorized,
+			wantChallenge: `DPoP error="invalid_dpop_proof"`,
+		},
+		"admin": {
+			path: paths.FullPath(paths.AdminClients),
+			header: map[string]string{
+				clienthttp.AuthorizationHeaderKey: "DPoP <token>",
+			},
+			proofs: []string{"<proof>"},
+			expect: func(m *mock_service.MockServicer) {
+				req := models.ValidationRequest{
+					Token: "<token>",
+					DPoP:  models.DPoPProof{Proof: "<proof>", Method: http.MethodPost, URL: "http://example.com/iam/v1/admin/clients"},
+				}
+				m.EXPECT().AuthorizeAdmin(gomock.Any(), req).Return(service.ErrInsufficientScope)
+			},
+			wantCode: http.StatusForbidden,
+		},
+		"admin_proof_required": {
+			path: paths.FullPath(paths.AdminClients),
+			header: map[string]string{
+				clienthttp.AuthorizationHeaderKey: "Bearer <token>",
+			},
+			expect: func(m *mock_service.MockServicer) {
+				m.EXPECT().AuthorizeAdmin(gomock.Any(), models.ValidationRequest{Token: "<token>"}).Return(service.ErrDPoPProofRequired)
+			},
+			wantCode:      http.StatusUnauthorized,
+			wantChallenge: `DPoP error="invalid_token"`,
+		},
+		"introspect": {
+			path:   paths.FullPath(paths.Introspect),
+			proofs: []string{"<proof>"},
+			body:   "client_id=<your-client-id>&client_secret=<your-client-secret>&token=<token>",
+			expect: func(m *mock_service.MockServicer) {
+				req := models.IntrospectionRequest{
+					ClientID:     "<your-client-id>",
+					ClientSecret: "<your-client-secret>",
+					Token:        "<token>",
+					DPoP:         models.DPoPProof{Proof: "<proof>", Method: http.MethodPost, URL: "http://example.com/iam/v1/oauth2/introspect"},
+				}
+				m.EXPECT().IntrospectToken(gomock.Any(), req).Return(models.Introspection{}, nil)
+			},
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mock := mock_service.NewMockServicer(ctrl)
+			cfg := testutil.SampleConfig()
+			cfg.TLS.TrustedProxies = []string{"192.0.2.0/24"}
+			c, err := New(Config{Config: cfg, Service: mock})
+			assert.NoError(t, err)
+			tt.expect(mock)
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if len(tt.remoteAddr) > 0 {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			req.Header.Set("Content-Type", formContentType)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			for _, proof := range tt.proofs {
+				req.Header.Add(clienthttp.DPoPHeaderKey, proof)
+			}
+			resp := httptest.NewRecorder()
+			c.setupRouter().ServeHTTP(resp, req)
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Equal(t, tt.wantNonce, resp.Header().Get(clienthttp.DPoPNonceHeaderKey))
+			assert.Equal(t, tt.wantChallenge, resp.Header().Get("WWW-Authenticate"))
+
+			switch {
+			case len(tt.wantTokenType) > 0:
+				var token iam.TokenResponse
+				assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &token))
+				assert.Equal(t, tt.wantTokenType, token.TokenType)
+			case len(tt.wantError) > 0:
+				var tokenErr iam.TokenError
+				assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &tokenErr))
+				assert.Equal(t, tt.wantError, tokenErr.Error)
+			}
 		})
 	}
 }
@@ -37,8 +37,12 @@ func Run() error {
 		return fmt.Errorf("failed to initialise application config: %w", err)
 	}
 
+	// background stops the background work of the service on shutdown
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
 	c.Logger.Debug("Creating iam service")
-	svc, err := service.New(service.Config{
+	svc, err := service.New(background, service.Config{
 		Config: c,
 	})
 	if err != nil {
@@ -68,7 +72,9 @@ func Run() error {
 	go func() {
 		c.Logger.Infow("HTTP Server listening",
 			"host", c.Host,
-			"port", c.Port)
+			"port", c.Port,
+			"tls", c.TLS.Enabled(),
+			"client-certificates", len(c.TLS.ClientCAFile) > 0)
 		if err := srvWrapped.ListenAndServe(); err != nil {
 			if err != http.ErrServerClosed {
 				c.Logger.Errorw("HTTP Server stopped unexpectedly", zap.Error(err))
@@ -99,6 +105,9 @@ func Run() error {
 			errs = append(errs, err)
 		}
 
+		c.Logger.Info("Stopping background work")
+		stopBackground()
+
 		cerr <- errs.Join()
 	}()
 
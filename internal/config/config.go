@@ -53,6 +53,7 @@ type Config struct {
 	HTTPTimeout     time.Duration
 	ShutdownTimeout time.Duration
 	Metric          Metric
+	TLS             TLS
 	// Internal
 	Logger *zap.SugaredLogger `ignored:"true"`
 }
@@ -70,8 +71,115 @@ type Config struct {
 
 // IAM defines the configuration for the iam auth2 functionalities
 type IAM struct {
-	Users  string
-	Secret string
+	Users string
+	// UsersFile is a JSON or YAML file of the client credentials, or a directory holding a file per client.
+	// It is reloaded on change and on SIGHUP, and takes precedence over Users.
+	UsersFile string
+	// UsersReloadInterval is how often UsersFile is checked for changes.
+	UsersReloadInterval time.Duration
+	// UsersDriver is the database holding the client credentials, sqlite or postgres. When set, the
+	// database at UsersDSN takes precedence over UsersFile and Users.
+	UsersDriver string
+	// UsersDSN is the data source name of the database, e.g. a file path for SQLite or a postgres:// URL.
+	UsersDSN string
+	Secret   string
+	// SigningKey is a PEM encoded RSA, ECDSA or Ed25519 private key. When set,
+	// tokens are signed with it instead of the shared Secret.
+	SigningKey string
+	// SigningKeyFile is the path of a PEM file holding the signing key.
+	SigningKeyFile string
+	// SigningAlgorithm optionally pins the algorithm of the PEM keys, e.g. PS256 for RSA keys.
+	SigningAlgorithm string
+	// IdentitySigningKey is a PEM encoded private key signing identity tokens only. When set, identity
+	// tokens cannot be verified with the keys of access tokens and vice versa.
+	IdentitySigningKey string
+	// IdentitySigningKeyFile is the path of a PEM file holding the identity signing key.
+	IdentitySigningKeyFile string
+	// KeyFiles maps key ids to files holding a PEM encoded key or a shared secret, e.g.
+	// "2024-06:/keys/new.pem,2024-01:/keys/old.pem". Public keys only verify tokens.
+	KeyFiles map[string]string
+	// ActiveKey is the id of the key in KeyFiles that signs tokens.
+	ActiveKey string
+	// KeyringDir persists automatically rotated signing keys, shared by replicas mounting it. When set,
+	// generated keys sign tokens and the configured keys only verify them.
+	KeyringDir string
+	// KeyRotationInterval is how long a generated key signs tokens before it is replaced.
+	KeyRotationInterval time.Duration
+	// KeyRetention is how long a replaced key keeps verifying tokens, it must exceed the token lifetime.
+	KeyRetention time.Duration
+	// TokenTTL is how long access tokens are valid, unless the client overrides it.
+	TokenTTL time.Duration
+	// IdentityTokenTTL is how long identity tokens are valid.
+	IdentityTokenTTL time.Duration
+	// AllowNonExpiringIdentityTokens keeps accepting identity tokens issued without an expiry while
+	// clients migrate.
+	AllowNonExpiringIdentityTokens bool
+	// TokenLeeway tolerates clock skew between replicas when validating the exp, nbf and iat claims.
+	TokenLeeway time.Duration
+	// RequireExpiration rejects all tokens without an exp claim, including legacy identity tokens.
+	RequireExpiration bool
+	// RequireIssuedAt rejects tokens without an iat claim.
+	RequireIssuedAt bool
+	// RejectFutureIssuedAt rejects tokens issued in the future beyond the leeway.
+	RejectFutureIssuedAt bool
+	// LegacyTokenEndpoint keeps the former token endpoint for clients not migrated yet: camelCase response
+	// fields, bare error status codes and an optional grant_type in any content type.
+	LegacyTokenEndpoint bool
+	// RevocationDriver is the database sharing the revoked tokens between replicas, sqlite or postgres.
+	// Revocations are kept in memory of the replica receiving them when unset.
+	RevocationDriver string
+	// RevocationDSN is the data source name of the revocation database.
+	RevocationDSN string
+	// RefreshTokenTTL is the absolute lifetime of a family of refresh tokens, however often it is rotated.
+	RefreshTokenTTL time.Duration
+	// RefreshTokenIdleTTL is how long a refresh token is valid unused.
+	RefreshTokenIdleTTL time.Duration
+	// RefreshTokenDriver is the database sharing the refresh tokens between replicas, sqlite or postgres.
+	// Refresh tokens are kept in memory of the replica issuing them when unset.
+	RefreshTokenDriver string
+	// RefreshTokenDSN is the data source name of the refresh token database.
+	RefreshTokenDSN string
+	// ClientAssertionAudiences are further accepted audiences of client assertions besides the issuer, e.g.
+	// the public URL of the token endpoint.
+	ClientAssertionAudiences []string
+	// ReplayDriver is the database sharing the ids of used client assertions between replicas, sqlite or
+	// postgres. The ids are kept in memory of each replica when unset.
+	ReplayDriver string
+	// ReplayDSN is the data source name of the replay database.
+	ReplayDSN string
+	// PublicURL is the external base URL of the service, e.g. https://iam.example.com, from which the
+	// issuer of the tokens and the endpoints of the server metadata are built. The issuer is iam-proxy and
+	// the URL of each metadata request is used when unset.
+	PublicURL string
+	// DPoPRequireNonce requires DPoP proofs to carry a nonce issued by the service, see RFC 9449 section 8.
+	DPoPRequireNonce bool
+	// DPoPNonceSecret authenticates the DPoP nonces, so replicas sharing it accept each other's nonces. A random
+	// secret of each replica is used when unset.
+	DPoPNonceSecret string
+	// MaxSecretVerifications bounds the client secrets verified at once, as verifying an argon2id hash takes
+	// up to 64 MiB of memory. Further requests wait briefly, then are refused as temporarily unavailable.
+	MaxSecretVerifications int
+}
+
+// TLS configures the server to serve HTTPS, and to accept TLS client certificates, see RFC 8705.
+type TLS struct {
+	// CertFile and KeyFile are the PEM files of the server certificate and its key. HTTPS is served when set.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a PEM file of the certificate authorities issuing client certificates. When set, clients
+	// may present a certificate, which is verified against them.
+	ClientCAFile string
+	// ClientCertHeader is the header in which proxies terminating TLS forward the PEM client certificate,
+	// optionally URL-encoded, e.g. X-Forwarded-Client-Cert. It is only read from TrustedProxies.
+	ClientCertHeader string
+	// TrustedProxies are the IP addresses or CIDR ranges of the proxies whose ClientCertHeader is accepted, along
+	// with the X-Forwarded headers telling the request of their callers.
+	TrustedProxies []string
+}
+
+// Enabled tells whether HTTPS is served.
+func (t TLS) Enabled() bool {
+	return len(t.CertFile) > 0
 }
 
 // Metric for OpenCensus trace and metric collection
@@ -116,6 +224,15 @@ func NewDefault() Config {
 		LogLevel:        "info",
 		HTTPTimeout:     5 * time.Second,
 		ShutdownTimeout: 30 * time.Second,
+		IAM: IAM{
+			UsersReloadInterval: 30 * time.Second,
+			KeyRotationInterval: 30 * 24 * time.Hour,
+			KeyRetention:        24 * time.Hour,
+			TokenTTL:            1 * time.Hour,
+			IdentityTokenTTL:    1 * time.Hour,
+			RefreshTokenTTL:     30 * 24 * time.Hour,
+			RefreshTokenIdleTTL: 24 * time.Hour,
+		},
 	}
 }
 
@@ -0,0 +1,144 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package credentials implements the stores of the client credentials.
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ingka-group/iam-proxy/internal/keys"
+	"github.com/ingka-group/iam-proxy/internal/models"
+	"github.com/ingka-group/iam-proxy/internal/secret"
+)
+
+var (
+	// ErrNotFound is returned when a client does not exist.
+	ErrNotFound = errors.New("client id does not exist")
+	// ErrExists is returned when creating a client that exists already.
+	ErrExists = errors.New("client id exists already")
+	// ErrReadOnly is returned when changing the clients of a store that cannot be written.
+	ErrReadOnly = errors.New("client credentials are read-only")
+	// ErrStale is returned by the health of a store that keeps serving its last good credentials after an
+	// update failed, and by changes to it until the update is fixed.
+	ErrStale = errors.New("client credentials are stale")
+)
+
+// Static holds client credentials that never change, as decoded from IAM_USERS.
+type Static models.IAM
+
+// Client returns the credentials of the client.
+func (s Static) Client(_ context.Context, id models.ClientID) (models.Secret, error) {
+	client, ok := s[id]
+	if !ok {
+		return models.Secret{}, ErrNotFound
+	}
+	return client, nil
+}
+
+// Clients returns all client credentials.
+func (s Static) Clients(_ context.Context) (models.IAM, error) {
+	return models.IAM(s), nil
+}
+
+// Health always succeeds.
+func (s Static) Health(_ context.Context) error {
+	return nil
+}
+
+// Validate checks the client credentials.
+func Validate(clients models.IAM) error {
+	for id, c := range clients {
+		if len(id) == 0 {
+			return errors.New("client id is empty")
+		}
+		switch c.TokenEndpointAuthMethod {
+		case "", models.AuthMethodClientSecret:
+		case models.AuthMethodPrivateKeyJWT:
+			if (len(c.PublicKey) == 0) == (len(c.JWKSURI) == 0) {
+				return fmt.Errorf("%s needs either a public key or a JWKS URI", c.AppName)
+			}
+			if len(c.PublicKey) > 0 {
+				if _, err := keys.ParsePEM([]byte(c.PublicKey), ""); err != nil {
+					return fmt.Errorf("public key of %s is invalid: %w", c.AppName, err)
+				}
+			}
+			if len(c.JWKSURI) > 0 && !strings.HasPrefix(c.JWKSURI, "https://") {
+				return fmt.Errorf("JWKS URI of %s must be an https URL", c.AppName)
+			}
+		case models.AuthMethodTLSClientAuth:
+			if err := validateTLSClientAuth(c.TLSClientAuth); err != nil {
+				return fmt.Errorf("certificate of %s: %w", c.AppName, err)
+			}
+		default:
+			return fmt.Errorf("%s has unsupported authentication method %q", c.AppName, c.TokenEndpointAuthMethod)
+		}
+		secrets := c.Secrets()
+		if len(secrets) == 0 && c.UsesClientSecret() {
+			return fmt.Errorf("%s has no client secret", c.AppName)
+		}
+		for _, cs := range secrets {
+			if len(cs.Secret) == 0 {
+				return fmt.Errorf("client secret of %s is empty", c.AppName)
+			}
+			if !cs.NotBefore.IsZero() && !cs.ExpiresAt.IsZero() && !cs.NotBefore.Before(cs.ExpiresAt) {
+				return fmt.Errorf("client secret of %s expires before it is valid", c.AppName)
+			}
+		}
+		if c.ExpiresIn < 0 || c.IdentityExpiresIn < 0 {
+			return fmt.Errorf("token lifetime of %s is negative", c.AppName)
+		}
+	}
+	return nil
+}
+
+// Log logs the loaded clients, warning about deprecated plaintext secrets.
+func Log(logger *zap.SugaredLogger, clients models.IAM) {
+	now := time.Now()
+	for _, c := range clients {
+		for _, cs := range c.Secrets() {
+			if !secret.IsHash(cs.Secret) {
+				logger.Warnf("client secret of %s is in plaintext, which is deprecated, store a hash instead", c.AppName)
+			}
+			if cs.Expired(now) {
+				logger.Warnf("client secret of %s expired at %s", c.AppName, cs.ExpiresAt)
+			}
+		}
+		logger.Infof("loaded user credentials for %s", c.AppName)
+	}
+}
+
+// validateTLSClientAuth checks that exactly one name of the certificate is given.
+func validateTLSClientAuth(auth models.TLSClientAuth) error {
+	var names int
+	for _, name := range []string{auth.SubjectDN, auth.SANDNS, auth.SANURI, auth.SANIP, auth.SANEmail} {
+		if len(name) > 0 {
+			names++
+		}
+	}
+	if names != 1 {
+		return errors.New("exactly one of subject_dn, san_dns, san_uri, san_ip or san_email is required")
+	}
+	if len(auth.SANIP) > 0 && net.ParseIP(auth.SANIP) == nil {
+		return fmt.Errorf("%q is not an IP address", auth.SANIP)
+	}
+	return nil
+}
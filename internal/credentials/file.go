@@ -0,0 +1,386 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+// DefaultReloadInterval is how often the credentials file is checked for changes when no interval is configured.
+const DefaultReloadInterval = 30 * time.Second
+
+// FileConfig configures loading the client credentials from a file or a directory.
+type FileConfig struct {
+	// Path is a JSON or YAML file mapping client ids to their credentials, or a directory holding a file per
+	// client named after the client id, as mounted from a Kubernetes secret.
+	Path string
+	// Interval is how often the file is checked for changes.
+	Interval time.Duration
+	Logger   *zap.SugaredLogger
+}
+
+// File holds the client credentials loaded from a file, reloading them when the file changes or on SIGHUP.
+// A malformed update keeps the last good credentials.
+type File struct {
+	cfg     FileConfig
+	clients atomic.Pointer[models.IAM]
+	err     atomic.Pointer[error]
+
+	// mu serializes reloads and writes, guarding digest.
+	mu     sync.Mutex
+	digest [sha256.Size]byte
+}
+
+// NewFile loads the client credentials from the configured path.
+func NewFile(cfg FileConfig) (*File, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultReloadInterval
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop().Sugar()
+	}
+
+	f := &File{cfg: cfg}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Client returns the credentials of the client.
+func (f *File) Client(_ context.Context, id models.ClientID) (models.Secret, error) {
+	client, ok := (*f.clients.Load())[id]
+	if !ok {
+		return models.Secret{}, ErrNotFound
+	}
+	return client, nil
+}
+
+// Clients returns the current client credentials.
+func (f *File) Clients(_ context.Context) (models.IAM, error) {
+	return *f.clients.Load(), nil
+}
+
+// Health returns why the last reload failed, wrapping ErrStale, nil when the credentials are up to date.
+func (f *File) Health(_ context.Context) error {
+	if err := f.err.Load(); err != nil {
+		return fmt.Errorf("%w: %w", ErrStale, *err)
+	}
+	return nil
+}
+
+// Run reloads the credentials on change or on SIGHUP until the context is cancelled.
+func (f *File) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.cfg.Interval)
+	defer ticker.Stop()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			f.cfg.Logger.Info("Reloading client credentials on SIGHUP")
+		case <-ticker.C:
+		}
+		if err := f.Reload(); err != nil {
+			f.cfg.Logger.Errorw("Failed to reload client credentials, keeping the last good set", zap.Error(err))
+		}
+	}
+}
+
+// CreateClient writes the new client to the file, ErrExists when it exists already.
+func (f *File) CreateClient(_ context.Context, id models.ClientID, client models.Secret) error {
+	return f.change(id, func(exists bool) (*models.Secret, error) {
+		if exists {
+			return nil, ErrExists
+		}
+		return &client, nil
+	})
+}
+
+// UpdateClient writes the changed client to the file, ErrNotFound when it does not exist.
+func (f *File) UpdateClient(_ context.Context, id models.ClientID, client models.Secret) error {
+	return f.change(id, func(exists bool) (*models.Secret, error) {
+		if !exists {
+			return nil, ErrNotFound
+		}
+		return &client, nil
+	})
+}
+
+// DeleteClient removes the client from the file, ErrNotFound when it does not exist.
+func (f *File) DeleteClient(_ context.Context, id models.ClientID) error {
+	return f.change(id, func(exists bool) (*models.Secret, error) {
+		if !exists {
+			return nil, ErrNotFound
+		}
+		return nil, nil
+	})
+}
+
+// change writes the client returned by apply to the file, removing it when apply returns nil, and reloads the
+// credentials. The file is reloaded first, so changes made to it in the meantime are kept. While it cannot be
+// loaded, writing the last good credentials would lose those changes, so ErrStale is returned instead.
+func (f *File) change(id models.ClientID, apply func(exists bool) (*models.Secret, error)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.reload(); err != nil {
+		return fmt.Errorf("%w: %w", ErrStale, err)
+	}
+	// an unchanged malformed file is not reported again by reload
+	if err := f.err.Load(); err != nil {
+		return fmt.Errorf("%w: %w", ErrStale, *err)
+	}
+	clients := maps.Clone(*f.clients.Load())
+	_, exists := clients[id]
+	client, err := apply(exists)
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		delete(clients, id)
+	} else {
+		clients[id] = *client
+		if err := Validate(models.IAM{id: *client}); err != nil {
+			return err
+		}
+	}
+
+	if err := f.write(id, clients); err != nil {
+		return fmt.Errorf("could not write client credentials to %s: %w", f.cfg.Path, err)
+	}
+	return f.reload()
+}
+
+// write stores the clients in the credentials file, or the changed client in its file of the directory.
+func (f *File) write(id models.ClientID, clients models.IAM) error {
+	info, err := os.Stat(f.cfg.Path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return writeFile(f.cfg.Path, clients)
+	}
+
+	name, err := clientFile(f.cfg.Path, id)
+	if err != nil {
+		return err
+	}
+	client, ok := clients[id]
+	if !ok {
+		return os.Remove(name)
+	}
+	return writeFile(name, client)
+}
+
+// Reload reads the credentials and swaps them in when they changed. On failure the current credentials are kept.
+func (f *File) Reload() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reload()
+}
+
+func (f *File) reload() error {
+	files, dir, err := readFiles(f.cfg.Path)
+	if err != nil {
+		return f.fail(err)
+	}
+	digest := digestOf(files)
+	if f.clients.Load() != nil && digest == f.digest {
+		// an unchanged malformed update was reported already
+		return nil
+	}
+
+	clients, err := parseFiles(files, dir)
+	if err == nil {
+		err = Validate(clients)
+	}
+	if err != nil {
+		f.digest = digest
+		return f.fail(err)
+	}
+
+	Log(f.cfg.Logger, clients)
+	f.clients.Store(&clients)
+	f.err.Store(nil)
+	f.digest = digest
+	return nil
+}
+
+func (f *File) fail(err error) error {
+	err = fmt.Errorf("could not load client credentials from %s: %w", f.cfg.Path, err)
+	f.err.Store(&err)
+	return err
+}
+
+// readFiles reads the credentials file, or the client files in the directory by name, reporting whether the
+// path is a directory.
+func readFiles(path string) (map[string][]byte, bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, err
+	}
+	if !info.IsDir() {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, false, err
+		}
+		return map[string][]byte{filepath.Base(path): b}, false, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, true, err
+	}
+	files := make(map[string][]byte, len(entries))
+	for _, e := range entries {
+		// Kubernetes keeps the mounted data in hidden directories linked from the visible files
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		file := filepath.Join(path, e.Name())
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, true, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, true, err
+		}
+		files[e.Name()] = b
+	}
+	return files, true, nil
+}
+
+// parseFiles decodes the credentials file, or a client from each file in the directory.
+func parseFiles(files map[string][]byte, dir bool) (models.IAM, error) {
+	clients := models.IAM{}
+	if !dir {
+		for name, b := range files {
+			if err := decode(name, b, &clients); err != nil {
+				return nil, err
+			}
+		}
+		return clients, nil
+	}
+
+	for name, b := range files {
+		var client models.Secret
+		if err := decode(name, b, &client); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		clients[models.ClientID(strings.TrimSuffix(name, filepath.Ext(name)))] = client
+	}
+	return clients, nil
+}
+
+// clientFile returns the file of the client in the directory, a new JSON file when there is none.
+func clientFile(dir string, id models.ClientID) (string, error) {
+	if strings.ContainsAny(string(id), `/\`) || strings.HasPrefix(string(id), ".") {
+		return "", fmt.Errorf("client id %s cannot name a file", id)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), ".") && strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())) == string(id) {
+			return filepath.Join(dir, e.Name()), nil
+		}
+	}
+	return filepath.Join(dir, string(id)+".json"), nil
+}
+
+// writeFile encodes v by the extension of the file and replaces the file, so readers never see a partial write.
+func writeFile(name string, v interface{}) error {
+	b, err := encode(name, v)
+	if err != nil {
+		return err
+	}
+	// a hidden temporary file is skipped when reading a directory
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// encode encodes YAML files by their extension, any other file as JSON.
+func encode(name string, v interface{}) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		return yaml.Marshal(v)
+	}
+	return json.MarshalIndent(v, "", "  ")
+}
+
+// decode decodes YAML files by their extension, any other file as JSON.
+func decode(name string, b []byte, v interface{}) error {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		return yaml.Unmarshal(b, v)
+	}
+	return json.Unmarshal(b, v)
+}
+
+func digestOf(files map[string][]byte) [sha256.Size]byte {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s\x00%d\x00", name, len(files[name]))
+		buf.Write(files[name])
+	}
+	return sha256.Sum256(buf.Bytes())
+}
@@ -0,0 +1,267 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credentials
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+func TestFile(t *testing.T) {
+	type test struct {
+		files map[string]string
+		want  models.IAM
+		err   bool
+	}
+
+	tests := map[string]test{
+		"json": {
+			files: map[string]string{"users.json": `{"a": {"client_secret": "s", "app_name": "app", "audiences": ["billing"]}}`},
+			want:  models.IAM{"a": {ClientSecret: "s", AppName: "app", Audiences: []string{"billing"}}},
+		},
+		"yaml": {
+			files: map[string]string{"users.yaml": "a:\n  client_secret: s\n  app_name: app\n  expires_in: 300\n"},
+			want:  models.IAM{"a": {ClientSecret: "s", AppName: "app", ExpiresIn: 300}},
+		},
+		"client details": {
+			files: map[string]string{"users.yaml": `a:
+  client_secret: s
+  app_name: app
+  description: Billing batch
+  owner:
+    team: payments
+    contact: payments@example.com
+  created_at: 2024-05-01T12:00:00Z
+  labels:
+    cost-center: "42"
+  disabled: true
+  grant_types: [client_credentials]
+  identity_expires_in: 600
+  scopes: [read]
+`},
+			want: models.IAM{"a": {
+				ClientSecret:      "s",
+				AppName:           "app",
+				Description:       "Billing batch",
+				Owner:             models.Owner{Team: "payments", Contact: "payments@example.com"},
+				CreatedAt:         time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+				Labels:            map[string]string{"cost-center": "42"},
+				Disabled:          true,
+				GrantTypes:        []string{models.GrantTypeClientCredentials},
+				IdentityExpiresIn: 600,
+				Scopes:            []string{"read"},
+			}},
+		},
+		"many secrets": {
+			files: map[string]string{"users.yaml": "a:\n  app_name: app\n  client_secrets:\n    - secret: s\n      expires_at: 2030-01-01T00:00:00Z\n    - secret: t\n      not_before: 2029-12-01T00:00:00Z\n"},
+			want: models.IAM{"a": {AppName: "app", ClientSecrets: []models.ClientSecret{
+				{Secret: "s", ExpiresAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)},
+				{Secret: "t", NotBefore: time.Date(2029, 12, 1, 0, 0, 0, 0, time.UTC)},
+			}}},
+		},
+		"secret expiring before it is valid": {
+			files: map[string]string{"users.json": `{"a": {"app_name": "app", "client_secrets": [{"secret": "s", "not_before": "2030-01-01T00:00:00Z", "expires_at": "2029-01-01T00:00:00Z"}]}}`},
+			err:   true,
+		},
+		"private key jwt": {
+			files: map[string]string{"users.yaml": "a:\n  app_name: app\n  token_endpoint_auth_method: private_key_jwt\n  jwks_uri: https://app.example.com/jwks.json\n"},
+			want:  models.IAM{"a": {AppName: "app", TokenEndpointAuthMethod: models.AuthMethodPrivateKeyJWT, JWKSURI: "https://app.example.com/jwks.json"}},
+		},
+		"private key jwt without key": {
+			files: map[string]string{"users.yaml": "a:\n  app_name: app\n  token_endpoint_auth_method: private_key_jwt\n"},
+			err:   true,
+		},
+		"private key jwt over http": {
+			files: map[string]string{"users.yaml": "a:\n  app_name: app\n  token_endpoint_auth_method: private_key_jwt\n  jwks_uri: http://app.example.com/jwks.json\n"},
+			err:   true,
+		},
+		"private key jwt with invalid key": {
+			files: map[string]string{"users.yaml": "a:\n  app_name: app\n  token_endpoint_auth_method: private_key_jwt\n  public_key: key\n"},
+			err:   true,
+		},
+		"tls client auth": {
+			files: map[string]string{"users.yaml": "a:\n  app_name: app\n  token_endpoint_auth_method: tls_client_auth\n  tls_client_auth:\n    san_dns: app.example.com\n"},
+			want:  models.IAM{"a": {AppName: "app", TokenEndpointAuthMethod: models.AuthMethodTLSClientAuth, TLSClientAuth: models.TLSClientAuth{SANDNS: "app.example.com"}}},
+		},
+		"tls client auth without name": {
+			files: map[string]string{"users.yaml": "a:\n  app_name: app\n  token_endpoint_auth_method: tls_client_auth\n"},
+			err:   true,
+		},
+		"tls client auth with two names": {
+			files: map[string]string{"users.yaml": "a:\n  app_name: app\n  token_endpoint_auth_method: tls_client_auth\n  tls_client_auth:\n    subject_dn: CN=app\n    san_dns: app.example.com\n"},
+			err:   true,
+		},
+		"tls client auth with invalid ip": {
+			files: map[string]string{"users.yaml": "a:\n  app_name: app\n  token_endpoint_auth_method: tls_client_auth\n  tls_client_auth:\n    san_ip: app\n"},
+			err:   true,
+		},
+		"unsupported auth method": {
+			files: map[string]string{"users.yaml": "a:\n  client_secret: s\n  app_name: app\n  token_endpoint_auth_method: self_signed_tls_client_auth\n"},
+			err:   true,
+		},
+		"malformed": {
+			files: map[string]string{"users.json": `{"a": `},
+			err:   true,
+		},
+		"invalid": {
+			files: map[string]string{"users.json": `{"a": {"app_name": "app"}}`},
+			err:   true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			var path string
+			for name, content := range tt.files {
+				path = filepath.Join(dir, name)
+				assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+			}
+
+			f, err := NewFile(FileConfig{Path: path})
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, clients(t, f))
+		})
+	}
+}
+
+func TestFile_Directory(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"client_secret": "s", "app_name": "app-a"}`), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.yaml"), []byte("client_secret: s\napp_name: app-b\n"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "c"), []byte(`{"client_secret": "s", "app_name": "app-c"}`), 0o600))
+	// hidden entries, as created by Kubernetes secret mounts, are skipped
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "..data"), 0o700))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden"), []byte("not json"), 0o600))
+
+	f, err := NewFile(FileConfig{Path: dir})
+	assert.NoError(t, err)
+	assert.Equal(t, models.IAM{
+		"a": {ClientSecret: "s", AppName: "app-a"},
+		"b": {ClientSecret: "s", AppName: "app-b"},
+		"c": {ClientSecret: "s", AppName: "app-c"},
+	}, clients(t, f))
+}
+
+func TestFile_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"a": {"client_secret": "s", "app_name": "app"}}`), 0o600))
+
+	f, err := NewFile(FileConfig{Path: path})
+	assert.NoError(t, err)
+	first := clients(t, f)
+
+	// an unchanged file keeps the credentials
+	assert.NoError(t, f.Reload())
+	assert.Equal(t, first, clients(t, f))
+
+	// a malformed update keeps the last good credentials and is reported
+	assert.NoError(t, os.WriteFile(path, []byte(`{"a": {"client_secret": `), 0o600))
+	assert.Error(t, f.Reload())
+	assert.Equal(t, first, clients(t, f))
+	assert.ErrorIs(t, f.Health(context.TODO()), ErrStale)
+	assert.NoError(t, f.Reload())
+	assert.ErrorIs(t, f.Health(context.TODO()), ErrStale)
+
+	// and the file is not written over until it is fixed
+	assert.ErrorIs(t, f.CreateClient(context.TODO(), "c", models.Secret{ClientSecret: "u", AppName: "third"}), ErrStale)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a": {"client_secret": `, string(data))
+
+	// a removed file keeps the last good credentials too
+	assert.NoError(t, os.Remove(path))
+	assert.Error(t, f.Reload())
+	assert.Equal(t, first, clients(t, f))
+
+	// a good update is swapped in
+	assert.NoError(t, os.WriteFile(path, []byte(`{"a": {"client_secret": "s", "app_name": "app"}, "b": {"client_secret": "t", "app_name": "other"}}`), 0o600))
+	assert.NoError(t, f.Reload())
+	assert.NoError(t, f.Health(context.TODO()))
+	assert.Len(t, clients(t, f), 2)
+	assert.Len(t, first, 1)
+}
+
+func TestFile_Write(t *testing.T) {
+	tests := map[string]struct {
+		// file is the credentials file in the directory, the directory itself when empty
+		file string
+		data string
+	}{
+		"json":      {file: "users.json", data: `{"a": {"client_secret": "s", "app_name": "app-a"}}`},
+		"yaml":      {file: "users.yaml", data: "a:\n  client_secret: s\n  app_name: app-a\n"},
+		"directory": {file: "", data: `{"client_secret": "s", "app_name": "app-a"}`},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.TODO()
+			dir := t.TempDir()
+			path := filepath.Join(dir, tt.file)
+			if len(tt.file) == 0 {
+				assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.json"), []byte(tt.data), 0o600))
+			} else {
+				assert.NoError(t, os.WriteFile(path, []byte(tt.data), 0o600))
+			}
+			f, err := NewFile(FileConfig{Path: path})
+			assert.NoError(t, err)
+
+			b := models.Secret{ClientSecret: "t", AppName: "app-b", Scopes: []string{"read"}}
+			assert.NoError(t, f.CreateClient(ctx, "b", b))
+			assert.ErrorIs(t, f.CreateClient(ctx, "b", b), ErrExists)
+			assert.Error(t, f.CreateClient(ctx, "c", models.Secret{AppName: "no secret"}))
+
+			b.Disabled = true
+			assert.NoError(t, f.UpdateClient(ctx, "b", b))
+			assert.ErrorIs(t, f.UpdateClient(ctx, "missing", b), ErrNotFound)
+
+			// the changes are persisted
+			other, err := NewFile(FileConfig{Path: path})
+			assert.NoError(t, err)
+			assert.Equal(t, models.IAM{
+				"a": {ClientSecret: "s", AppName: "app-a"},
+				"b": b,
+			}, clients(t, other))
+
+			assert.NoError(t, f.DeleteClient(ctx, "a"))
+			assert.ErrorIs(t, f.DeleteClient(ctx, "a"), ErrNotFound)
+			assert.Equal(t, models.IAM{"b": b}, clients(t, f))
+			assert.NoError(t, other.Reload())
+			assert.Equal(t, models.IAM{"b": b}, clients(t, other))
+
+			// no temporary files are left behind
+			entries, err := os.ReadDir(dir)
+			assert.NoError(t, err)
+			assert.Len(t, entries, 1)
+		})
+	}
+}
+
+func clients(t *testing.T, f *File) models.IAM {
+	clients, err := f.Clients(context.TODO())
+	assert.NoError(t, err)
+	return clients
+}
@@ -0,0 +1,159 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credentials
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ingka-group/iam-proxy/internal/database"
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+// schema creates the table of the clients, holding the credentials of each client as a JSON document.
+const schema = `CREATE TABLE IF NOT EXISTS iam_clients (
+	client_id   VARCHAR(255) PRIMARY KEY,
+	credentials TEXT NOT NULL
+)`
+
+// SQL holds the client credentials in a database, looking them up on every request.
+type SQL struct {
+	db *database.DB
+}
+
+// NewSQL connects to the database, creating the table of the clients if it does not exist.
+func NewSQL(ctx context.Context, cfg database.Config) (*SQL, error) {
+	db, err := database.Open(ctx, cfg, schema)
+	if err != nil {
+		return nil, err
+	}
+	return &SQL{db: db}, nil
+}
+
+// Client returns the credentials of the client.
+func (s *SQL) Client(ctx context.Context, id models.ClientID) (models.Secret, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, "SELECT credentials FROM iam_clients WHERE client_id = "+s.db.Placeholder(1), string(id)).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Secret{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Secret{}, fmt.Errorf("could not look up client: %w", err)
+	}
+	return decodeClient(id, data)
+}
+
+// Clients returns all client credentials.
+func (s *SQL) Clients(ctx context.Context) (models.IAM, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT client_id, credentials FROM iam_clients")
+	if err != nil {
+		return nil, fmt.Errorf("could not list clients: %w", err)
+	}
+	defer rows.Close()
+
+	clients := models.IAM{}
+	for rows.Next() {
+		var (
+			id   string
+			data []byte
+		)
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("could not list clients: %w", err)
+		}
+		client, err := decodeClient(models.ClientID(id), data)
+		if err != nil {
+			return nil, err
+		}
+		clients[models.ClientID(id)] = client
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not list clients: %w", err)
+	}
+	return clients, nil
+}
+
+// CreateClient adds the client, ErrExists when it exists already.
+func (s *SQL) CreateClient(ctx context.Context, id models.ClientID, client models.Secret) error {
+	data, err := json.Marshal(client)
+	if err != nil {
+		return fmt.Errorf("could not encode client %s: %w", id, err)
+	}
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO iam_clients (client_id, credentials) VALUES (%s, %s) ON CONFLICT (client_id) DO NOTHING",
+		s.db.Placeholder(1), s.db.Placeholder(2)), string(id), string(data))
+	if err != nil {
+		return fmt.Errorf("could not create client %s: %w", id, err)
+	}
+	return affected(res, ErrExists)
+}
+
+// UpdateClient replaces the credentials of the client, ErrNotFound when it does not exist.
+func (s *SQL) UpdateClient(ctx context.Context, id models.ClientID, client models.Secret) error {
+	data, err := json.Marshal(client)
+	if err != nil {
+		return fmt.Errorf("could not encode client %s: %w", id, err)
+	}
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf("UPDATE iam_clients SET credentials = %s WHERE client_id = %s",
+		s.db.Placeholder(1), s.db.Placeholder(2)), string(data), string(id))
+	if err != nil {
+		return fmt.Errorf("could not update client %s: %w", id, err)
+	}
+	return affected(res, ErrNotFound)
+}
+
+// DeleteClient removes the client, ErrNotFound when it does not exist.
+func (s *SQL) DeleteClient(ctx context.Context, id models.ClientID) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM iam_clients WHERE client_id = "+s.db.Placeholder(1), string(id))
+	if err != nil {
+		return fmt.Errorf("could not delete client %s: %w", id, err)
+	}
+	return affected(res, ErrNotFound)
+}
+
+// Health returns an error when the database is not reachable.
+func (s *SQL) Health(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the database.
+func (s *SQL) Close() error {
+	return s.db.Close()
+}
+
+// affected returns errNone when the statement changed no row.
+func affected(res sql.Result, errNone error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not count changed clients: %w", err)
+	}
+	if n == 0 {
+		return errNone
+	}
+	return nil
+}
+
+func decodeClient(id models.ClientID, data []byte) (models.Secret, error) {
+	var client models.Secret
+	if err := json.Unmarshal(data, &client); err != nil {
+		return models.Secret{}, fmt.Errorf("could not decode client %s: %w", id, err)
+	}
+	if err := Validate(models.IAM{id: client}); err != nil {
+		return models.Secret{}, err
+	}
+	return client, nil
+}
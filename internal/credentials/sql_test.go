@@ -0,0 +1,100 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credentials
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ingka-group/iam-proxy/internal/database"
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+func TestSQL(t *testing.T) {
+	ctx := context.TODO()
+	dsn := filepath.Join(t.TempDir(), "clients.db")
+	store, err := NewSQL(ctx, database.Config{Driver: database.DriverSQLite, DSN: dsn})
+	assert.NoError(t, err)
+	defer store.Close()
+
+	assert.NoError(t, store.Health(ctx))
+	clients, err := store.Clients(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, clients)
+
+	_, err = store.db.ExecContext(ctx, "INSERT INTO iam_clients (client_id, credentials) VALUES (?, ?), (?, ?), (?, ?)",
+		"a", `{"client_secret": "s", "app_name": "app-a", "audiences": ["billing"]}`,
+		"b", `{"client_secret": "t", "app_name": "app-b"}`,
+		"broken", `{"app_name": "broken"}`,
+	)
+	assert.NoError(t, err)
+
+	client, err := store.Client(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, models.Secret{ClientSecret: "s", AppName: "app-a", Audiences: []string{"billing"}}, client)
+
+	_, err = store.Client(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.Client(ctx, "broken")
+	assert.Error(t, err)
+	_, err = store.Clients(ctx)
+	assert.Error(t, err)
+
+	_, err = store.db.ExecContext(ctx, "DELETE FROM iam_clients WHERE client_id = ?", "broken")
+	assert.NoError(t, err)
+	clients, err = store.Clients(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, clients, 2)
+
+	// the table is kept when the store is opened again
+	other, err := NewSQL(ctx, database.Config{Driver: database.DriverSQLite, DSN: dsn})
+	assert.NoError(t, err)
+	defer other.Close()
+	clients, err = other.Clients(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, clients, 2)
+
+	// clients are created, updated and deleted
+	c := models.Secret{
+		ClientSecret: "u",
+		AppName:      "app-c",
+		Owner:        models.Owner{Team: "payments"},
+		CreatedAt:    time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Labels:       map[string]string{"cost-center": "42"},
+		Scopes:       []string{"read"},
+	}
+	assert.NoError(t, store.CreateClient(ctx, "c", c))
+	assert.ErrorIs(t, store.CreateClient(ctx, "c", c), ErrExists)
+	c.Disabled = true
+	assert.NoError(t, store.UpdateClient(ctx, "c", c))
+	assert.ErrorIs(t, store.UpdateClient(ctx, "missing", c), ErrNotFound)
+	client, err = other.Client(ctx, "c")
+	assert.NoError(t, err)
+	assert.Equal(t, c, client)
+	assert.NoError(t, store.DeleteClient(ctx, "c"))
+	assert.ErrorIs(t, store.DeleteClient(ctx, "c"), ErrNotFound)
+	_, err = store.Client(ctx, "c")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, store.Close())
+	assert.Error(t, store.Health(ctx))
+
+	_, err = NewSQL(ctx, database.Config{Driver: "mysql"})
+	assert.Error(t, err)
+}
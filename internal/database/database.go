@@ -0,0 +1,79 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package database connects the stores shared by replicas to a SQL database.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	// database drivers of the supported databases
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// Supported database drivers
+const (
+	// DriverSQLite stores the data in a SQLite file, for local runs.
+	DriverSQLite = "sqlite"
+	// DriverPostgres stores the data in PostgreSQL.
+	DriverPostgres = "postgres"
+)
+
+// Config configures the connection to a database.
+type Config struct {
+	// Driver is DriverSQLite or DriverPostgres.
+	Driver string
+	// DSN is the data source name, e.g. a file path for SQLite or a postgres:// URL.
+	DSN string
+}
+
+// DB is a database of one of the supported drivers.
+type DB struct {
+	*sql.DB
+	driver string
+}
+
+// Open connects to the database, creating the tables of the schema if they do not exist.
+func Open(ctx context.Context, cfg Config, schema string) (*DB, error) {
+	switch cfg.Driver {
+	case DriverSQLite, DriverPostgres:
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
+
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("could not open database: %w", err)
+	}
+	if cfg.Driver == DriverSQLite {
+		// SQLite does not allow concurrent writers
+		db.SetMaxOpenConns(1)
+	}
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("could not create the tables: %w", err)
+	}
+	return &DB{DB: db, driver: cfg.Driver}, nil
+}
+
+// Placeholder returns the n-th query parameter in the syntax of the driver.
+func (db *DB) Placeholder(n int) string {
+	if db.driver == DriverPostgres {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
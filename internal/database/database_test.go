@@ -0,0 +1,44 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpen(t *testing.T) {
+	ctx := context.TODO()
+	db, err := Open(ctx, Config{Driver: DriverSQLite, DSN: filepath.Join(t.TempDir(), "test.db")},
+		"CREATE TABLE IF NOT EXISTS test (id INTEGER PRIMARY KEY)")
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, db.PingContext(ctx))
+	assert.Equal(t, "?", db.Placeholder(1))
+
+	_, err = Open(ctx, Config{Driver: DriverSQLite, DSN: filepath.Join(t.TempDir(), "test.db")}, "NOT SQL")
+	assert.Error(t, err)
+	_, err = Open(ctx, Config{Driver: "mysql"}, "")
+	assert.Error(t, err)
+}
+
+func TestDB_Placeholder(t *testing.T) {
+	db := &DB{driver: DriverPostgres}
+	assert.Equal(t, "$1", db.Placeholder(1))
+	assert.Equal(t, "$2", db.Placeholder(2))
+}
@@ -0,0 +1,242 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package keys implements loading of the keys used to sign and verify tokens.
+package keys
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ingka-group/iam-proxy/client/jwk"
+)
+
+const minRSABits = 2048
+
+// ErrUnsupportedKey is returned when a key type or algorithm cannot be used for signing tokens.
+var ErrUnsupportedKey = errors.New("unsupported key")
+
+// Key is a token signing key along with the algorithm it signs with.
+type Key struct {
+	// ID is the key id, by default the RFC 7638 thumbprint of the key.
+	ID     string
+	Method jwt.SigningMethod
+	// private is the key handed to the signing method, []byte for HMAC or a crypto.Signer.
+	// It is nil for keys that only verify tokens.
+	private interface{}
+	// public is the key handed to the signing method on verification.
+	public interface{}
+}
+
+// NewSecret creates an HS512 key from a shared secret.
+func NewSecret(secret []byte) *Key {
+	// RFC 7638 thumbprint of the symmetric JWK {"k":...,"kty":"oct"}
+	sum := sha256.Sum256([]byte(fmt.Sprintf(`{"k":%q,"kty":"oct"}`, base64.RawURLEncoding.EncodeToString(secret))))
+
+	return &Key{
+		ID:      base64.RawURLEncoding.EncodeToString(sum[:]),
+		Method:  jwt.SigningMethodHS512,
+		private: secret,
+		public:  secret,
+	}
+}
+
+// IsPEM reports whether data looks like PEM encoded key material rather than a shared secret.
+func IsPEM(data []byte) bool {
+	return bytes.Contains(data, []byte("-----BEGIN "))
+}
+
+// ParsePEM parses a PEM encoded RSA, ECDSA (P-256, P-384) or Ed25519 key. Private keys sign and verify tokens,
+// public keys only verify them.
+// The signing algorithm is derived from the key type, alg optionally pins it, e.g. to PS256 for an RSA key.
+func ParsePEM(data []byte, alg string) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var (
+		parsed interface{}
+		err    error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: PEM block type %q", ErrUnsupportedKey, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse key: %w", err)
+	}
+
+	var (
+		private interface{}
+		public  crypto.PublicKey
+	)
+	if signer, ok := parsed.(crypto.Signer); ok {
+		private, public = signer, signer.Public()
+	} else {
+		public = parsed
+	}
+
+	method, err := signingMethod(public, alg)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := jwk.New(public)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := pub.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		ID:      kid,
+		Method:  method,
+		private: private,
+		public:  public,
+	}, nil
+}
+
+// NewPublic returns the key verifying tokens with the public key, e.g. of a JSON Web Key. alg optionally pins
+// the signing algorithm as in ParsePEM.
+func NewPublic(public crypto.PublicKey, alg string) (*Key, error) {
+	method, err := signingMethod(public, alg)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := jwk.New(public)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := pub.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	return &Key{ID: kid, Method: method, public: public}, nil
+}
+
+// signingMethod resolves the signing method for the public key, validating alg against the key type when given.
+func signingMethod(pub crypto.PublicKey, alg string) (jwt.SigningMethod, error) {
+	var allowed []jwt.SigningMethod
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("%w: RSA keys must be at least %d bits", ErrUnsupportedKey, minRSABits)
+		}
+		allowed = []jwt.SigningMethod{
+			jwt.SigningMethodRS256, jwt.SigningMethodRS384, jwt.SigningMethodRS512,
+			jwt.SigningMethodPS256, jwt.SigningMethodPS384, jwt.SigningMethodPS512,
+		}
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			allowed = []jwt.SigningMethod{jwt.SigningMethodES256}
+		case elliptic.P384():
+			allowed = []jwt.SigningMethod{jwt.SigningMethodES384}
+		default:
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, k.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		allowed = []jwt.SigningMethod{jwt.SigningMethodEdDSA}
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, pub)
+	}
+
+	if len(alg) == 0 {
+		return allowed[0], nil
+	}
+	for _, m := range allowed {
+		if m.Alg() == alg {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: algorithm %s does not match the key type", ErrUnsupportedKey, alg)
+}
+
+// SigningKey returns the key to sign tokens with.
+func (k *Key) SigningKey() interface{} {
+	return k.private
+}
+
+// VerificationKey returns the key to verify token signatures with.
+func (k *Key) VerificationKey() interface{} {
+	return k.public
+}
+
+// JWK returns the public JSON Web Key of an asymmetric key.
+func (k *Key) JWK() (jwk.Key, error) {
+	if k.Symmetric() {
+		return jwk.Key{}, fmt.Errorf("%w: shared secrets cannot be published", ErrUnsupportedKey)
+	}
+	pub, err := jwk.New(k.public)
+	if err != nil {
+		return jwk.Key{}, err
+	}
+	pub.KeyID = k.ID
+	pub.Use = jwk.UseSignature
+	pub.Algorithm = k.Method.Alg()
+	return pub, nil
+}
+
+// CanSign reports whether the key holds the private part needed to sign tokens.
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// Symmetric reports whether the key is a shared HMAC secret.
+func (k *Key) Symmetric() bool {
+	_, ok := k.Method.(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+// Empty reports whether the key is a shared secret of zero length.
+func (k *Key) Empty() bool {
+	secret, ok := k.public.([]byte)
+	return ok && len(secret) == 0
+}
+
+// Accepts reports whether a token signed with the given method can be verified with the key.
+// HMAC secrets accept any HMAC variant, asymmetric keys only the algorithm they were loaded with.
+func (k *Key) Accepts(m jwt.SigningMethod) bool {
+	if k.Symmetric() {
+		_, ok := m.(*jwt.SigningMethodHMAC)
+		return ok
+	}
+	return m.Alg() == k.Method.Alg()
+}
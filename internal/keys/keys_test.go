@@ -0,0 +1,178 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePEM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	smallRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+	p521Key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	ecDER, err := x509.MarshalECPrivateKey(p256Key)
+	assert.NoError(t, err)
+
+	type test struct {
+		pem []byte
+		alg string
+		exp string
+		err bool
+	}
+
+	tests := map[string]test{
+		"rsa pkcs8": {
+			pem: pkcs8PEM(t, rsaKey),
+			exp: "RS256",
+		},
+		"rsa pkcs1": {
+			pem: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+			exp: "RS256",
+		},
+		"rsa pinned": {
+			pem: pkcs8PEM(t, rsaKey),
+			alg: "PS384",
+			exp: "PS384",
+		},
+		"rsa too small": {
+			pem: pkcs8PEM(t, smallRSAKey),
+			err: true,
+		},
+		"ec p256": {
+			pem: pkcs8PEM(t, p256Key),
+			exp: "ES256",
+		},
+		"ec sec1": {
+			pem: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}),
+			exp: "ES256",
+		},
+		"ec p384": {
+			pem: pkcs8PEM(t, p384Key),
+			exp: "ES384",
+		},
+		"ec unsupported curve": {
+			pem: pkcs8PEM(t, p521Key),
+			err: true,
+		},
+		"ec algorithm mismatch": {
+			pem: pkcs8PEM(t, p256Key),
+			alg: "ES384",
+			err: true,
+		},
+		"ed25519": {
+			pem: pkcs8PEM(t, edKey),
+			exp: "EdDSA",
+		},
+		"no pem": {
+			pem: []byte("secret"),
+			err: true,
+		},
+		"public key": {
+			pem: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{}}),
+			err: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			key, err := ParsePEM(tt.pem, tt.alg)
+			if tt.err {
+				assert.Error(t, err)
+				assert.Nil(t, key)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.exp, key.Method.Alg())
+			assert.False(t, key.Symmetric())
+
+			token, err := jwt.NewWithClaims(key.Method, jwt.MapClaims{"sub": "test"}).SignedString(key.SigningKey())
+			assert.NoError(t, err)
+
+			_, err = jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+				assert.True(t, key.Accepts(token.Method))
+				return key.VerificationKey(), nil
+			})
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestKey_Accepts(t *testing.T) {
+	secret := NewSecret([]byte("secret"))
+	assert.True(t, secret.Symmetric())
+	assert.False(t, secret.Empty())
+	assert.True(t, NewSecret(nil).Empty())
+	assert.True(t, secret.Accepts(jwt.SigningMethodHS256))
+	assert.True(t, secret.Accepts(jwt.SigningMethodHS512))
+	assert.False(t, secret.Accepts(jwt.SigningMethodRS256))
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	key, err := ParsePEM(pkcs8PEM(t, ecKey), "")
+	assert.NoError(t, err)
+	assert.True(t, key.Accepts(jwt.SigningMethodES256))
+	assert.False(t, key.Accepts(jwt.SigningMethodHS512))
+	assert.False(t, key.Empty())
+}
+
+func TestNewPublic(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	private, err := ParsePEM(pkcs8PEM(t, ecKey), "")
+	assert.NoError(t, err)
+
+	key, err := NewPublic(&ecKey.PublicKey, "ES256")
+	assert.NoError(t, err)
+	assert.Equal(t, private.ID, key.ID)
+	assert.Equal(t, "ES256", key.Method.Alg())
+	assert.Nil(t, key.SigningKey())
+
+	token, err := jwt.NewWithClaims(private.Method, jwt.MapClaims{"sub": "test"}).SignedString(private.SigningKey())
+	assert.NoError(t, err)
+	_, err = jwt.Parse(token, func(*jwt.Token) (interface{}, error) {
+		return key.VerificationKey(), nil
+	})
+	assert.NoError(t, err)
+
+	_, err = NewPublic(&ecKey.PublicKey, "RS256")
+	assert.ErrorIs(t, err, ErrUnsupportedKey)
+}
+
+func pkcs8PEM(t *testing.T, key interface{}) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
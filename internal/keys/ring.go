@@ -0,0 +1,97 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keys
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Ring holds the active signing key along with any number of keys that only verify tokens.
+//
+// A key is rotated by adding the new key to the ring, promoting it to the active key once every
+// replica knows it, and removing the old key after the longest token lifetime has passed.
+type Ring struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+// NewRing creates a key ring that signs with the active key and verifies with all given keys.
+func NewRing(active *Key, others ...*Key) (*Ring, error) {
+	if !active.CanSign() {
+		return nil, fmt.Errorf("active key %s cannot sign tokens", active.ID)
+	}
+
+	r := &Ring{
+		active: active,
+		keys:   map[string]*Key{active.ID: active},
+	}
+	for _, k := range others {
+		if existing, ok := r.keys[k.ID]; ok {
+			if existing == k {
+				continue
+			}
+			return nil, fmt.Errorf("duplicate key id %s", k.ID)
+		}
+		r.keys[k.ID] = k
+	}
+	return r, nil
+}
+
+// Active returns the key that signs new tokens.
+func (r *Ring) Active() *Key {
+	return r.active
+}
+
+// Key returns the key with the given key id.
+func (r *Ring) Key(kid string) (*Key, bool) {
+	k, ok := r.keys[kid]
+	return k, ok
+}
+
+// Keys returns all keys of the ring, the active key first and the others ordered by key id.
+func (r *Ring) Keys() []*Key {
+	others := make([]*Key, 0, len(r.keys)-1)
+	for _, k := range r.keys {
+		if k != r.active {
+			others = append(others, k)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].ID < others[j].ID
+	})
+	return append([]*Key{r.active}, others...)
+}
+
+// VerificationKeys returns the keys that may have signed a token with the given key id and signing method.
+// Tokens without a key id predate the key ring and are checked against every key accepting the method.
+func (r *Ring) VerificationKeys(kid string, m jwt.SigningMethod) []*Key {
+	if len(kid) > 0 {
+		if k, ok := r.keys[kid]; ok && k.Accepts(m) {
+			return []*Key{k}
+		}
+		return nil
+	}
+
+	var keys []*Key
+	for _, k := range r.Keys() {
+		if k.Accepts(m) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,68 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	active := NewSecret([]byte("active"))
+	active.ID = "b"
+	other := NewSecret([]byte("other"))
+	other.ID = "a"
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	assert.NoError(t, err)
+	public, err := ParsePEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), "")
+	assert.NoError(t, err)
+	assert.False(t, public.CanSign())
+	public.ID = "c"
+
+	ring, err := NewRing(active, other, public, active)
+	assert.NoError(t, err)
+	assert.Equal(t, active, ring.Active())
+	assert.Equal(t, []*Key{active, other, public}, ring.Keys())
+
+	k, ok := ring.Key("a")
+	assert.True(t, ok)
+	assert.Equal(t, other, k)
+	_, ok = ring.Key("d")
+	assert.False(t, ok)
+
+	assert.Equal(t, []*Key{other}, ring.VerificationKeys("a", jwt.SigningMethodHS256))
+	assert.Empty(t, ring.VerificationKeys("a", jwt.SigningMethodES256))
+	assert.Empty(t, ring.VerificationKeys("d", jwt.SigningMethodHS256))
+	assert.Equal(t, []*Key{active, other}, ring.VerificationKeys("", jwt.SigningMethodHS512))
+	assert.Equal(t, []*Key{public}, ring.VerificationKeys("", jwt.SigningMethodES256))
+
+	_, err = NewRing(public)
+	assert.Error(t, err)
+
+	duplicate := NewSecret([]byte("duplicate"))
+	duplicate.ID = "a"
+	_, err = NewRing(active, other, duplicate)
+	assert.Error(t, err)
+}
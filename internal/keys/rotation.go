@@ -0,0 +1,442 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	manifestFile = "keyring.json"
+	lockFile     = "keyring.lock"
+
+	// checkInterval is how often the key directory is reloaded and checked for due rotations.
+	checkInterval = time.Minute
+	// activationDelay is how long a new key is only published before it signs tokens, so every
+	// replica sharing the directory and every cached key set knows it by then.
+	activationDelay = 10 * time.Minute
+	// staleLock is the age after which a lock left behind by a crashed replica is broken.
+	staleLock = time.Minute
+	// firstKeyRetry is how often a replica waiting for the first key of another replica checks for it.
+	firstKeyRetry = time.Second
+	// firstKeyTimeout bounds the wait for the first key, long enough to break the lock of a crashed replica.
+	firstKeyTimeout = 2 * staleLock
+
+	// DefaultAlgorithm is the algorithm of generated keys when none is configured.
+	DefaultAlgorithm = "ES256"
+)
+
+// RotatorConfig configures automatic key rotation.
+type RotatorConfig struct {
+	// Dir persists the generated keys.
+	Dir string
+	// Algorithm of the generated keys.
+	Algorithm string
+	// Interval is how long a key signs tokens before it is replaced.
+	Interval time.Duration
+	// Retention is how long a replaced key keeps verifying tokens before it is pruned.
+	Retention time.Duration
+	// Static keys are added to the ring to verify tokens only.
+	Static []*Key
+	Logger *zap.SugaredLogger
+}
+
+var errNoActiveKey = errors.New("no active signing key")
+
+// Rotator generates a new signing key on a schedule, keeping the key ring persisted in a directory.
+// Replicas sharing the directory share the keys.
+type Rotator struct {
+	cfg  RotatorConfig
+	ring atomic.Pointer[Ring]
+}
+
+// manifest describes the persisted keys.
+type manifest struct {
+	Keys []manifestKey `json:"keys"`
+}
+
+type manifestKey struct {
+	ID          string    `json:"kid"`
+	Algorithm   string    `json:"alg"`
+	CreatedAt   time.Time `json:"created_at"`
+	ActivatesAt time.Time `json:"activates_at"`
+	RetiredAt   time.Time `json:"retired_at,omitempty"`
+}
+
+// NewRotator loads the persisted keys, generating the first key if there is none. When another replica
+// is generating the first key, it waits for it until the context is cancelled.
+func NewRotator(ctx context.Context, cfg RotatorConfig) (*Rotator, error) {
+	if cfg.Interval <= 0 {
+		return nil, errors.New("key rotation interval must be positive")
+	}
+	if cfg.Retention < 0 {
+		return nil, errors.New("key retention must not be negative")
+	}
+	if len(cfg.Algorithm) == 0 {
+		cfg.Algorithm = DefaultAlgorithm
+	}
+	if _, ok := generators[cfg.Algorithm]; !ok {
+		return nil, fmt.Errorf("%w: cannot generate keys for algorithm %q", ErrUnsupportedKey, cfg.Algorithm)
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop().Sugar()
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("could not create key directory: %w", err)
+	}
+
+	r := &Rotator{cfg: cfg}
+	if err := r.awaitFirstKey(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// awaitFirstKey loads the keys, retrying while another replica holds the lock of an empty directory.
+func (r *Rotator) awaitFirstKey(ctx context.Context) error {
+	err := r.Rotate(time.Now())
+	if !errors.Is(err, errNoActiveKey) {
+		return err
+	}
+	r.cfg.Logger.Infow("Waiting for another replica to generate the first signing key", "dir", r.cfg.Dir)
+
+	ctx, cancel := context.WithTimeout(ctx, firstKeyTimeout)
+	defer cancel()
+	ticker := time.NewTicker(firstKeyRetry)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", err, ctx.Err())
+		case now := <-ticker.C:
+			if err = r.Rotate(now); !errors.Is(err, errNoActiveKey) {
+				return err
+			}
+		}
+	}
+}
+
+// Ring returns the current key ring.
+func (r *Rotator) Ring() *Ring {
+	return r.ring.Load()
+}
+
+// Run checks for due rotations until the context is cancelled.
+func (r *Rotator) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := r.Rotate(now); err != nil {
+				r.cfg.Logger.Errorw("Failed to rotate signing keys", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Rotate generates a new key once the active key is due for replacement, prunes retired keys and reloads the ring.
+// When another replica holds the lock, the keys are only reloaded.
+func (r *Rotator) Rotate(now time.Time) error {
+	unlock, locked, err := r.lock(now)
+	if err != nil {
+		return err
+	}
+	if locked {
+		defer unlock()
+	}
+
+	m, err := r.loadManifest()
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		changed, err := r.update(&m, now)
+		if err != nil {
+			return err
+		}
+		if changed {
+			if err := r.saveManifest(m); err != nil {
+				return err
+			}
+		}
+	}
+
+	ring, err := r.load(m, now)
+	if err != nil {
+		return err
+	}
+	r.ring.Store(ring)
+	return nil
+}
+
+// update generates and prunes keys in the manifest, reporting whether it changed.
+func (r *Rotator) update(m *manifest, now time.Time) (bool, error) {
+	changed := false
+
+	current, pending := m.active(now), false
+	for _, k := range m.Keys {
+		if k.ActivatesAt.After(now) {
+			pending = true
+		}
+	}
+
+	switch {
+	case current == nil && !pending:
+		// the first key signs right away as there is no other
+		if err := r.generate(m, now, now); err != nil {
+			return false, err
+		}
+		changed = true
+	case current != nil && !pending && !now.Before(current.ActivatesAt.Add(r.cfg.Interval-activationDelay)):
+		activatesAt := current.ActivatesAt.Add(r.cfg.Interval)
+		if earliest := now.Add(activationDelay); activatesAt.Before(earliest) {
+			activatesAt = earliest
+		}
+		// current points into the keys, so it is retired before a key is appended
+		current.RetiredAt = activatesAt.UTC()
+		if err := r.generate(m, now, activatesAt); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	kept := m.Keys[:0]
+	for _, k := range m.Keys {
+		if !k.RetiredAt.IsZero() && !now.Before(k.RetiredAt.Add(r.cfg.Retention)) {
+			if err := os.Remove(r.keyPath(k.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return false, fmt.Errorf("could not remove retired key %s: %w", k.ID, err)
+			}
+			r.cfg.Logger.Infow("Pruned retired signing key", "kid", k.ID)
+			changed = true
+			continue
+		}
+		kept = append(kept, k)
+	}
+	m.Keys = kept
+
+	return changed, nil
+}
+
+func (r *Rotator) generate(m *manifest, now, activatesAt time.Time) error {
+	key, pemData, err := Generate(r.cfg.Algorithm)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(r.keyPath(key.ID), pemData); err != nil {
+		return fmt.Errorf("could not persist key %s: %w", key.ID, err)
+	}
+	m.Keys = append(m.Keys, manifestKey{
+		ID:          key.ID,
+		Algorithm:   key.Method.Alg(),
+		CreatedAt:   now.UTC(),
+		ActivatesAt: activatesAt.UTC(),
+	})
+	r.cfg.Logger.Infow("Generated signing key", "kid", key.ID, "alg", key.Method.Alg(), "activates_at", activatesAt)
+	return nil
+}
+
+// load builds the key ring from the manifest.
+func (r *Rotator) load(m manifest, now time.Time) (*Ring, error) {
+	current := m.active(now)
+	if current == nil {
+		return nil, errNoActiveKey
+	}
+
+	var (
+		active *Key
+		others []*Key
+	)
+	for _, k := range m.Keys {
+		b, err := os.ReadFile(r.keyPath(k.ID))
+		if err != nil {
+			return nil, fmt.Errorf("could not read key %s: %w", k.ID, err)
+		}
+		key, err := ParsePEM(b, k.Algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse key %s: %w", k.ID, err)
+		}
+		key.ID = k.ID
+		if k.ID == current.ID {
+			active = key
+			continue
+		}
+		others = append(others, key)
+	}
+	return NewRing(active, append(others, r.cfg.Static...)...)
+}
+
+// active returns the most recently activated key.
+func (m *manifest) active(now time.Time) *manifestKey {
+	var active *manifestKey
+	for i := range m.Keys {
+		k := &m.Keys[i]
+		if k.ActivatesAt.After(now) {
+			continue
+		}
+		if active == nil || k.ActivatesAt.After(active.ActivatesAt) {
+			active = k
+		}
+	}
+	return active
+}
+
+func (r *Rotator) loadManifest() (manifest, error) {
+	var m manifest
+	b, err := os.ReadFile(filepath.Join(r.cfg.Dir, manifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return m, fmt.Errorf("could not read key manifest: %w", err)
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("could not decode key manifest: %w", err)
+	}
+	sort.SliceStable(m.Keys, func(i, j int) bool {
+		return m.Keys[i].ActivatesAt.Before(m.Keys[j].ActivatesAt)
+	})
+	return m, nil
+}
+
+func (r *Rotator) saveManifest(m manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(r.cfg.Dir, manifestFile), b); err != nil {
+		return fmt.Errorf("could not persist key manifest: %w", err)
+	}
+	return nil
+}
+
+// lock takes the directory lock, reporting false when another replica holds it.
+func (r *Rotator) lock(now time.Time) (func(), bool, error) {
+	path := filepath.Join(r.cfg.Dir, lockFile)
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		info, statErr := os.Stat(path)
+		if statErr != nil || now.Sub(info.ModTime()) < staleLock {
+			return nil, false, nil
+		}
+		r.cfg.Logger.Warnw("Breaking stale key directory lock", "modified", info.ModTime())
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, false, fmt.Errorf("could not break stale lock: %w", err)
+		}
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			return nil, false, nil
+		}
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("could not lock key directory: %w", err)
+	}
+	_ = f.Close()
+
+	return func() { _ = os.Remove(path) }, true, nil
+}
+
+func (r *Rotator) keyPath(kid string) string {
+	return filepath.Join(r.cfg.Dir, kid+".pem")
+}
+
+// writeFile replaces the file atomically, so readers never see partial content.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// generators create the private keys of the algorithms keys can be generated for.
+var generators = map[string]func() (crypto.Signer, error){
+	"RS256": generateRSA,
+	"RS384": generateRSA,
+	"RS512": generateRSA,
+	"PS256": generateRSA,
+	"PS384": generateRSA,
+	"PS512": generateRSA,
+	"ES256": func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P256(), rand.Reader) },
+	"ES384": func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P384(), rand.Reader) },
+	"EdDSA": func() (crypto.Signer, error) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	},
+}
+
+func generateRSA() (crypto.Signer, error) {
+	return rsa.GenerateKey(rand.Reader, minRSABits)
+}
+
+// Generate creates a new private key for the algorithm, returning it along with its PEM encoding.
+func Generate(alg string) (*Key, []byte, error) {
+	generate, ok := generators[alg]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: cannot generate keys for algorithm %q", ErrUnsupportedKey, alg)
+	}
+	priv, err := generate()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not generate key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not encode key: %w", err)
+	}
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	key, err := ParsePEM(pemData, alg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, pemData, nil
+}
@@ -0,0 +1,181 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keys
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestGenerate(t *testing.T) {
+	type test struct {
+		alg string
+		err bool
+	}
+
+	tests := map[string]test{
+		"rs256": {alg: "RS256"},
+		"ps256": {alg: "PS256"},
+		"es256": {alg: "ES256"},
+		"es384": {alg: "ES384"},
+		"eddsa": {alg: "EdDSA"},
+		"hs256": {alg: "HS256", err: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			key, pemData, err := Generate(tt.alg)
+			if tt.err {
+				assert.ErrorIs(t, err, ErrUnsupportedKey)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, key.CanSign())
+			assert.Equal(t, tt.alg, key.Method.Alg())
+
+			parsed, err := ParsePEM(pemData, tt.alg)
+			assert.NoError(t, err)
+			assert.Equal(t, key.ID, parsed.ID)
+		})
+	}
+}
+
+func TestRotator(t *testing.T) {
+	dir := t.TempDir()
+	static := NewSecret([]byte("static"))
+	cfg := RotatorConfig{
+		Dir:       dir,
+		Interval:  24 * time.Hour,
+		Retention: 2 * time.Hour,
+		Static:    []*Key{static},
+	}
+
+	r, err := NewRotator(context.TODO(), cfg)
+	assert.NoError(t, err)
+	start := time.Now()
+	first := r.Ring().Active()
+	assert.Equal(t, DefaultAlgorithm, first.Method.Alg())
+	assert.Equal(t, []*Key{first, static}, r.Ring().Keys())
+	assert.FileExists(t, filepath.Join(dir, first.ID+".pem"))
+
+	// not due yet
+	assert.NoError(t, r.Rotate(start.Add(time.Hour)))
+	assert.Len(t, r.Ring().Keys(), 2)
+
+	// the next key is published ahead of signing
+	assert.NoError(t, r.Rotate(start.Add(cfg.Interval-activationDelay)))
+	assert.Equal(t, first.ID, r.Ring().Active().ID)
+	assert.Len(t, r.Ring().Keys(), 3)
+
+	// a replica sharing the directory loads the same keys
+	replica, err := NewRotator(context.TODO(), cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, first.ID, replica.Ring().Active().ID)
+	assert.Len(t, replica.Ring().Keys(), 3)
+
+	// the next key signs once due, the replaced key still verifies
+	assert.NoError(t, r.Rotate(start.Add(cfg.Interval)))
+	second := r.Ring().Active()
+	assert.NotEqual(t, first.ID, second.ID)
+	_, ok := r.Ring().Key(first.ID)
+	assert.True(t, ok)
+
+	assert.NoError(t, replica.Rotate(start.Add(cfg.Interval)))
+	assert.Equal(t, second.ID, replica.Ring().Active().ID)
+
+	// the replaced key is pruned after the retention
+	assert.NoError(t, r.Rotate(start.Add(cfg.Interval+cfg.Retention)))
+	_, ok = r.Ring().Key(first.ID)
+	assert.False(t, ok)
+	assert.Equal(t, second.ID, r.Ring().Active().ID)
+	assert.NoFileExists(t, filepath.Join(dir, first.ID+".pem"))
+}
+
+func TestRotator_Lock(t *testing.T) {
+	cfg := RotatorConfig{Interval: time.Hour}
+
+	// another replica is generating the first key
+	cfg.Dir = t.TempDir()
+	lock := filepath.Join(cfg.Dir, lockFile)
+	assert.NoError(t, os.WriteFile(lock, nil, 0o600))
+	ctx, cancel := context.WithTimeout(context.TODO(), 2*firstKeyRetry)
+	defer cancel()
+	_, err := NewRotator(ctx, cfg)
+	assert.ErrorIs(t, err, errNoActiveKey)
+
+	// the replica waits for the first key of the lock holder
+	holder := make(chan *Rotator, 1)
+	go func() {
+		defer close(holder)
+		time.Sleep(firstKeyRetry / 2)
+		r := &Rotator{cfg: RotatorConfig{Dir: cfg.Dir, Algorithm: DefaultAlgorithm, Interval: cfg.Interval, Logger: zap.NewNop().Sugar()}}
+		m := manifest{}
+		if _, err := r.update(&m, time.Now()); err == nil && r.saveManifest(m) == nil {
+			holder <- r
+		}
+		_ = os.Remove(lock)
+	}()
+	waiting, err := NewRotator(context.TODO(), cfg)
+	assert.NoError(t, err)
+	if first, ok := <-holder; assert.True(t, ok) {
+		assert.NoError(t, first.Rotate(time.Now()))
+		assert.Equal(t, first.Ring().Active().ID, waiting.Ring().Active().ID)
+	}
+
+	// the lock of a crashed replica is broken
+	cfg.Dir = t.TempDir()
+	lock = filepath.Join(cfg.Dir, lockFile)
+	assert.NoError(t, os.WriteFile(lock, nil, 0o600))
+
+	// the lock of a crashed replica is broken
+	old := time.Now().Add(-2 * staleLock)
+	assert.NoError(t, os.Chtimes(lock, old, old))
+	r, err := NewRotator(context.TODO(), cfg)
+	assert.NoError(t, err)
+	assert.True(t, r.Ring().Active().CanSign())
+	assert.NoFileExists(t, lock)
+}
+
+func TestNewRotator_Invalid(t *testing.T) {
+	type test struct {
+		cfg RotatorConfig
+	}
+
+	tests := map[string]test{
+		"no interval": {
+			cfg: RotatorConfig{},
+		},
+		"negative retention": {
+			cfg: RotatorConfig{Interval: time.Hour, Retention: -time.Hour},
+		},
+		"symmetric algorithm": {
+			cfg: RotatorConfig{Interval: time.Hour, Algorithm: "HS512"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tt.cfg.Dir = t.TempDir()
+			_, err := NewRotator(context.TODO(), tt.cfg)
+			assert.Error(t, err)
+		})
+	}
+}
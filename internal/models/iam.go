@@ -14,7 +14,10 @@
 
 package models
 
-import "time"
+import (
+	"slices"
+	"time"
+)
 
 // IAM is the collection of all valid client credentials and tokens.
 type IAM map[ClientID]Secret
@@ -22,11 +25,146 @@
 // ClientID defines a client id token.
 type ClientID string
 
+// Client authentication methods, see RFC 7591 section 2.
+const (
+	// AuthMethodClientSecret is the authentication with a client secret, by HTTP Basic authentication or the
+	// request body.
+	AuthMethodClientSecret = "client_secret_basic"
+	// AuthMethodClientSecretPost is the authentication with a client secret in the request body, as published in
+	// the server metadata. Clients of AuthMethodClientSecret may use either.
+	AuthMethodClientSecretPost = "client_secret_post"
+	// AuthMethodPrivateKeyJWT is the authentication with a JWT signed by the client, see RFC 7523.
+	AuthMethodPrivateKeyJWT = "private_key_jwt"
+	// AuthMethodTLSClientAuth is the authentication with a TLS client certificate issued by a trusted
+	// certificate authority, see RFC 8705 section 2.1.
+	AuthMethodTLSClientAuth = "tls_client_auth"
+)
+
 // Secret holds information on the client secret key.
 type Secret struct {
-	// ClientSecret is the client secret key for the corresponding client id
-	ClientSecret string `json:"client_secret"`
+	// ClientSecret is the hash of the client secret for the corresponding client id in PHC string format,
+	// e.g. $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>. Plaintext secrets are deprecated.
+	ClientSecret string `json:"client_secret" yaml:"client_secret"`
 	// AppName defines the application that uses this credential
-	AppName        string    `json:"app_name"`
-	ExpirationDate time.Time `json:"-"`
+	AppName string `json:"app_name" yaml:"app_name"`
+	// Description optionally tells what the client is used for.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Owner optionally is the team responsible for the client.
+	Owner Owner `json:"owner,omitzero" yaml:"owner,omitempty"`
+	// CreatedAt is when the client was created, if known.
+	CreatedAt time.Time `json:"created_at,omitzero" yaml:"created_at,omitempty"`
+	// Labels are arbitrary key-value pairs, e.g. for cost allocation.
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	// Disabled clients cannot obtain tokens.
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	// GrantTypes lists the grant types the client may use, client_credentials only when empty.
+	GrantTypes []string `json:"grant_types,omitempty" yaml:"grant_types,omitempty"`
+	// ExpiresIn optionally overrides the lifetime in seconds of the client's access tokens. The client may
+	// request shorter lifetimes only.
+	ExpiresIn int64 `json:"expires_in,omitempty" yaml:"expires_in,omitempty"`
+	// IdentityExpiresIn optionally overrides the lifetime in seconds of the client's identity tokens.
+	IdentityExpiresIn int64 `json:"identity_expires_in,omitempty" yaml:"identity_expires_in,omitempty"`
+	// Audiences lists the audiences the client may request tokens for.
+	Audiences []string `json:"audiences,omitempty" yaml:"audiences,omitempty"`
+	// Scopes lists the scopes the client may request.
+	Scopes []string `json:"scopes,omitempty" yaml:"scopes,omitempty"`
+	// TokenExchange is the policy of the client exchanging the tokens of its callers.
+	TokenExchange TokenExchange `json:"token_exchange,omitzero" yaml:"token_exchange,omitempty"`
+	// ExpirationDate is when ClientSecret expires, it does not expire when unset.
+	ExpirationDate time.Time `json:"expiration_date,omitzero" yaml:"expiration_date,omitempty"`
+	// ClientSecrets are further secrets of the client, so a secret can be rolled with overlap.
+	ClientSecrets []ClientSecret `json:"client_secrets,omitempty" yaml:"client_secrets,omitempty"`
+	// TokenEndpointAuthMethod is how the client authenticates, AuthMethodClientSecret when empty.
+	TokenEndpointAuthMethod string `json:"token_endpoint_auth_method,omitempty" yaml:"token_endpoint_auth_method,omitempty"`
+	// PublicKey is the PEM encoded public key verifying the client assertions of AuthMethodPrivateKeyJWT.
+	PublicKey string `json:"public_key,omitempty" yaml:"public_key,omitempty"`
+	// JWKSURI is the URL of the key set verifying the client assertions, instead of PublicKey.
+	JWKSURI string `json:"jwks_uri,omitempty" yaml:"jwks_uri,omitempty"`
+	// TLSClientAuth tells the certificate of a client of AuthMethodTLSClientAuth.
+	TLSClientAuth TLSClientAuth `json:"tls_client_auth,omitzero" yaml:"tls_client_auth,omitempty"`
+	// TLSClientCertificateBoundAccessTokens binds the access tokens of the client to its TLS client
+	// certificate, which it must present on token requests.
+	TLSClientCertificateBoundAccessTokens bool `json:"tls_client_certificate_bound_access_tokens,omitempty" yaml:"tls_client_certificate_bound_access_tokens,omitempty"`
+	// DPoPBoundAccessTokens requires a DPoP proof with every token request of the client, binding its access
+	// tokens to the key of the proof, see RFC 9449 section 5.2.
+	DPoPBoundAccessTokens bool `json:"dpop_bound_access_tokens,omitempty" yaml:"dpop_bound_access_tokens,omitempty"`
+}
+
+// Owner is the team responsible for a client.
+type Owner struct {
+	Team string `json:"team,omitempty" yaml:"team,omitempty"`
+	// Contact is how to reach the team, e.g. an email address or a chat channel.
+	Contact string `json:"contact,omitempty" yaml:"contact,omitempty"`
+}
+
+// TokenExchange is the policy of a client exchanging the tokens of its callers, see RFC 8693.
+type TokenExchange struct {
+	// Audiences lists the audiences the client may exchange tokens for.
+	Audiences []string `json:"audiences,omitempty" yaml:"audiences,omitempty"`
+	// Subjects optionally lists the clients whose tokens the client may exchange, any client when empty.
+	Subjects []string `json:"subjects,omitempty" yaml:"subjects,omitempty"`
+}
+
+// TLSClientAuth matches the TLS client certificate of a client, see RFC 8705 section 2.1.2. Exactly one of the
+// fields is set.
+type TLSClientAuth struct {
+	// SubjectDN is the subject distinguished name of the certificate, as in RFC 4514, e.g. CN=billing,O=Example.
+	SubjectDN string `json:"subject_dn,omitempty" yaml:"subject_dn,omitempty"`
+	// SANDNS, SANURI, SANIP and SANEmail are a subject alternative name of the certificate.
+	SANDNS   string `json:"san_dns,omitempty" yaml:"san_dns,omitempty"`
+	SANURI   string `json:"san_uri,omitempty" yaml:"san_uri,omitempty"`
+	SANIP    string `json:"san_ip,omitempty" yaml:"san_ip,omitempty"`
+	SANEmail string `json:"san_email,omitempty" yaml:"san_email,omitempty"`
+}
+
+// ClientSecret is a secret of a client valid for a period of time.
+type ClientSecret struct {
+	// Secret is the hash of the secret, see Secret.ClientSecret.
+	Secret string `json:"secret" yaml:"secret"`
+	// NotBefore optionally is when the secret becomes valid.
+	NotBefore time.Time `json:"not_before,omitzero" yaml:"not_before,omitempty"`
+	// ExpiresAt optionally is when the secret expires.
+	ExpiresAt time.Time `json:"expires_at,omitzero" yaml:"expires_at,omitempty"`
+}
+
+// Secrets returns all secrets of the client.
+func (s Secret) Secrets() []ClientSecret {
+	secrets := make([]ClientSecret, 0, len(s.ClientSecrets)+1)
+	if len(s.ClientSecret) > 0 {
+		secrets = append(secrets, ClientSecret{Secret: s.ClientSecret, ExpiresAt: s.ExpirationDate})
+	}
+	return append(secrets, s.ClientSecrets...)
+}
+
+// UsesClientSecret tells whether the client authenticates with a secret.
+func (s Secret) UsesClientSecret() bool {
+	return len(s.TokenEndpointAuthMethod) == 0 || s.TokenEndpointAuthMethod == AuthMethodClientSecret
+}
+
+// UsesPrivateKeyJWT tells whether the client authenticates with signed client assertions instead of secrets.
+func (s Secret) UsesPrivateKeyJWT() bool {
+	return s.TokenEndpointAuthMethod == AuthMethodPrivateKeyJWT
+}
+
+// UsesTLSClientAuth tells whether the client authenticates with a TLS client certificate instead of secrets.
+func (s Secret) UsesTLSClientAuth() bool {
+	return s.TokenEndpointAuthMethod == AuthMethodTLSClientAuth
+}
+
+// AllowsGrantType tells whether the client may use the grant type.
+func (s Secret) AllowsGrantType(grantType string) bool {
+	if len(s.GrantTypes) == 0 {
+		return grantType == GrantTypeClientCredentials
+	}
+	return slices.Contains(s.GrantTypes, grantType)
+}
+
+// Expired tells whether the secret has expired at the given time.
+func (c ClientSecret) Expired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && !now.Before(c.ExpiresAt)
+}
+
+// Pending tells whether the secret is not valid yet at the given time.
+func (c ClientSecret) Pending(now time.Time) bool {
+	return !c.NotBefore.IsZero() && now.Before(c.NotBefore)
 }
@@ -0,0 +1,224 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"crypto/x509"
+	"time"
+)
+
+// TokenUse tells the kinds of issued tokens apart.
+type TokenUse string
+
+// Valid token uses
+const (
+	// TokenUseAccess marks access tokens, which authorize requests.
+	TokenUseAccess TokenUse = "access"
+	// TokenUseIdentity marks identity tokens, which carry the application name.
+	TokenUseIdentity TokenUse = "id"
+)
+
+// Supported grant types
+const (
+	// GrantTypeClientCredentials is the grant of clients authenticating with their own credentials.
+	GrantTypeClientCredentials = "client_credentials"
+	// GrantTypeRefreshToken is the grant of clients presenting a refresh token. Clients allowed it receive
+	// a refresh token along with their access tokens.
+	GrantTypeRefreshToken = "refresh_token"
+	// GrantTypeTokenExchange is the grant of clients exchanging the token of their caller for a token to
+	// call another service on its behalf, see RFC 8693.
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+// Token types of the token exchange, see RFC 8693 section 3.
+const (
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// ScopeAdmin is the scope of access tokens allowed to manage the clients.
+const ScopeAdmin = "iam:admin"
+
+// TokenRequest holds the parameters of a token request.
+type TokenRequest struct {
+	// GrantType is the requested grant, client_credentials when empty.
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	// ClientAssertion authenticates the client instead of ClientSecret, see RFC 7523.
+	ClientAssertion string
+	// ClientCertificate is the verified TLS client certificate, authenticating clients of tls_client_auth and
+	// binding the access token to it, see RFC 8705.
+	ClientCertificate *x509.Certificate
+	// ExpiresIn optionally shortens the lifetime of the access token.
+	ExpiresIn time.Duration
+	// Audience restricts the access token to the given audiences.
+	Audience []string
+	// Scope lists the scopes requested for the access token.
+	Scope []string
+	// RefreshToken is presented with the refresh_token grant.
+	RefreshToken string
+	// SubjectToken is the access token exchanged with the token exchange grant.
+	SubjectToken string
+	// DPoP optionally is the DPoP proof of the request, binding the access token to its key.
+	DPoP DPoPProof
+}
+
+// DPoPProof is a DPoP proof of the possession of a key, see RFC 9449, along with the request it must be made
+// for.
+type DPoPProof struct {
+	// Proof is the JWT of the DPoP header, none was given when empty.
+	Proof string
+	// Method and URL are the HTTP method and the URL of the request, without query and fragment.
+	Method string
+	URL    string
+}
+
+// Token holds the tokens issued for a token request.
+type Token struct {
+	AccessToken   string
+	IdentityToken string
+	// ExpiresIn is the lifetime of the access token in seconds.
+	ExpiresIn int64
+	// Scope lists the scopes granted to the access token.
+	Scope []string
+	// RefreshToken optionally obtains the next tokens with the refresh_token grant.
+	RefreshToken string
+	// IssuedTokenType is the type of the access token issued by a token exchange.
+	IssuedTokenType string
+	// DPoP tells whether the access token is bound to a DPoP key, its token type is then DPoP instead of Bearer.
+	DPoP bool
+}
+
+// Confirmation is the key an access token is bound to, see RFC 7800. The token is only valid when presented
+// along with proof of the key.
+type Confirmation struct {
+	// X509Thumbprint is the base64url encoded SHA-256 hash of the DER encoded client certificate, see RFC 8705
+	// section 3.1.
+	X509Thumbprint string `json:"x5t#S256,omitempty"`
+	// JWKThumbprint is the SHA-256 thumbprint of the DPoP key, see RFC 9449 section 6.
+	JWKThumbprint string `json:"jkt,omitempty"`
+}
+
+// Actor is the party acting on behalf of the subject of an exchanged token, see RFC 8693 section 4.1. The
+// actors before it are nested, the current actor is outermost.
+type Actor struct {
+	// Subject is the application name of the acting client.
+	Subject  string `json:"sub"`
+	ClientID string `json:"client_id,omitempty"`
+	// Actor is the prior actor, if the exchanged token was an exchanged token itself.
+	Actor *Actor `json:"act,omitempty"`
+}
+
+// RefreshToken is the server-side record of an opaque refresh token.
+type RefreshToken struct {
+	// ID is the SHA-256 hash of the refresh token, the token itself is not stored.
+	ID string `json:"id"`
+	// Family is shared by the refresh tokens rotated from the same grant.
+	Family   string   `json:"family"`
+	ClientID string   `json:"client_id"`
+	Scope    []string `json:"scope,omitempty"`
+	Audience []string `json:"audience,omitempty"`
+	// AccessTokenID is the jti of the access token issued along, revoked with the family.
+	AccessTokenID        string    `json:"access_token_id"`
+	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
+	IssuedAt             time.Time `json:"issued_at"`
+	// ExpiresAt is when the refresh token expires unused, at most FamilyExpiresAt.
+	ExpiresAt time.Time `json:"expires_at"`
+	// FamilyExpiresAt is when the family expires, however often it is rotated.
+	FamilyExpiresAt time.Time `json:"family_expires_at"`
+	// Used tells whether the refresh token was exchanged already.
+	Used bool `json:"used"`
+}
+
+// IntrospectionRequest holds the parameters of a token introspection request.
+type IntrospectionRequest struct {
+	// ClientID and ClientSecret, ClientAssertion or ClientCertificate authenticate the client asking.
+	ClientID          string
+	ClientSecret      string
+	ClientAssertion   string
+	ClientCertificate *x509.Certificate
+	// Token is the introspected token.
+	Token string
+	// TokenTypeHint optionally tells the type of the token.
+	TokenTypeHint string
+	// DPoP optionally is the DPoP proof the token was presented with, checked against a DPoP-bound token.
+	DPoP DPoPProof
+}
+
+// RevocationRequest holds the parameters of a token revocation request.
+type RevocationRequest struct {
+	// ClientID and ClientSecret, ClientAssertion or ClientCertificate authenticate the client asking.
+	ClientID          string
+	ClientSecret      string
+	ClientAssertion   string
+	ClientCertificate *x509.Certificate
+	// Token is the revoked token.
+	Token string
+	// TokenTypeHint optionally tells the type of the token.
+	TokenTypeHint string
+}
+
+// Introspection describes an introspected token, see RFC 7662. Inactive tokens are described by Active only.
+type Introspection struct {
+	Active bool
+	// ClientID is the client the token was issued to.
+	ClientID string
+	// Subject is the application name of the client.
+	Subject   string
+	Scope     []string
+	Audience  []string
+	Issuer    string
+	ExpiresAt time.Time
+	IssuedAt  time.Time
+	NotBefore time.Time
+	JWTID     string
+	// Actor is the chain of actors of an exchanged token.
+	Actor *Actor
+	// Confirmation is the key the token is bound to, if any.
+	Confirmation *Confirmation
+}
+
+// ValidationRequest holds the parameters of a token validation request.
+type ValidationRequest struct {
+	// Token is the validated access token.
+	Token string
+	// Audience optionally is the audience the token must be intended for.
+	Audience string
+	// Scope lists the scopes the token must be granted.
+	Scope []string
+	// ClientCertificate is the verified TLS client certificate of the request, required for tokens bound to it.
+	ClientCertificate *x509.Certificate
+	// DPoP is the DPoP proof of the request, required for tokens bound to a DPoP key.
+	DPoP DPoPProof
+}
+
+// Metadata describes the capabilities of the authorization server, published along with its endpoints, see
+// RFC 8414.
+type Metadata struct {
+	// Issuer is the iss claim of the tokens.
+	Issuer     string
+	GrantTypes []string
+	// AuthMethods are the client authentication methods of the token, introspection and revocation endpoints.
+	AuthMethods []string
+	// AssertionSigningAlgs are the accepted signing algorithms of client assertions.
+	AssertionSigningAlgs []string
+	// TokenSigningAlgs are the signing algorithms of access tokens.
+	TokenSigningAlgs []string
+	// DPoPSigningAlgs are the accepted signing algorithms of DPoP proofs.
+	DPoPSigningAlgs []string
+	// CertificateBoundAccessTokens tells whether access tokens may be bound to client certificates.
+	CertificateBoundAccessTokens bool
+}
@@ -0,0 +1,115 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package refresh implements the stores of the refresh tokens.
+package refresh
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+var (
+	// ErrNotFound is returned for refresh tokens that do not exist, or were revoked or pruned.
+	ErrNotFound = errors.New("refresh token does not exist")
+	// ErrReused is returned for refresh tokens that were exchanged already.
+	ErrReused = errors.New("refresh token was used already")
+)
+
+// pruneInterval is how often the expired refresh tokens are deleted at most.
+const pruneInterval = time.Minute
+
+// Memory holds the refresh tokens of a single replica.
+type Memory struct {
+	mu       sync.Mutex
+	tokens   map[string]models.RefreshToken
+	now      func() time.Time
+	prunedAt time.Time
+}
+
+// NewMemory returns an empty store.
+func NewMemory() *Memory {
+	return &Memory{tokens: map[string]models.RefreshToken{}, now: time.Now}
+}
+
+// Create adds the refresh token. Expired refresh tokens are pruned once every pruneInterval.
+func (m *Memory) Create(_ context.Context, token models.RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now := m.now(); now.Sub(m.prunedAt) >= pruneInterval {
+		m.prunedAt = now
+		for id, t := range m.tokens {
+			if t.ExpiresAt.Before(now) {
+				delete(m.tokens, id)
+			}
+		}
+	}
+	m.tokens[token.ID] = token
+	return nil
+}
+
+// Get returns the refresh token, ErrNotFound when it does not exist.
+func (m *Memory) Get(_ context.Context, id string) (models.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.tokens[id]
+	if !ok {
+		return models.RefreshToken{}, ErrNotFound
+	}
+	return token, nil
+}
+
+// Rotate marks the refresh token used and adds the next one in its place, ErrReused when it was used already.
+func (m *Memory) Rotate(_ context.Context, id string, next models.RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.tokens[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if token.Used {
+		return ErrReused
+	}
+	token.Used = true
+	m.tokens[id] = token
+	m.tokens[next.ID] = next
+	return nil
+}
+
+// RevokeFamily deletes the refresh tokens of the family and returns them.
+func (m *Memory) RevokeFamily(_ context.Context, family string) ([]models.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var revoked []models.RefreshToken
+	for id, t := range m.tokens {
+		if t.Family == family {
+			revoked = append(revoked, t)
+			delete(m.tokens, id)
+		}
+	}
+	return revoked, nil
+}
+
+// Health always succeeds.
+func (m *Memory) Health(_ context.Context) error {
+	return nil
+}
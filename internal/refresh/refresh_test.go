@@ -0,0 +1,142 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package refresh
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ingka-group/iam-proxy/internal/database"
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+func TestStores(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	memory := NewMemory()
+	memory.now = clock
+	db, err := NewSQL(ctx, database.Config{Driver: database.DriverSQLite, DSN: filepath.Join(t.TempDir(), "refresh.db")})
+	assert.NoError(t, err)
+	defer db.Close()
+	db.now = clock
+
+	type store interface {
+		Create(ctx context.Context, token models.RefreshToken) error
+		Get(ctx context.Context, id string) (models.RefreshToken, error)
+		Rotate(ctx context.Context, id string, next models.RefreshToken) error
+		RevokeFamily(ctx context.Context, family string) ([]models.RefreshToken, error)
+		Health(ctx context.Context) error
+	}
+
+	tests := map[string]store{
+		"memory": memory,
+		"sql":    db,
+	}
+
+	for name, s := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, s.Health(ctx))
+
+			token := func(id, family string, expiresAt time.Time) models.RefreshToken {
+				return models.RefreshToken{
+					ID:              id,
+					Family:          family,
+					ClientID:        "client",
+					Scope:           []string{"read"},
+					AccessTokenID:   "jti-" + id,
+					IssuedAt:        now,
+					ExpiresAt:       expiresAt,
+					FamilyExpiresAt: now.Add(24 * time.Hour),
+				}
+			}
+			a := token("a", "f", now.Add(time.Hour))
+			assert.NoError(t, s.Create(ctx, a))
+			assert.NoError(t, s.Create(ctx, token("b", "f", now.Add(time.Hour))))
+			assert.NoError(t, s.Create(ctx, token("c", "g", now.Add(time.Hour))))
+
+			got, err := s.Get(ctx, "a")
+			assert.NoError(t, err)
+			assert.Equal(t, a, got)
+			_, err = s.Get(ctx, "missing")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			// a refresh token is replaced once only
+			e := token("e", "f", now.Add(time.Hour))
+			assert.NoError(t, s.Rotate(ctx, "a", e))
+			got, err = s.Get(ctx, "a")
+			assert.NoError(t, err)
+			assert.True(t, got.Used)
+			got, err = s.Get(ctx, "e")
+			assert.NoError(t, err)
+			assert.Equal(t, e, got)
+			assert.ErrorIs(t, s.Rotate(ctx, "a", token("x", "f", now.Add(time.Hour))), ErrReused)
+			_, err = s.Get(ctx, "x")
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, s.Rotate(ctx, "missing", token("y", "f", now.Add(time.Hour))), ErrNotFound)
+
+			revoked, err := s.RevokeFamily(ctx, "f")
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, []string{"jti-a", "jti-b", "jti-e"}, []string{revoked[0].AccessTokenID, revoked[1].AccessTokenID, revoked[2].AccessTokenID})
+			_, err = s.Get(ctx, "b")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			// expired refresh tokens are pruned on the next creation after the interval
+			now = now.Add(2 * time.Hour)
+			assert.NoError(t, s.Create(ctx, token("d", "h", now.Add(time.Hour))))
+			_, err = s.Get(ctx, "c")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = s.Get(ctx, "d")
+			assert.NoError(t, err)
+
+			// but not before the interval passed
+			assert.NoError(t, s.Create(ctx, token("i", "i", now.Add(time.Second))))
+			now = now.Add(2 * time.Second)
+			assert.NoError(t, s.Create(ctx, token("j", "j", now.Add(time.Hour))))
+			_, err = s.Get(ctx, "i")
+			assert.NoError(t, err)
+			now = now.Add(pruneInterval)
+			assert.NoError(t, s.Create(ctx, token("k", "k", now.Add(time.Hour))))
+			_, err = s.Get(ctx, "i")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestSQL_RotateFailed(t *testing.T) {
+	ctx := context.TODO()
+	db, err := NewSQL(ctx, database.Config{Driver: database.DriverSQLite, DSN: filepath.Join(t.TempDir(), "refresh.db")})
+	assert.NoError(t, err)
+	defer db.Close()
+	expiresAt := time.Now().Add(time.Hour)
+	assert.NoError(t, db.Create(ctx, models.RefreshToken{ID: "a", Family: "f", ExpiresAt: expiresAt}))
+	assert.NoError(t, db.Create(ctx, models.RefreshToken{ID: "b", Family: "f", ExpiresAt: expiresAt}))
+
+	// the refresh token stays unused when its successor cannot be created
+	assert.Error(t, db.Rotate(ctx, "a", models.RefreshToken{ID: "b", Family: "f", ExpiresAt: expiresAt}))
+	token, err := db.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.False(t, token.Used)
+}
+
+func TestNewSQL_Driver(t *testing.T) {
+	_, err := NewSQL(context.TODO(), database.Config{Driver: "mysql"})
+	assert.Error(t, err)
+}
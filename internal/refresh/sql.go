@@ -0,0 +1,202 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package refresh
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ingka-group/iam-proxy/internal/database"
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+// schema creates the table of the refresh tokens, holding each token as a JSON document. used and
+// expires_at, a Unix time, are kept apart for the queries.
+const schema = `CREATE TABLE IF NOT EXISTS iam_refresh_tokens (
+	id         VARCHAR(64) PRIMARY KEY,
+	family     VARCHAR(64) NOT NULL,
+	used       INTEGER NOT NULL,
+	expires_at BIGINT NOT NULL,
+	token      TEXT NOT NULL
+)`
+
+// SQL holds the refresh tokens in a database shared by all replicas.
+type SQL struct {
+	db  *database.DB
+	now func() time.Time
+
+	mu       sync.Mutex
+	prunedAt time.Time
+}
+
+// NewSQL connects to the database, creating the table of the refresh tokens if it does not exist.
+func NewSQL(ctx context.Context, cfg database.Config) (*SQL, error) {
+	db, err := database.Open(ctx, cfg, schema)
+	if err != nil {
+		return nil, err
+	}
+	return &SQL{db: db, now: time.Now}, nil
+}
+
+// Create adds the refresh token. Expired refresh tokens are deleted once every pruneInterval.
+func (s *SQL) Create(ctx context.Context, token models.RefreshToken) error {
+	if err := s.insert(ctx, s.db, token); err != nil {
+		return err
+	}
+	return s.prune(ctx, s.now())
+}
+
+// prune deletes the expired refresh tokens, unless this replica did within pruneInterval.
+func (s *SQL) prune(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	due := now.Sub(s.prunedAt) >= pruneInterval
+	if due {
+		s.prunedAt = now
+	}
+	s.mu.Unlock()
+	if !due {
+		return nil
+	}
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM iam_refresh_tokens WHERE expires_at < "+s.db.Placeholder(1),
+		now.Unix()); err != nil {
+		return fmt.Errorf("could not delete expired refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// Get returns the refresh token, ErrNotFound when it does not exist.
+func (s *SQL) Get(ctx context.Context, id string) (models.RefreshToken, error) {
+	var data []byte
+	var used int
+	err := s.db.QueryRowContext(ctx, "SELECT token, used FROM iam_refresh_tokens WHERE id = "+s.db.Placeholder(1), id).
+		Scan(&data, &used)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.RefreshToken{}, ErrNotFound
+	}
+	if err != nil {
+		return models.RefreshToken{}, fmt.Errorf("could not look up refresh token: %w", err)
+	}
+	var token models.RefreshToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return models.RefreshToken{}, fmt.Errorf("could not decode refresh token: %w", err)
+	}
+	token.Used = used != 0
+	return token, nil
+}
+
+// Rotate marks the refresh token used and adds the next one in its place, ErrReused when it was used already.
+// Either both change or neither.
+func (s *SQL) Rotate(ctx context.Context, id string, next models.RefreshToken) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not rotate refresh token: %w", err)
+	}
+	// rolling back a committed transaction does nothing
+	defer func() { _ = tx.Rollback() }()
+
+	// only one of concurrent rotations changes the row
+	res, err := tx.ExecContext(ctx, "UPDATE iam_refresh_tokens SET used = 1 WHERE used = 0 AND id = "+s.db.Placeholder(1), id)
+	if err != nil {
+		return fmt.Errorf("could not use refresh token: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not use refresh token: %w", err)
+	}
+	if n == 0 {
+		var exists int
+		err := tx.QueryRowContext(ctx, "SELECT 1 FROM iam_refresh_tokens WHERE id = "+s.db.Placeholder(1), id).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("could not look up refresh token: %w", err)
+		}
+		return ErrReused
+	}
+	if err := s.insert(ctx, tx, next); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not rotate refresh token: %w", err)
+	}
+	return nil
+}
+
+// execer runs statements on the database or in a transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// insert adds the refresh token.
+func (s *SQL) insert(ctx context.Context, conn execer, token models.RefreshToken) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("could not encode refresh token: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO iam_refresh_tokens (id, family, used, expires_at, token) VALUES (%s, %s, 0, %s, %s)",
+		s.db.Placeholder(1), s.db.Placeholder(2), s.db.Placeholder(3), s.db.Placeholder(4)),
+		token.ID, token.Family, token.ExpiresAt.Unix(), string(data)); err != nil {
+		return fmt.Errorf("could not create refresh token: %w", err)
+	}
+	return nil
+}
+
+// RevokeFamily deletes the refresh tokens of the family and returns them.
+func (s *SQL) RevokeFamily(ctx context.Context, family string) ([]models.RefreshToken, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT token FROM iam_refresh_tokens WHERE family = "+s.db.Placeholder(1), family)
+	if err != nil {
+		return nil, fmt.Errorf("could not list refresh token family: %w", err)
+	}
+	defer rows.Close()
+
+	var revoked []models.RefreshToken
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("could not list refresh token family: %w", err)
+		}
+		var token models.RefreshToken
+		if err := json.Unmarshal(data, &token); err != nil {
+			return nil, fmt.Errorf("could not decode refresh token: %w", err)
+		}
+		revoked = append(revoked, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not list refresh token family: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM iam_refresh_tokens WHERE family = "+s.db.Placeholder(1), family); err != nil {
+		return nil, fmt.Errorf("could not revoke refresh token family: %w", err)
+	}
+	return revoked, nil
+}
+
+// Health returns an error when the database is not reachable.
+func (s *SQL) Health(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the database.
+func (s *SQL) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,62 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package replay implements the stores of the ids of one-time tokens, e.g. client assertions, to detect replays.
+package replay
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrReplayed is returned for ids that were used already.
+var ErrReplayed = errors.New("token was used already")
+
+// Memory holds the used ids of a single replica.
+type Memory struct {
+	mu sync.Mutex
+	// used maps ids to the time they can be forgotten.
+	used map[string]time.Time
+	now  func() time.Time
+}
+
+// NewMemory returns an empty store.
+func NewMemory() *Memory {
+	return &Memory{used: map[string]time.Time{}, now: time.Now}
+}
+
+// Use records the id until expiresAt, returning ErrReplayed when it was used already. Expired ids are forgotten.
+func (m *Memory) Use(_ context.Context, id string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for used, expiry := range m.used {
+		if expiry.Before(now) {
+			delete(m.used, used)
+		}
+	}
+	if _, ok := m.used[id]; ok {
+		return ErrReplayed
+	}
+	m.used[id] = expiresAt
+	return nil
+}
+
+// Health always succeeds.
+func (m *Memory) Health(_ context.Context) error {
+	return nil
+}
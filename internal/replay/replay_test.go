@@ -0,0 +1,101 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ingka-group/iam-proxy/internal/database"
+)
+
+func TestStores(t *testing.T) {
+	ctx := context.TODO()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	clock := func() time.Time { return now }
+
+	memory := NewMemory()
+	memory.now = clock
+	db, err := NewSQL(ctx, database.Config{Driver: database.DriverSQLite, DSN: filepath.Join(t.TempDir(), "replay.db")})
+	assert.NoError(t, err)
+	defer db.Close()
+	db.now = clock
+
+	type store interface {
+		Use(ctx context.Context, id string, expiresAt time.Time) error
+		Health(ctx context.Context) error
+	}
+
+	tests := map[string]store{
+		"memory": memory,
+		"sql":    db,
+	}
+
+	for name, s := range tests {
+		t.Run(name, func(t *testing.T) {
+			now = start
+			assert.NoError(t, s.Health(ctx))
+
+			assert.NoError(t, s.Use(ctx, "a", now.Add(time.Hour)))
+			assert.NoError(t, s.Use(ctx, "b", now.Add(time.Hour)))
+			assert.ErrorIs(t, s.Use(ctx, "a", now.Add(time.Hour)), ErrReplayed)
+
+			// expired ids can be used again
+			now = now.Add(2 * time.Hour)
+			assert.NoError(t, s.Use(ctx, "a", now.Add(time.Hour)))
+			assert.ErrorIs(t, s.Use(ctx, "a", now.Add(time.Hour)), ErrReplayed)
+
+			// also before they are pruned
+			assert.NoError(t, s.Use(ctx, "c", now.Add(time.Second)))
+			now = now.Add(2 * time.Second)
+			assert.NoError(t, s.Use(ctx, "c", now.Add(time.Hour)))
+			assert.ErrorIs(t, s.Use(ctx, "c", now.Add(time.Hour)), ErrReplayed)
+		})
+	}
+}
+
+func TestSQL_Prune(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	db, err := NewSQL(ctx, database.Config{Driver: database.DriverSQLite, DSN: filepath.Join(t.TempDir(), "replay.db")})
+	assert.NoError(t, err)
+	defer db.Close()
+	db.now = func() time.Time { return now }
+	count := func() int {
+		var n int
+		assert.NoError(t, db.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM iam_used_tokens").Scan(&n))
+		return n
+	}
+
+	assert.NoError(t, db.Use(ctx, "a", now.Add(time.Second)))
+	now = now.Add(2 * time.Second)
+	assert.NoError(t, db.Use(ctx, "b", now.Add(time.Hour)))
+	assert.Equal(t, 2, count())
+
+	// expired ids are deleted once the interval passed
+	now = now.Add(pruneInterval)
+	assert.NoError(t, db.Use(ctx, "c", now.Add(time.Hour)))
+	assert.Equal(t, 2, count())
+}
+
+func TestNewSQL_Driver(t *testing.T) {
+	_, err := NewSQL(context.TODO(), database.Config{Driver: "mysql"})
+	assert.Error(t, err)
+}
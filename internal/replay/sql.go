@@ -0,0 +1,105 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ingka-group/iam-proxy/internal/database"
+)
+
+// schema creates the table of the used ids. expires_at is a Unix time.
+const schema = `CREATE TABLE IF NOT EXISTS iam_used_tokens (
+	id         VARCHAR(255) PRIMARY KEY,
+	expires_at BIGINT NOT NULL
+)`
+
+// pruneInterval is how often a replica deletes the expired ids at most.
+const pruneInterval = time.Minute
+
+// SQL holds the used ids in a database shared by all replicas.
+type SQL struct {
+	db  *database.DB
+	now func() time.Time
+
+	mu       sync.Mutex
+	prunedAt time.Time
+}
+
+// NewSQL connects to the database, creating the table of the used ids if it does not exist.
+func NewSQL(ctx context.Context, cfg database.Config) (*SQL, error) {
+	db, err := database.Open(ctx, cfg, schema)
+	if err != nil {
+		return nil, err
+	}
+	return &SQL{db: db, now: time.Now}, nil
+}
+
+// Use records the id until expiresAt, returning ErrReplayed when it was used already. Expired ids can be used
+// again, they are deleted once every pruneInterval.
+func (s *SQL) Use(ctx context.Context, id string, expiresAt time.Time) error {
+	now := s.now()
+	if err := s.prune(ctx, now); err != nil {
+		return err
+	}
+	// an expired id not pruned yet is replaced
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO iam_used_tokens (id, expires_at) VALUES (%s, %s) "+
+			"ON CONFLICT (id) DO UPDATE SET expires_at = excluded.expires_at WHERE iam_used_tokens.expires_at < %s",
+		s.db.Placeholder(1), s.db.Placeholder(2), s.db.Placeholder(3)), id, expiresAt.Unix(), now.Unix())
+	if err != nil {
+		return fmt.Errorf("could not record id %s: %w", id, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not record id %s: %w", id, err)
+	}
+	if n == 0 {
+		return ErrReplayed
+	}
+	return nil
+}
+
+// prune deletes the expired ids, unless this replica did within pruneInterval.
+func (s *SQL) prune(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	due := now.Sub(s.prunedAt) >= pruneInterval
+	if due {
+		s.prunedAt = now
+	}
+	s.mu.Unlock()
+	if !due {
+		return nil
+	}
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM iam_used_tokens WHERE expires_at < "+s.db.Placeholder(1),
+		now.Unix()); err != nil {
+		return fmt.Errorf("could not delete expired ids: %w", err)
+	}
+	return nil
+}
+
+// Health returns an error when the database is not reachable.
+func (s *SQL) Health(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the database.
+func (s *SQL) Close() error {
+	return s.db.Close()
+}
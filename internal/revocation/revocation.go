@@ -0,0 +1,71 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package revocation implements the stores of revoked token ids.
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often the expired ids are deleted at most.
+const pruneInterval = time.Minute
+
+// Memory holds the revoked token ids of a single replica.
+type Memory struct {
+	mu sync.RWMutex
+	// revoked maps token ids to the time they can be forgotten, never for the zero time.
+	revoked  map[string]time.Time
+	now      func() time.Time
+	prunedAt time.Time
+}
+
+// NewMemory returns an empty store.
+func NewMemory() *Memory {
+	return &Memory{revoked: map[string]time.Time{}, now: time.Now}
+}
+
+// Revoke denies the token id until expiresAt, forever for the zero time. Expired ids are forgotten once every
+// pruneInterval.
+func (m *Memory) Revoke(_ context.Context, jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now := m.now(); now.Sub(m.prunedAt) >= pruneInterval {
+		m.prunedAt = now
+		for id, expiry := range m.revoked {
+			if !expiry.IsZero() && expiry.Before(now) {
+				delete(m.revoked, id)
+			}
+		}
+	}
+	m.revoked[jti] = expiresAt
+	return nil
+}
+
+// Revoked tells whether the token id is denied.
+func (m *Memory) Revoked(_ context.Context, jti string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.revoked[jti]
+	return ok, nil
+}
+
+// Health always succeeds.
+func (m *Memory) Health(_ context.Context) error {
+	return nil
+}
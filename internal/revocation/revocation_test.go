@@ -0,0 +1,98 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocation
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ingka-group/iam-proxy/internal/database"
+)
+
+func TestStores(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	memory := NewMemory()
+	memory.now = clock
+	db, err := NewSQL(ctx, database.Config{Driver: database.DriverSQLite, DSN: filepath.Join(t.TempDir(), "revocations.db")})
+	assert.NoError(t, err)
+	defer db.Close()
+	db.now = clock
+
+	type store interface {
+		Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+		Revoked(ctx context.Context, jti string) (bool, error)
+		Health(ctx context.Context) error
+	}
+
+	tests := map[string]store{
+		"memory": memory,
+		"sql":    db,
+	}
+
+	for name, s := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, s.Health(ctx))
+
+			revoked, err := s.Revoked(ctx, "a")
+			assert.NoError(t, err)
+			assert.False(t, revoked)
+
+			assert.NoError(t, s.Revoke(ctx, "a", now.Add(time.Hour)))
+			assert.NoError(t, s.Revoke(ctx, "forever", time.Time{}))
+			// revoking twice is harmless
+			assert.NoError(t, s.Revoke(ctx, "a", now.Add(time.Hour)))
+			for _, jti := range []string{"a", "forever"} {
+				revoked, err = s.Revoked(ctx, jti)
+				assert.NoError(t, err)
+				assert.True(t, revoked, jti)
+			}
+
+			// expired ids are forgotten on the next revocation after the interval
+			now = now.Add(2 * time.Hour)
+			assert.NoError(t, s.Revoke(ctx, "b", now.Add(time.Hour)))
+			revoked, err = s.Revoked(ctx, "a")
+			assert.NoError(t, err)
+			assert.False(t, revoked)
+			revoked, err = s.Revoked(ctx, "forever")
+			assert.NoError(t, err)
+			assert.True(t, revoked)
+
+			// but not before the interval passed
+			assert.NoError(t, s.Revoke(ctx, "c", now.Add(time.Second)))
+			now = now.Add(2 * time.Second)
+			assert.NoError(t, s.Revoke(ctx, "d", now.Add(time.Hour)))
+			revoked, err = s.Revoked(ctx, "c")
+			assert.NoError(t, err)
+			assert.True(t, revoked)
+			now = now.Add(pruneInterval)
+			assert.NoError(t, s.Revoke(ctx, "e", now.Add(time.Hour)))
+			revoked, err = s.Revoked(ctx, "c")
+			assert.NoError(t, err)
+			assert.False(t, revoked)
+		})
+	}
+}
+
+func TestNewSQL_Driver(t *testing.T) {
+	_, err := NewSQL(context.TODO(), database.Config{Driver: "mysql"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ingka-group/iam-proxy/internal/database"
+)
+
+// schema creates the table of the revoked token ids. expires_at is a Unix time, 0 for tokens without expiry.
+const schema = `CREATE TABLE IF NOT EXISTS iam_revoked_tokens (
+	jti        VARCHAR(255) PRIMARY KEY,
+	expires_at BIGINT NOT NULL
+)`
+
+// SQL holds the revoked token ids in a database shared by all replicas.
+type SQL struct {
+	db  *database.DB
+	now func() time.Time
+
+	mu       sync.Mutex
+	prunedAt time.Time
+}
+
+// NewSQL connects to the database, creating the table of the revocations if it does not exist.
+func NewSQL(ctx context.Context, cfg database.Config) (*SQL, error) {
+	db, err := database.Open(ctx, cfg, schema)
+	if err != nil {
+		return nil, err
+	}
+	return &SQL{db: db, now: time.Now}, nil
+}
+
+// Revoke denies the token id until expiresAt, forever for the zero time. Expired ids are deleted once every
+// pruneInterval.
+func (s *SQL) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	var expiry int64
+	if !expiresAt.IsZero() {
+		expiry = expiresAt.Unix()
+	}
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO iam_revoked_tokens (jti, expires_at) VALUES (%s, %s) ON CONFLICT (jti) DO NOTHING",
+		s.db.Placeholder(1), s.db.Placeholder(2)), jti, expiry); err != nil {
+		return fmt.Errorf("could not revoke token %s: %w", jti, err)
+	}
+	return s.prune(ctx, s.now())
+}
+
+// prune deletes the expired ids, unless this replica did within pruneInterval.
+func (s *SQL) prune(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	due := now.Sub(s.prunedAt) >= pruneInterval
+	if due {
+		s.prunedAt = now
+	}
+	s.mu.Unlock()
+	if !due {
+		return nil
+	}
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM iam_revoked_tokens WHERE expires_at > 0 AND expires_at < "+s.db.Placeholder(1),
+		now.Unix()); err != nil {
+		return fmt.Errorf("could not delete expired revocations: %w", err)
+	}
+	return nil
+}
+
+// Revoked tells whether the token id is denied.
+func (s *SQL) Revoked(ctx context.Context, jti string) (bool, error) {
+	var found int
+	err := s.db.QueryRowContext(ctx, "SELECT 1 FROM iam_revoked_tokens WHERE jti = "+s.db.Placeholder(1), jti).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not look up revocation: %w", err)
+	}
+	return true, nil
+}
+
+// Health returns an error when the database is not reachable.
+func (s *SQL) Health(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the database.
+func (s *SQL) Close() error {
+	return s.db.Close()
+}
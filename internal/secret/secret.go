@@ -0,0 +1,207 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secret implements hashing and constant-time verification of client secrets. Hashes are
+// stored in the PHC string format, e.g. $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>.
+package secret
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Argon2id parameters of new hashes, as recommended by OWASP.
+const (
+	argonMemory  = 64 * 1024
+	argonTime    = 3
+	argonThreads = 4
+	saltLength   = 16
+	hashLength   = 32
+)
+
+// generatedLength is the number of random bytes of generated secrets.
+const generatedLength = 32
+
+// Bounds of the work a malformed hash can cause.
+const (
+	maxPBKDF2Iterations = 10_000_000
+	maxArgonMemory      = 1024 * 1024
+	maxArgonTime        = 100
+	maxArgonThreads     = 64
+)
+
+// hashPrefixes start the stored secrets in a supported hash format, any other is a plaintext secret.
+var hashPrefixes = []string{"$argon2id$", "$2a$", "$2b$", "$2y$", "$pbkdf2-"}
+
+// ErrMalformedHash is returned when a hash is not in a supported PHC string format.
+var ErrMalformedHash = errors.New("malformed secret hash")
+
+var (
+	dummyOnce sync.Once
+	dummyHash string
+)
+
+// Hash hashes the secret with argon2id.
+func Hash(secret string) (string, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("could not generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(secret), salt, argonTime, argonMemory, argonThreads, hashLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argonMemory, argonTime, argonThreads,
+		encode(salt), encode(key)), nil
+}
+
+// Generate returns a new random client secret.
+func Generate() (string, error) {
+	b := make([]byte, generatedLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate secret: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// IsHash tells whether the stored secret is a hash rather than a plaintext secret, which may start with $ too.
+func IsHash(stored string) bool {
+	for _, prefix := range hashPrefixes {
+		if strings.HasPrefix(stored, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify checks the secret against the stored hash or plaintext secret in constant time.
+func Verify(stored, secret string) (bool, error) {
+	if !IsHash(stored) {
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(secret)) == 1, nil
+	}
+
+	fields := strings.Split(stored, "$")
+	switch id := fields[1]; {
+	case id == "argon2id":
+		return verifyArgon2(fields, secret)
+	case id == "2a" || id == "2b" || id == "2y":
+		err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(secret))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("%w: %w", ErrMalformedHash, err)
+		}
+		return true, nil
+	case strings.HasPrefix(id, "pbkdf2-"):
+		return verifyPBKDF2(fields, secret)
+	}
+	return false, fmt.Errorf("%w: unsupported algorithm %s", ErrMalformedHash, fields[1])
+}
+
+// VerifyDummy spends the time of verifying a hash without any outcome, so a missing client cannot be told
+// apart from a wrong secret by the response time.
+func VerifyDummy(secret string) {
+	dummyOnce.Do(func() {
+		dummyHash, _ = Hash("dummy secret")
+	})
+	_, _ = Verify(dummyHash, secret)
+}
+
+// verifyArgon2 verifies $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>.
+func verifyArgon2(fields []string, secret string) (bool, error) {
+	if len(fields) != 6 {
+		return false, ErrMalformedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(fields[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, fmt.Errorf("%w: unsupported argon2 version %s", ErrMalformedHash, fields[2])
+	}
+	var (
+		memory, time uint32
+		threads      uint8
+	)
+	if _, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil || memory > maxArgonMemory ||
+		time == 0 || time > maxArgonTime || threads == 0 || threads > maxArgonThreads {
+		return false, fmt.Errorf("%w: invalid argon2 parameters %s", ErrMalformedHash, fields[3])
+	}
+	salt, key, err := decodeSaltAndKey(fields[4], fields[5])
+	if err != nil {
+		return false, err
+	}
+
+	actual := argon2.IDKey([]byte(secret), salt, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
+
+// verifyPBKDF2 verifies $pbkdf2-sha256$i=600000$<salt>$<hash>, with sha256 or sha512.
+func verifyPBKDF2(fields []string, secret string) (bool, error) {
+	if len(fields) != 5 {
+		return false, ErrMalformedHash
+	}
+	var h func() hash.Hash
+	switch fields[1] {
+	case "pbkdf2-sha256":
+		h = sha256.New
+	case "pbkdf2-sha512":
+		h = sha512.New
+	default:
+		return false, fmt.Errorf("%w: unsupported algorithm %s", ErrMalformedHash, fields[1])
+	}
+	iterations, err := strconv.Atoi(strings.TrimPrefix(fields[2], "i="))
+	if err != nil || iterations <= 0 || iterations > maxPBKDF2Iterations {
+		return false, fmt.Errorf("%w: invalid pbkdf2 iterations %s", ErrMalformedHash, fields[2])
+	}
+	salt, key, err := decodeSaltAndKey(fields[3], fields[4])
+	if err != nil {
+		return false, err
+	}
+
+	actual, err := pbkdf2.Key(h, secret, salt, iterations, len(key))
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrMalformedHash, err)
+	}
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
+
+func decodeSaltAndKey(salt, key string) ([]byte, []byte, error) {
+	s, err := decode(salt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid salt: %w", ErrMalformedHash, err)
+	}
+	k, err := decode(key)
+	if err != nil || len(k) == 0 {
+		return nil, nil, fmt.Errorf("%w: invalid hash", ErrMalformedHash)
+	}
+	return s, k, nil
+}
+
+// encode and decode use the unpadded standard base64 of the PHC string format.
+func encode(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,107 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secret
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerify(t *testing.T) {
+	argon, err := Hash("secret")
+	assert.NoError(t, err)
+	assert.True(t, IsHash(argon))
+	other, err := Hash("secret")
+	assert.NoError(t, err)
+	assert.NotEqual(t, argon, other)
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	pbkdf2Hash := func(name string, h func() hash.Hash) string {
+		salt := []byte("0123456789abcdef")
+		key, err := pbkdf2.Key(h, "secret", salt, 1000, 32)
+		assert.NoError(t, err)
+		return fmt.Sprintf("$pbkdf2-%s$i=1000$%s$%s", name, encode(salt), encode(key))
+	}
+
+	type test struct {
+		stored string
+		valid  bool
+		err    bool
+	}
+
+	tests := map[string]test{
+		"argon2id":             {stored: argon, valid: true},
+		"bcrypt":               {stored: string(bcryptHash), valid: true},
+		"pbkdf2-sha256":        {stored: pbkdf2Hash("sha256", sha256.New), valid: true},
+		"pbkdf2-sha512":        {stored: pbkdf2Hash("sha512", sha512.New), valid: true},
+		"plaintext":            {stored: "secret", valid: true},
+		"plaintext mismatch":   {stored: "other"},
+		"unsupported":          {stored: "$scrypt$ln=15,r=8,p=1$c2FsdA$aGFzaA"},
+		"plaintext dollar":     {stored: "$ecret"},
+		"pbkdf2 unsupported":   {stored: "$pbkdf2-md5$i=1000$c2FsdA$aGFzaA", err: true},
+		"malformed argon2id":   {stored: "$argon2id$v=19$m=65536$salt$hash", err: true},
+		"argon2id version":     {stored: "$argon2id$v=16$m=65536,t=3,p=4$c2FsdA$aGFzaA", err: true},
+		"argon2id memory":      {stored: "$argon2id$v=19$m=4294967295,t=3,p=4$c2FsdA$aGFzaA", err: true},
+		"argon2id time":        {stored: "$argon2id$v=19$m=65536,t=4294967295,p=4$c2FsdA$aGFzaA", err: true},
+		"argon2id threads":     {stored: "$argon2id$v=19$m=65536,t=3,p=255$c2FsdA$aGFzaA", err: true},
+		"pbkdf2 no iterations": {stored: "$pbkdf2-sha256$i=0$c2FsdA$aGFzaA", err: true},
+		"malformed bcrypt":     {stored: "$2b$10$short", err: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			valid, err := Verify(tt.stored, "secret")
+			if tt.err {
+				assert.ErrorIs(t, err, ErrMalformedHash)
+				assert.False(t, valid)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.valid, valid)
+
+			if tt.valid {
+				valid, err = Verify(tt.stored, "wrong")
+				assert.NoError(t, err)
+				assert.False(t, valid)
+			}
+		})
+	}
+}
+
+func TestVerify_PlaintextDollar(t *testing.T) {
+	// plaintext secrets may start like a hash of an unsupported format
+	assert.False(t, IsHash("$ecret"))
+	valid, err := Verify("$ecret", "$ecret")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestGenerate(t *testing.T) {
+	a, err := Generate()
+	assert.NoError(t, err)
+	b, err := Generate()
+	assert.NoError(t, err)
+	assert.Len(t, a, 43)
+	assert.NotEqual(t, a, b)
+}
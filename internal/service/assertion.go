@@ -0,0 +1,266 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ingka-group/iam-proxy/client/jwk"
+	"github.com/ingka-group/iam-proxy/internal/credentials"
+	"github.com/ingka-group/iam-proxy/internal/keys"
+	"github.com/ingka-group/iam-proxy/internal/models"
+	"github.com/ingka-group/iam-proxy/internal/replay"
+)
+
+const (
+	// maxAssertionLifetime bounds how long a client assertion is valid, and so kept against replays.
+	maxAssertionLifetime = 1 * time.Hour
+	// keySetExpiration is how long the fetched key set of a client is used.
+	keySetExpiration = 5 * time.Minute
+	// keySetRefreshInterval is how often a key set is fetched at most, e.g. for unknown key ids.
+	keySetRefreshInterval = 1 * time.Minute
+	// maxKeySetSize bounds the size of a fetched key set in bytes.
+	maxKeySetSize = 1 << 20
+)
+
+// Reasons a client assertion is rejected.
+var (
+	ErrInvalidAssertion   = errors.New("client assertion is invalid")
+	ErrAssertionReplayed  = errors.New("client assertion was used already")
+	ErrAuthMethodMismatch = errors.New("client authenticates with another method")
+)
+
+// assertionMethods are the accepted signing algorithms of client assertions, shared secrets are not.
+var assertionMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "EdDSA"}
+
+// authenticate authenticates the client with the client assertion, if given, the client secret, or else the
+// client certificate. It returns the client id, which a client assertion tells when clientID is empty.
+func (s *Service) authenticate(ctx context.Context, clientID, clientSecret, assertion string,
+	certificate *x509.Certificate) (string, models.Secret, error) {
+	if len(assertion) > 0 {
+		return s.verifyAssertion(ctx, clientID, assertion)
+	}
+	if len(clientSecret) == 0 && certificate != nil {
+		client, err := s.verifyCertificate(ctx, clientID, certificate)
+		return clientID, client, err
+	}
+	client, err := s.verifyUser(ctx, clientID, clientSecret)
+	return clientID, client, err
+}
+
+// verifyAssertion authenticates the client with a JWT signed by its key, see RFC 7523 section 3. The issuer and
+// subject are the client id, the audience is the issuer of this service or one of the configured audiences.
+// The assertion must expire within maxAssertionLifetime and have an id, which cannot be used twice.
+func (s *Service) verifyAssertion(ctx context.Context, clientID, assertion string) (string, models.Secret, error) {
+	var (
+		claims    jwt.RegisteredClaims
+		client    models.Secret
+		lookupErr error
+	)
+	_, err := jwt.ParseWithClaims(assertion, &claims, func(token *jwt.Token) (interface{}, error) {
+		if len(claims.Subject) == 0 || claims.Issuer != claims.Subject {
+			return nil, errors.New("issuer and subject must be the client id")
+		}
+		if len(clientID) > 0 && clientID != claims.Subject {
+			return nil, errors.New("subject does not match the client id")
+		}
+		client, lookupErr = s.credentialStore().Client(ctx, models.ClientID(claims.Subject))
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		if !client.UsesPrivateKeyJWT() {
+			return nil, ErrAuthMethodMismatch
+		}
+		return s.assertionKey(ctx, client, token)
+	}, jwt.WithValidMethods(assertionMethods), jwt.WithExpirationRequired(), jwt.WithLeeway(s.validation.leeway))
+	if lookupErr != nil && !errors.Is(lookupErr, credentials.ErrNotFound) {
+		return "", models.Secret{}, fmt.Errorf("could not look up client: %w", lookupErr)
+	}
+	if err != nil {
+		return "", models.Secret{}, fmt.Errorf("%w: %w: %w", ErrInvalidCredentials, ErrInvalidAssertion, err)
+	}
+
+	if !slices.ContainsFunc(claims.Audience, s.acceptsAssertionAudience) {
+		return "", models.Secret{}, fmt.Errorf("%w: %w: audience is not accepted", ErrInvalidCredentials, ErrInvalidAssertion)
+	}
+	expiresAt := claims.ExpiresAt.Add(s.validation.leeway)
+	if expiresAt.After(time.Now().Add(maxAssertionLifetime + s.validation.leeway)) {
+		return "", models.Secret{}, fmt.Errorf("%w: %w: lifetime exceeds %s", ErrInvalidCredentials, ErrInvalidAssertion, maxAssertionLifetime)
+	}
+	if len(claims.ID) == 0 {
+		return "", models.Secret{}, fmt.Errorf("%w: %w: id is missing", ErrInvalidCredentials, ErrInvalidAssertion)
+	}
+	err = s.replays.Use(ctx, "client_assertion:"+claims.Subject+":"+claims.ID, expiresAt)
+	if errors.Is(err, replay.ErrReplayed) {
+		return "", models.Secret{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, ErrAssertionReplayed)
+	}
+	if err != nil {
+		return "", models.Secret{}, fmt.Errorf("could not check client assertion replay: %w", err)
+	}
+
+	if client.Disabled {
+		return "", models.Secret{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, ErrClientDisabled)
+	}
+	return claims.Subject, client, nil
+}
+
+// acceptsAssertionAudience tells whether client assertions may be meant for the audience.
+func (s *Service) acceptsAssertionAudience(aud string) bool {
+	return aud == s.issuer || slices.Contains(s.assertionAudiences, aud)
+}
+
+// assertionKey returns the key verifying the client assertion, the public key of the client or the key of its
+// key set named by the kid header.
+func (s *Service) assertionKey(ctx context.Context, client models.Secret, token *jwt.Token) (interface{}, error) {
+	alg := token.Method.Alg()
+	if len(client.PublicKey) > 0 {
+		key, err := keys.ParsePEM([]byte(client.PublicKey), alg)
+		if err != nil {
+			return nil, err
+		}
+		return key.VerificationKey(), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	k, err := s.clientKeys.lookup(ctx, client.JWKSURI, kid)
+	if err != nil {
+		return nil, err
+	}
+	if len(k.Algorithm) > 0 && k.Algorithm != alg {
+		return nil, fmt.Errorf("key %s is not for algorithm %s", k.KeyID, alg)
+	}
+	pub, err := k.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	key, err := keys.NewPublic(pub, alg)
+	if err != nil {
+		return nil, err
+	}
+	return key.VerificationKey(), nil
+}
+
+// keySetCache holds the key sets fetched from the JWKS URIs of clients.
+type keySetCache struct {
+	mu     sync.Mutex
+	client *http.Client
+	sets   map[string]*cachedKeySet
+	now    func() time.Time
+}
+
+type cachedKeySet struct {
+	// mu is held while the set is fetched, so a slow JWKS URI only delays the clients using it
+	mu        sync.Mutex
+	set       jwk.Set
+	fetchedAt time.Time
+}
+
+func newKeySetCache() *keySetCache {
+	return &keySetCache{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			// redirects are refused, the key set must be served at the registered URI
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		sets: map[string]*cachedKeySet{},
+		now:  time.Now,
+	}
+}
+
+// entry returns the cached key set of the uri, empty when it was not fetched yet.
+func (c *keySetCache) entry(uri string) *cachedKeySet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.sets[uri]
+	if !ok {
+		cached = &cachedKeySet{}
+		c.sets[uri] = cached
+	}
+	return cached
+}
+
+// lookup returns the key of the set at uri with the key id, the only key of the set when kid is empty. The set
+// is fetched again when it expired, or when the key is unknown and the set was not fetched recently. A stale
+// set is used while it cannot be fetched.
+func (c *keySetCache) lookup(ctx context.Context, uri, kid string) (jwk.Key, error) {
+	cached := c.entry(uri)
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+
+	fetched := !cached.fetchedAt.IsZero()
+	_, found := find(cached.set, kid)
+	age := c.now().Sub(cached.fetchedAt)
+	if !fetched || age > keySetExpiration || (!found && age > keySetRefreshInterval) {
+		set, err := c.fetch(ctx, uri)
+		switch {
+		case err == nil:
+			cached.set, cached.fetchedAt = set, c.now()
+		case !fetched:
+			return jwk.Key{}, err
+		}
+	}
+
+	k, found := find(cached.set, kid)
+	if !found {
+		return jwk.Key{}, fmt.Errorf("key %q is not in the key set of the client", kid)
+	}
+	return k, nil
+}
+
+// fetch gets the key set at uri.
+func (c *keySetCache) fetch(ctx context.Context, uri string) (jwk.Set, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return jwk.Set{}, fmt.Errorf("could not request key set: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return jwk.Set{}, fmt.Errorf("could not fetch key set: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return jwk.Set{}, fmt.Errorf("could not fetch key set: status %d", resp.StatusCode)
+	}
+	var set jwk.Set
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxKeySetSize)).Decode(&set); err != nil {
+		return jwk.Set{}, fmt.Errorf("could not decode key set: %w", err)
+	}
+	return set, nil
+}
+
+// find returns the key with the key id, the only key of the set when kid is empty.
+func find(set jwk.Set, kid string) (jwk.Key, bool) {
+	if len(kid) == 0 {
+		if len(set.Keys) == 1 {
+			return set.Keys[0], true
+		}
+		return jwk.Key{}, false
+	}
+	return set.Lookup(kid)
+}
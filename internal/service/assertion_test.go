@@ -0,0 +1,279 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ingka-group/iam-proxy/client/jwk"
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+const testAssertionClientID = "assertion-client"
+
+func TestService_GenerateToken_ClientAssertion(t *testing.T) {
+	ctx := context.TODO()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(t, err)
+	publicKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	pub, err := jwk.New(&key.PublicKey)
+	assert.NoError(t, err)
+	pub.KeyID = "key-1"
+	keySet := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(jwk.Set{Keys: []jwk.Key{pub}})
+	}))
+	defer keySet.Close()
+
+	valid := func() jwt.RegisteredClaims {
+		now := time.Now()
+		return jwt.RegisteredClaims{
+			Issuer:    testAssertionClientID,
+			Subject:   testAssertionClientID,
+			Audience:  jwt.ClaimStrings{"https://iam.example.com/iam/v1/oauth2/token"},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        uuid.New().String(),
+		}
+	}
+
+	type test struct {
+		claims   func() jwt.RegisteredClaims
+		clientID string
+		// jwks registers the key set instead of the public key
+		jwks   bool
+		method jwt.SigningMethod
+		key    interface{}
+		// replay presents the assertion a second time
+		replay bool
+		err    error
+	}
+
+	tests := map[string]test{
+		"public_key": {
+			claims:   valid,
+			clientID: testAssertionClientID,
+		},
+		"client_id_from_assertion": {
+			claims: valid,
+		},
+		"jwks_uri": {
+			claims: valid,
+			jwks:   true,
+		},
+		"issuer_audience": {
+			claims: func() jwt.RegisteredClaims {
+				c := valid()
+				c.Audience = jwt.ClaimStrings{defaultIssuer}
+				return c
+			},
+		},
+		"replayed": {
+			claims: valid,
+			replay: true,
+			err:    ErrAssertionReplayed,
+		},
+		"client_id_mismatch": {
+			claims:   valid,
+			clientID: testClientID1,
+			err:      ErrInvalidAssertion,
+		},
+		"issuer_mismatch": {
+			claims: func() jwt.RegisteredClaims {
+				c := valid()
+				c.Issuer = testClientID1
+				return c
+			},
+			err: ErrInvalidAssertion,
+		},
+		"audience_not_accepted": {
+			claims: func() jwt.RegisteredClaims {
+				c := valid()
+				c.Audience = jwt.ClaimStrings{"https://other.example.com/token"}
+				return c
+			},
+			err: ErrInvalidAssertion,
+		},
+		"expired": {
+			claims: func() jwt.RegisteredClaims {
+				c := valid()
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+				return c
+			},
+			err: ErrInvalidAssertion,
+		},
+		"expiry_missing": {
+			claims: func() jwt.RegisteredClaims {
+				c := valid()
+				c.ExpiresAt = nil
+				return c
+			},
+			err: ErrInvalidAssertion,
+		},
+		"lifetime_too_long": {
+			claims: func() jwt.RegisteredClaims {
+				c := valid()
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(2 * maxAssertionLifetime))
+				return c
+			},
+			err: ErrInvalidAssertion,
+		},
+		"id_missing": {
+			claims: func() jwt.RegisteredClaims {
+				c := valid()
+				c.ID = ""
+				return c
+			},
+			err: ErrInvalidAssertion,
+		},
+		"other_key": {
+			claims: valid,
+			key:    otherKey,
+			err:    ErrInvalidAssertion,
+		},
+		"other_key_jwks": {
+			claims: valid,
+			jwks:   true,
+			key:    otherKey,
+			err:    ErrInvalidAssertion,
+		},
+		"shared_secret": {
+			claims: valid,
+			method: jwt.SigningMethodHS256,
+			key:    []byte(testClientSecret1),
+			err:    ErrInvalidAssertion,
+		},
+		"secret_client": {
+			claims: func() jwt.RegisteredClaims {
+				c := valid()
+				c.Issuer, c.Subject = testClientID1, testClientID1
+				return c
+			},
+			err: ErrInvalidAssertion,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestService()
+			srv.assertionAudiences = []string{"https://iam.example.com/iam/v1/oauth2/token"}
+			srv.clientKeys.client.Transport = keySet.Client().Transport
+			client := models.Secret{AppName: "assertion", TokenEndpointAuthMethod: models.AuthMethodPrivateKeyJWT, PublicKey: publicKey}
+			if tt.jwks {
+				client.PublicKey, client.JWKSURI = "", keySet.URL
+			}
+			srv.IAM[testAssertionClientID] = client
+
+			method, signingKey := tt.method, tt.key
+			if method == nil {
+				method = jwt.SigningMethodES256
+			}
+			if signingKey == nil {
+				signingKey = key
+			}
+			token := jwt.NewWithClaims(method, tt.claims())
+			token.Header["kid"] = "key-1"
+			assertion, err := token.SignedString(signingKey)
+			assert.NoError(t, err)
+
+			req := models.TokenRequest{ClientID: tt.clientID, ClientAssertion: assertion}
+			if tt.replay {
+				_, err = srv.GenerateToken(ctx, req)
+				assert.NoError(t, err)
+			}
+			issued, err := srv.GenerateToken(ctx, req)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+				return
+			}
+			assert.NoError(t, err)
+			introspection, err := srv.IntrospectToken(ctx, models.IntrospectionRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, Token: issued.AccessToken})
+			assert.NoError(t, err)
+			assert.Equal(t, testAssertionClientID, introspection.ClientID)
+		})
+	}
+}
+
+func TestService_GenerateToken_AuthMethodMismatch(t *testing.T) {
+	ctx := context.TODO()
+	srv := newTestService()
+	// clients of private_key_jwt cannot use their secret
+	client := srv.IAM[testClientID1]
+	client.TokenEndpointAuthMethod = models.AuthMethodPrivateKeyJWT
+	srv.IAM[testClientID1] = client
+
+	_, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.ErrorIs(t, err, ErrAuthMethodMismatch)
+}
+
+func TestKeySetCache_Lookup(t *testing.T) {
+	ctx := context.TODO()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	pub, err := jwk.New(&key.PublicKey)
+	assert.NoError(t, err)
+	pub.KeyID = "key-1"
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		_ = json.NewEncoder(w).Encode(jwk.Set{Keys: []jwk.Key{pub}})
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(jwk.Set{Keys: []jwk.Key{pub}})
+	}))
+	defer fast.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(fast.URL, http.StatusFound))
+	defer redirect.Close()
+
+	cache := newKeySetCache()
+
+	// a slow key set only delays the lookups of its own uri
+	done := make(chan error, 1)
+	go func() {
+		_, err := cache.lookup(ctx, slow.URL, "key-1")
+		done <- err
+	}()
+	k, err := cache.lookup(ctx, fast.URL, "key-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "key-1", k.KeyID)
+	close(release)
+	assert.NoError(t, <-done)
+
+	// redirects are not followed
+	_, err = cache.lookup(ctx, redirect.URL, "key-1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,219 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ingka-group/iam-proxy/internal/credentials"
+	"github.com/ingka-group/iam-proxy/internal/models"
+	"github.com/ingka-group/iam-proxy/internal/secret"
+)
+
+// ErrInvalidClient marks a client change that is rejected.
+var ErrInvalidClient = errors.New("client is invalid")
+
+// clientIDPattern restricts the ids of created clients to characters that are safe in URLs and file names.
+var clientIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._~-]{0,254}$`)
+
+// AuthorizeAdmin confirms the access token was issued by this service with the admin scope, and that the request
+// presents the proof of the key a bound token is bound to, like ValidateToken.
+func (s *Service) AuthorizeAdmin(ctx context.Context, req models.ValidationRequest) error {
+	req.Audience = ""
+	req.Scope = []string{models.ScopeAdmin}
+	return s.ValidateToken(ctx, req)
+}
+
+// Clients returns all clients.
+func (s *Service) Clients(ctx context.Context) (models.IAM, error) {
+	return s.credentialStore().Clients(ctx)
+}
+
+// Client returns the client, credentials.ErrNotFound when it does not exist.
+func (s *Service) Client(ctx context.Context, id models.ClientID) (models.Secret, error) {
+	return s.credentialStore().Client(ctx, id)
+}
+
+// CreateClient stores a new client with a generated secret, returning the id and the secret. The secret is
+// stored as a hash only, so it cannot be told again. An id is generated when none is given. Clients
+// authenticating with another method get no secret.
+func (s *Service) CreateClient(ctx context.Context, id models.ClientID, client models.Secret) (models.ClientID, string, error) {
+	store, err := s.writableStore()
+	if err != nil {
+		return "", "", err
+	}
+	if len(id) == 0 {
+		id = models.ClientID(uuid.New().String())
+	}
+	if !clientIDPattern.MatchString(string(id)) {
+		return "", "", fmt.Errorf("%w: client id %q has unsupported characters", ErrInvalidClient, id)
+	}
+
+	var clientSecret, hash string
+	if client.UsesClientSecret() {
+		if clientSecret, hash, err = newClientSecret(); err != nil {
+			return "", "", err
+		}
+	}
+	client.ClientSecret = hash
+	client.ExpirationDate = time.Time{}
+	client.ClientSecrets = nil
+	client.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	if err := credentials.Validate(models.IAM{id: client}); err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidClient, err)
+	}
+	if err := s.checkTokenLifetimes(client); err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidClient, err)
+	}
+	if err := store.CreateClient(ctx, id, client); err != nil {
+		return "", "", err
+	}
+	return id, clientSecret, nil
+}
+
+// UpdateClient replaces the settings of the client, keeping its secrets and creation time.
+func (s *Service) UpdateClient(ctx context.Context, id models.ClientID, client models.Secret) (models.Secret, error) {
+	store, err := s.writableStore()
+	if err != nil {
+		return models.Secret{}, err
+	}
+	current, err := store.Client(ctx, id)
+	if err != nil {
+		return models.Secret{}, err
+	}
+	client.ClientSecret = current.ClientSecret
+	client.ExpirationDate = current.ExpirationDate
+	client.ClientSecrets = current.ClientSecrets
+	client.CreatedAt = current.CreatedAt
+	if err := credentials.Validate(models.IAM{id: client}); err != nil {
+		return models.Secret{}, fmt.Errorf("%w: %w", ErrInvalidClient, err)
+	}
+	if err := s.checkTokenLifetimes(client); err != nil {
+		return models.Secret{}, fmt.Errorf("%w: %w", ErrInvalidClient, err)
+	}
+	if err := store.UpdateClient(ctx, id, client); err != nil {
+		return models.Secret{}, err
+	}
+	return client, nil
+}
+
+// DisableClient stops the client from obtaining tokens.
+func (s *Service) DisableClient(ctx context.Context, id models.ClientID) error {
+	store, err := s.writableStore()
+	if err != nil {
+		return err
+	}
+	client, err := store.Client(ctx, id)
+	if err != nil {
+		return err
+	}
+	client.Disabled = true
+	return store.UpdateClient(ctx, id, client)
+}
+
+// DeleteClient removes the client.
+func (s *Service) DeleteClient(ctx context.Context, id models.ClientID) error {
+	store, err := s.writableStore()
+	if err != nil {
+		return err
+	}
+	return store.DeleteClient(ctx, id)
+}
+
+// RotateClientSecret replaces the secrets of the client with a generated one, returning it. The previous
+// secrets stay valid for the overlap, so the client can be rolled without downtime.
+func (s *Service) RotateClientSecret(ctx context.Context, id models.ClientID, overlap time.Duration) (string, error) {
+	store, err := s.writableStore()
+	if err != nil {
+		return "", err
+	}
+	client, err := store.Client(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if !client.UsesClientSecret() {
+		return "", fmt.Errorf("%w: %s authenticates with %s", ErrInvalidClient, id, client.TokenEndpointAuthMethod)
+	}
+	clientSecret, hash, err := newClientSecret()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	var previous []models.ClientSecret
+	if overlap > 0 {
+		until := now.Add(overlap)
+		for _, cs := range client.Secrets() {
+			if cs.ExpiresAt.IsZero() || cs.ExpiresAt.After(until) {
+				cs.ExpiresAt = until
+			}
+			if cs.Expired(now) || (!cs.NotBefore.IsZero() && !cs.NotBefore.Before(cs.ExpiresAt)) {
+				continue
+			}
+			previous = append(previous, cs)
+		}
+	}
+	client.ClientSecret = hash
+	client.ExpirationDate = time.Time{}
+	client.ClientSecrets = previous
+	if err := store.UpdateClient(ctx, id, client); err != nil {
+		return "", err
+	}
+	return clientSecret, nil
+}
+
+// checkTokenLifetimes rejects token lifetimes of the client outlasting the retention of rotated keys, which
+// would cut them short.
+func (s *Service) checkTokenLifetimes(client models.Secret) error {
+	if s.keyRetention <= 0 {
+		return nil
+	}
+	retention := int64(s.keyRetention / time.Second)
+	if client.ExpiresIn > retention {
+		return fmt.Errorf("expires_in %d exceeds the key retention %s", client.ExpiresIn, s.keyRetention)
+	}
+	if s.identityKey == nil && client.IdentityExpiresIn > retention {
+		return fmt.Errorf("identity_expires_in %d exceeds the key retention %s", client.IdentityExpiresIn, s.keyRetention)
+	}
+	return nil
+}
+
+// writableStore returns the credential store when its clients can be changed.
+func (s *Service) writableStore() (WritableCredentialStore, error) {
+	store, ok := s.credentialStore().(WritableCredentialStore)
+	if !ok {
+		return nil, credentials.ErrReadOnly
+	}
+	return store, nil
+}
+
+// newClientSecret generates a client secret, returning it with its hash.
+func newClientSecret() (string, string, error) {
+	clientSecret, err := secret.Generate()
+	if err != nil {
+		return "", "", err
+	}
+	hash, err := secret.Hash(clientSecret)
+	if err != nil {
+		return "", "", fmt.Errorf("could not hash client secret: %w", err)
+	}
+	return clientSecret, hash, nil
+}
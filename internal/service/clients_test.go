@@ -0,0 +1,131 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ingka-group/iam-proxy/client/jwt"
+	"github.com/ingka-group/iam-proxy/internal/config"
+	"github.com/ingka-group/iam-proxy/internal/credentials"
+	"github.com/ingka-group/iam-proxy/internal/database"
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+func TestService_ManageClients(t *testing.T) {
+	ctx := context.TODO()
+	dsn := filepath.Join(t.TempDir(), "clients.db")
+	srv, err := New(context.TODO(), defaultConfig(config.IAM{UsersDriver: database.DriverSQLite, UsersDSN: dsn, Secret: "test"}))
+	assert.NoError(t, err)
+
+	// an admin token requires the admin scope
+	adminID, adminSecret, err := srv.CreateClient(ctx, "admin", models.Secret{AppName: "admin", Scopes: []string{models.ScopeAdmin}})
+	assert.NoError(t, err)
+	assert.Equal(t, models.ClientID("admin"), adminID)
+	issued, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: "admin", ClientSecret: adminSecret, Scope: []string{models.ScopeAdmin}})
+	access := issued.AccessToken
+	assert.NoError(t, err)
+	assert.NoError(t, srv.AuthorizeAdmin(ctx, models.ValidationRequest{Token: access}))
+	issued, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: "admin", ClientSecret: adminSecret})
+	access = issued.AccessToken
+	assert.NoError(t, err)
+	assert.ErrorIs(t, srv.AuthorizeAdmin(ctx, models.ValidationRequest{Token: access}), ErrInsufficientScope)
+	assert.Error(t, srv.AuthorizeAdmin(ctx, models.ValidationRequest{Token: "not a token"}))
+
+	// created clients get a generated id and secret, stored as a hash
+	id, clientSecret, err := srv.CreateClient(ctx, "", models.Secret{AppName: "app", Audiences: []string{"billing"}})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, id)
+	client, err := srv.Client(ctx, id)
+	assert.NoError(t, err)
+	assert.NotEqual(t, clientSecret, client.ClientSecret)
+	req := models.TokenRequest{ClientID: string(id), ClientSecret: clientSecret}
+	_, err = srv.GenerateToken(ctx, req)
+	assert.NoError(t, err)
+	_, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: string(id), ClientSecret: clientSecret, Scope: []string{models.ScopeAdmin}})
+	assert.Error(t, err)
+
+	_, _, err = srv.CreateClient(ctx, id, models.Secret{AppName: "app"})
+	assert.ErrorIs(t, err, credentials.ErrExists)
+	_, _, err = srv.CreateClient(ctx, "../escape", models.Secret{AppName: "app"})
+	assert.ErrorIs(t, err, ErrInvalidClient)
+	_, _, err = srv.CreateClient(ctx, "negative", models.Secret{AppName: "app", ExpiresIn: -1})
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	// updates keep the secrets
+	updated, err := srv.UpdateClient(ctx, id, models.Secret{AppName: "renamed", ClientSecret: "ignored"})
+	assert.NoError(t, err)
+	assert.Equal(t, "renamed", updated.AppName)
+	assert.Equal(t, client.ClientSecret, updated.ClientSecret)
+	_, err = srv.UpdateClient(ctx, "missing", models.Secret{AppName: "app"})
+	assert.ErrorIs(t, err, credentials.ErrNotFound)
+
+	// rotated secrets keep the previous secret valid for the overlap only
+	rotated, err := srv.RotateClientSecret(ctx, id, time.Hour)
+	assert.NoError(t, err)
+	_, err = srv.GenerateToken(ctx, req)
+	assert.NoError(t, err)
+	_, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: string(id), ClientSecret: rotated})
+	assert.NoError(t, err)
+	client, err = srv.Client(ctx, id)
+	assert.NoError(t, err)
+	assert.Len(t, client.Secrets(), 2)
+
+	again, err := srv.RotateClientSecret(ctx, id, 0)
+	assert.NoError(t, err)
+	_, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: string(id), ClientSecret: rotated})
+	assert.ErrorIs(t, err, ErrSecretMismatch)
+	req.ClientSecret = again
+	_, err = srv.GenerateToken(ctx, req)
+	assert.NoError(t, err)
+
+	// clients of private_key_jwt have no secret to rotate
+	keyID, keySecret, err := srv.CreateClient(ctx, "", models.Secret{AppName: "keyed", TokenEndpointAuthMethod: models.AuthMethodPrivateKeyJWT, JWKSURI: "https://keyed.example.com/jwks.json"})
+	assert.NoError(t, err)
+	assert.Empty(t, keySecret)
+	_, err = srv.RotateClientSecret(ctx, keyID, 0)
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	// disabled clients cannot obtain tokens
+	assert.NoError(t, srv.DisableClient(ctx, id))
+	_, err = srv.GenerateToken(ctx, req)
+	assert.ErrorIs(t, err, ErrClientDisabled)
+
+	assert.NoError(t, srv.DeleteClient(ctx, id))
+	assert.ErrorIs(t, srv.DeleteClient(ctx, id), credentials.ErrNotFound)
+	_, err = srv.Client(ctx, id)
+	assert.ErrorIs(t, err, credentials.ErrNotFound)
+}
+
+func TestService_ManageClients_ReadOnly(t *testing.T) {
+	ctx := context.TODO()
+	users := jwt.Base64Encode([]byte(`{"<client_id>" : { "client_secret" : "<client_secret>" , "app_name" : "<demo>" } }`))
+	srv, err := New(context.TODO(), defaultConfig(config.IAM{Users: users, Secret: "test"}))
+	assert.NoError(t, err)
+
+	clients, err := srv.Clients(ctx)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, clients)
+	_, _, err = srv.CreateClient(ctx, "new", models.Secret{AppName: "app"})
+	assert.ErrorIs(t, err, credentials.ErrReadOnly)
+	_, err = srv.RotateClientSecret(ctx, "<client_id>", 0)
+	assert.ErrorIs(t, err, credentials.ErrReadOnly)
+	assert.ErrorIs(t, srv.DeleteClient(ctx, "<client_id>"), credentials.ErrReadOnly)
+}
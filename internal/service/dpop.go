@@ -0,0 +1,256 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ingka-group/iam-proxy/client/jwk"
+	"github.com/ingka-group/iam-proxy/internal/keys"
+	"github.com/ingka-group/iam-proxy/internal/models"
+	"github.com/ingka-group/iam-proxy/internal/replay"
+)
+
+const (
+	// dpopProofType is the typ header of DPoP proofs.
+	dpopProofType = "dpop+jwt"
+	// maxProofAge bounds how long after it was issued a DPoP proof is accepted, and so kept against replays.
+	maxProofAge = 5 * time.Minute
+	// nonceLifetime is how long a DPoP nonce issued by the service is accepted.
+	nonceLifetime = 5 * time.Minute
+)
+
+// Reasons a DPoP proof is rejected.
+var (
+	ErrInvalidDPoPProof = errors.New("DPoP proof is invalid")
+	// ErrDPoPProofRequired marks requests lacking the DPoP proof that their client or token requires.
+	ErrDPoPProofRequired = errors.New("DPoP proof is required")
+	// ErrDPoPNonceRequired marks DPoP proofs without a valid nonce of the service, the client must retry with
+	// the nonce from DPoPNonce.
+	ErrDPoPNonceRequired = errors.New("DPoP proof must carry a nonce of the service")
+)
+
+// proofClaims are the claims of a DPoP proof, see RFC 9449 section 4.2.
+type proofClaims struct {
+	jwt.RegisteredClaims
+	Method string `json:"htm"`
+	URL    string `json:"htu"`
+	// AccessTokenHash is the hash of the access token the proof is presented with.
+	AccessTokenHash string `json:"ath,omitempty"`
+	Nonce           string `json:"nonce,omitempty"`
+}
+
+// dpopBinding returns the thumbprint of the DPoP key the access tokens of the request are bound to, empty for
+// requests without a proof. Clients of DPoPBoundAccessTokens must present one.
+func (s *Service) dpopBinding(ctx context.Context, client models.Secret, req models.TokenRequest) (string, error) {
+	if len(req.DPoP.Proof) == 0 {
+		if client.DPoPBoundAccessTokens {
+			return "", fmt.Errorf("%s must present a DPoP proof: %w", client.AppName, ErrDPoPProofRequired)
+		}
+		return "", nil
+	}
+	return s.verifyProof(ctx, req.DPoP, "")
+}
+
+// dpopBound tells whether the token of the confirmation is bound to a DPoP key.
+func dpopBound(cnf *models.Confirmation) bool {
+	return cnf != nil && len(cnf.JWKThumbprint) > 0
+}
+
+// verifyDPoPBinding checks that the request presents a DPoP proof of the key the token is bound to, if any.
+func (s *Service) verifyDPoPBinding(ctx context.Context, cnf *models.Confirmation, token string, proof models.DPoPProof) error {
+	if !dpopBound(cnf) {
+		return nil
+	}
+	if len(proof.Proof) == 0 {
+		return fmt.Errorf("token is bound to a DPoP key: %w", ErrDPoPProofRequired)
+	}
+	thumbprint, err := s.verifyProof(ctx, proof, token)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(thumbprint), []byte(cnf.JWKThumbprint)) != 1 {
+		return fmt.Errorf("%w: key does not match the token", ErrInvalidDPoPProof)
+	}
+	return nil
+}
+
+// verifyProof verifies the DPoP proof for its request, see RFC 9449 section 4.3, and returns the thumbprint of
+// its key. A proof presented with an access token must carry its hash. Each proof is accepted once only.
+func (s *Service) verifyProof(ctx context.Context, proof models.DPoPProof, accessToken string) (string, error) {
+	var (
+		claims proofClaims
+		key    jwk.Key
+	)
+	_, err := jwt.ParseWithClaims(proof.Proof, &claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != dpopProofType {
+			return nil, errors.New("typ must be " + dpopProofType)
+		}
+		header, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("jwk is missing")
+		}
+		if _, private := header["d"]; private {
+			return nil, errors.New("jwk must not be a private key")
+		}
+		raw, err := json.Marshal(header)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &key); err != nil {
+			return nil, fmt.Errorf("jwk is invalid: %w", err)
+		}
+		pub, err := key.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		// the same keys are accepted as for signing tokens, RSA ones of 2048 bits at least
+		verifying, err := keys.NewPublic(pub, token.Method.Alg())
+		if err != nil {
+			return nil, fmt.Errorf("jwk is not supported: %w", err)
+		}
+		return verifying.VerificationKey(), nil
+	}, jwt.WithValidMethods(assertionMethods), jwt.WithLeeway(s.validation.leeway))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidDPoPProof, err)
+	}
+
+	if len(claims.ID) == 0 {
+		return "", fmt.Errorf("%w: jti is missing", ErrInvalidDPoPProof)
+	}
+	if claims.Method != proof.Method {
+		return "", fmt.Errorf("%w: htm does not match the request", ErrInvalidDPoPProof)
+	}
+	if normalizeURL(claims.URL) != normalizeURL(proof.URL) {
+		return "", fmt.Errorf("%w: htu does not match the request", ErrInvalidDPoPProof)
+	}
+	if claims.IssuedAt == nil {
+		return "", fmt.Errorf("%w: iat is missing", ErrInvalidDPoPProof)
+	}
+	now := time.Now()
+	issuedAt := claims.IssuedAt.Time
+	if issuedAt.After(now.Add(s.validation.leeway)) || issuedAt.Before(now.Add(-maxProofAge-s.validation.leeway)) {
+		return "", fmt.Errorf("%w: iat is not recent", ErrInvalidDPoPProof)
+	}
+	if len(accessToken) > 0 {
+		sum := sha256.Sum256([]byte(accessToken))
+		if claims.AccessTokenHash != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			return "", fmt.Errorf("%w: ath does not match the access token", ErrInvalidDPoPProof)
+		}
+	}
+	if s.dpopNonces.required && !s.dpopNonces.valid(claims.Nonce, now, s.validation.leeway) {
+		return "", ErrDPoPNonceRequired
+	}
+
+	thumbprint, err := key.Thumbprint()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidDPoPProof, err)
+	}
+	err = s.replays.Use(ctx, "dpop:"+thumbprint+":"+claims.ID, issuedAt.Add(maxProofAge+s.validation.leeway))
+	if errors.Is(err, replay.ErrReplayed) {
+		return "", fmt.Errorf("%w: proof was used already", ErrInvalidDPoPProof)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not check DPoP proof replay: %w", err)
+	}
+	return thumbprint, nil
+}
+
+// normalizeURL returns the URL without query and fragment, its scheme and host in lower case and without the
+// default port, see RFC 9449 section 4.3.
+func normalizeURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Host)
+	if port := u.Port(); (scheme == "https" && port == "443") || (scheme == "http" && port == "80") {
+		host = strings.ToLower(u.Hostname())
+	}
+	path := u.EscapedPath()
+	if len(path) == 0 {
+		path = "/"
+	}
+	return scheme + "://" + host + path
+}
+
+// DPoPNonce returns a fresh nonce for DPoP proofs, empty when nonces are not required.
+func (s *Service) DPoPNonce(_ context.Context) (string, error) {
+	if !s.dpopNonces.required {
+		return "", nil
+	}
+	return s.dpopNonces.issue(time.Now()), nil
+}
+
+// nonceSource issues and checks the nonces of DPoP proofs, see RFC 9449 section 8. A nonce is the time it was
+// issued along with its HMAC, so the service keeps no state and replicas sharing the key accept each other's.
+type nonceSource struct {
+	required bool
+	key      []byte
+}
+
+// newNonceSource returns the nonces authenticated with the secret, or a random key when it is empty.
+func newNonceSource(required bool, secret string) (nonceSource, error) {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nonceSource{}, fmt.Errorf("could not generate DPoP nonce key: %w", err)
+		}
+	}
+	return nonceSource{required: required, key: key}, nil
+}
+
+// issue returns the nonce issued at the given time.
+func (n nonceSource) issue(now time.Time) string {
+	b := binary.BigEndian.AppendUint64(nil, uint64(now.Unix()))
+	return base64.RawURLEncoding.EncodeToString(append(b, n.mac(b)...))
+}
+
+// valid tells whether the nonce was issued by the service within nonceLifetime, tolerating the clock skew
+// between replicas up to the leeway.
+func (n nonceSource) valid(nonce string, now time.Time, leeway time.Duration) bool {
+	b, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(b) <= 8 {
+		return false
+	}
+	if !hmac.Equal(b[8:], n.mac(b[:8])) {
+		return false
+	}
+	issuedAt := time.Unix(int64(binary.BigEndian.Uint64(b[:8])), 0)
+	return !issuedAt.After(now.Add(leeway)) && now.Sub(issuedAt) <= nonceLifetime+leeway
+}
+
+// mac returns the HMAC of the issue time.
+func (n nonceSource) mac(issuedAt []byte) []byte {
+	h := hmac.New(sha256.New, n.key)
+	h.Write(issuedAt)
+	return h.Sum(nil)
+}
@@ -0,0 +1,382 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ingka-group/iam-proxy/client/jwk"
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+const (
+	testTokenURL    = "https://iam.example.com/iam/v1/oauth2/token"
+	testResourceURL = "https://billing.example.com/invoices"
+	testAdminURL    = "https://iam.example.com/iam/v1/admin/clients"
+)
+
+func TestService_GenerateToken_DPoP(t *testing.T) {
+	ctx := context.TODO()
+	key := testDPoPKey(t)
+
+	type test struct {
+		// claims and header change the claims and the header of a valid proof
+		claims func(jwt.MapClaims)
+		header func(map[string]interface{})
+		// none presents no proof
+		none bool
+		// required requires proofs of the client
+		required bool
+		// nonce requires a nonce of the service
+		nonce bool
+		// replay presents the proof a second time
+		replay bool
+		err    error
+	}
+
+	tests := map[string]test{
+		"proof": {},
+		"required": {
+			required: true,
+		},
+		"bearer": {
+			none: true,
+		},
+		"required_missing": {
+			none:     true,
+			required: true,
+			err:      ErrDPoPProofRequired,
+		},
+		"nonce": {
+			nonce: true,
+			claims: func(c jwt.MapClaims) {
+				c["nonce"] = testNonces().issue(time.Now())
+			},
+		},
+		"nonce_missing": {
+			nonce: true,
+			err:   ErrDPoPNonceRequired,
+		},
+		"nonce_expired": {
+			nonce: true,
+			claims: func(c jwt.MapClaims) {
+				c["nonce"] = testNonces().issue(time.Now().Add(-2 * nonceLifetime))
+			},
+			err: ErrDPoPNonceRequired,
+		},
+		"replayed": {
+			replay: true,
+			err:    ErrInvalidDPoPProof,
+		},
+		"type_mismatch": {
+			header: func(h map[string]interface{}) {
+				h["typ"] = "JWT"
+			},
+			err: ErrInvalidDPoPProof,
+		},
+		"key_missing": {
+			header: func(h map[string]interface{}) {
+				delete(h, "jwk")
+			},
+			err: ErrInvalidDPoPProof,
+		},
+		"private_key": {
+			header: func(h map[string]interface{}) {
+				h["jwk"].(map[string]interface{})["d"] = "private"
+			},
+			err: ErrInvalidDPoPProof,
+		},
+		"method_mismatch": {
+			claims: func(c jwt.MapClaims) {
+				c["htm"] = http.MethodGet
+			},
+			err: ErrInvalidDPoPProof,
+		},
+		"url_mismatch": {
+			claims: func(c jwt.MapClaims) {
+				c["htu"] = testResourceURL
+			},
+			err: ErrInvalidDPoPProof,
+		},
+		"url_normalized": {
+			claims: func(c jwt.MapClaims) {
+				c["htu"] = "HTTPS://IAM.example.com:443/iam/v1/oauth2/token?query#fragment"
+			},
+		},
+		"issued_long_ago": {
+			claims: func(c jwt.MapClaims) {
+				c["iat"] = time.Now().Add(-2 * maxProofAge).Unix()
+			},
+			err: ErrInvalidDPoPProof,
+		},
+		"issued_in_future": {
+			claims: func(c jwt.MapClaims) {
+				c["iat"] = time.Now().Add(time.Minute).Unix()
+			},
+			err: ErrInvalidDPoPProof,
+		},
+		"id_missing": {
+			claims: func(c jwt.MapClaims) {
+				delete(c, "jti")
+			},
+			err: ErrInvalidDPoPProof,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestService()
+			srv.dpopNonces = testNonces()
+			srv.dpopNonces.required = tt.nonce
+			client := srv.IAM[testClientID1]
+			client.DPoPBoundAccessTokens = tt.required
+			srv.IAM[testClientID1] = client
+
+			req := models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1}
+			if !tt.none {
+				req.DPoP = models.DPoPProof{
+					Proof:  testDPoPProof(t, key, http.MethodPost, testTokenURL, tt.claims, tt.header),
+					Method: http.MethodPost,
+					URL:    testTokenURL,
+				}
+			}
+			if tt.replay {
+				_, err := srv.GenerateToken(ctx, req)
+				assert.NoError(t, err)
+			}
+			issued, err := srv.GenerateToken(ctx, req)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, !tt.none, issued.DPoP)
+
+			claims := unverifiedClaims(t, issued.AccessToken)
+			if tt.none {
+				assert.Nil(t, claims.Confirmation)
+				return
+			}
+			pub, err := jwk.New(&key.PublicKey)
+			assert.NoError(t, err)
+			thumbprint, err := pub.Thumbprint()
+			assert.NoError(t, err)
+			assert.Equal(t, &models.Confirmation{JWKThumbprint: thumbprint}, claims.Confirmation)
+		})
+	}
+}
+
+func TestService_GenerateToken_DPoPRSA(t *testing.T) {
+	ctx := context.TODO()
+	srv := newTestService()
+
+	for bits, wantErr := range map[int]error{1024: ErrInvalidDPoPProof, 2048: nil} {
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		assert.NoError(t, err)
+		pub, err := jwk.New(&key.PublicKey)
+		assert.NoError(t, err)
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"jti": uuid.New().String(),
+			"htm": http.MethodPost,
+			"htu": testTokenURL,
+			"iat": time.Now().Unix(),
+		})
+		token.Header["typ"] = dpopProofType
+		token.Header["jwk"] = pub
+		proof, err := token.SignedString(key)
+		assert.NoError(t, err)
+
+		_, err = srv.GenerateToken(ctx, models.TokenRequest{
+			ClientID:     testClientID1,
+			ClientSecret: testClientSecret1,
+			DPoP:         models.DPoPProof{Proof: proof, Method: http.MethodPost, URL: testTokenURL},
+		})
+		if wantErr != nil {
+			assert.ErrorIs(t, err, wantErr, "%d bits", bits)
+			continue
+		}
+		assert.NoError(t, err, "%d bits", bits)
+	}
+}
+
+func TestService_ValidateToken_DPoP(t *testing.T) {
+	ctx := context.TODO()
+	key := testDPoPKey(t)
+	otherKey := testDPoPKey(t)
+	srv := newTestService()
+
+	issued, err := srv.GenerateToken(ctx, models.TokenRequest{
+		ClientID:     testClientID1,
+		ClientSecret: testClientSecret1,
+		DPoP:         models.DPoPProof{Proof: testDPoPProof(t, key, http.MethodPost, testTokenURL, nil, nil), Method: http.MethodPost, URL: testTokenURL},
+	})
+	assert.NoError(t, err)
+	sum := sha256.Sum256([]byte(issued.AccessToken))
+	ath := base64.RawURLEncoding.EncodeToString(sum[:])
+	withHash := func(c jwt.MapClaims) {
+		c["ath"] = ath
+	}
+	resource := func(proof string) models.ValidationRequest {
+		return models.ValidationRequest{
+			Token: issued.AccessToken,
+			DPoP:  models.DPoPProof{Proof: proof, Method: http.MethodGet, URL: testResourceURL},
+		}
+	}
+
+	// the proof of the key for the request validates the token, once
+	proof := testDPoPProof(t, key, http.MethodGet, testResourceURL, withHash, nil)
+	assert.NoError(t, srv.ValidateToken(ctx, resource(proof)))
+	assert.ErrorIs(t, srv.ValidateToken(ctx, resource(proof)), ErrInvalidDPoPProof)
+
+	// presented as a bearer token or with the proof of another key, access token or request it is rejected
+	assert.ErrorIs(t, srv.ValidateToken(ctx, models.ValidationRequest{Token: issued.AccessToken}), ErrDPoPProofRequired)
+	assert.ErrorIs(t, srv.ValidateToken(ctx, resource(testDPoPProof(t, otherKey, http.MethodGet, testResourceURL, withHash, nil))), ErrInvalidDPoPProof)
+	assert.ErrorIs(t, srv.ValidateToken(ctx, resource(testDPoPProof(t, key, http.MethodGet, testResourceURL, nil, nil))), ErrInvalidDPoPProof)
+	assert.ErrorIs(t, srv.ValidateToken(ctx, resource(testDPoPProof(t, key, http.MethodDelete, testResourceURL, withHash, nil))), ErrInvalidDPoPProof)
+
+	// introspection describes the binding, and checks a given proof
+	introspection, err := srv.IntrospectToken(ctx, models.IntrospectionRequest{ClientID: testClientID2, ClientSecret: testClientSecret2, Token: issued.AccessToken})
+	assert.NoError(t, err)
+	assert.True(t, introspection.Active)
+	assert.Equal(t, unverifiedClaims(t, issued.AccessToken).Confirmation, introspection.Confirmation)
+	introspection, err = srv.IntrospectToken(ctx, models.IntrospectionRequest{
+		ClientID:     testClientID2,
+		ClientSecret: testClientSecret2,
+		Token:        issued.AccessToken,
+		DPoP:         resource(testDPoPProof(t, key, http.MethodGet, testResourceURL, withHash, nil)).DPoP,
+	})
+	assert.NoError(t, err)
+	assert.True(t, introspection.Active)
+	introspection, err = srv.IntrospectToken(ctx, models.IntrospectionRequest{
+		ClientID:     testClientID2,
+		ClientSecret: testClientSecret2,
+		Token:        issued.AccessToken,
+		DPoP:         resource(testDPoPProof(t, otherKey, http.MethodGet, testResourceURL, withHash, nil)).DPoP,
+	})
+	assert.NoError(t, err)
+	assert.False(t, introspection.Active)
+
+	// bearer tokens are valid without a proof
+	bearer, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	assert.NoError(t, err)
+	assert.NoError(t, srv.ValidateToken(ctx, models.ValidationRequest{Token: bearer.AccessToken}))
+}
+
+func TestService_AuthorizeAdmin_DPoP(t *testing.T) {
+	ctx := context.TODO()
+	key := testDPoPKey(t)
+	srv := newTestService()
+	client := srv.IAM[testClientID1]
+	client.Scopes = []string{models.ScopeAdmin}
+	srv.IAM[testClientID1] = client
+
+	issued, err := srv.GenerateToken(ctx, models.TokenRequest{
+		ClientID:     testClientID1,
+		ClientSecret: testClientSecret1,
+		Scope:        []string{models.ScopeAdmin},
+		DPoP:         models.DPoPProof{Proof: testDPoPProof(t, key, http.MethodPost, testTokenURL, nil, nil), Method: http.MethodPost, URL: testTokenURL},
+	})
+	assert.NoError(t, err)
+	sum := sha256.Sum256([]byte(issued.AccessToken))
+	withHash := func(c jwt.MapClaims) {
+		c["ath"] = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	// a DPoP-bound admin token is refused as a bearer token, and accepted with the proof of its key
+	assert.ErrorIs(t, srv.AuthorizeAdmin(ctx, models.ValidationRequest{Token: issued.AccessToken}), ErrDPoPProofRequired)
+	proof := models.DPoPProof{
+		Proof:  testDPoPProof(t, key, http.MethodGet, testAdminURL, withHash, nil),
+		Method: http.MethodGet,
+		URL:    testAdminURL,
+	}
+	assert.NoError(t, srv.AuthorizeAdmin(ctx, models.ValidationRequest{Token: issued.AccessToken, DPoP: proof}))
+}
+
+func TestNonceSource(t *testing.T) {
+	nonces := testNonces()
+	now := time.Now()
+	nonce := nonces.issue(now)
+
+	assert.True(t, nonces.valid(nonce, now, 0))
+	assert.True(t, nonces.valid(nonce, now.Add(nonceLifetime-time.Second), 0))
+	assert.False(t, nonces.valid(nonce, now.Add(nonceLifetime+time.Second), 0))
+	assert.False(t, nonces.valid("", now, 0))
+	assert.False(t, nonces.valid("not-a-nonce", now, 0))
+
+	// the leeway tolerates replicas whose clocks are apart
+	assert.False(t, nonces.valid(nonce, now.Add(-2*time.Second), 0))
+	assert.True(t, nonces.valid(nonce, now.Add(-2*time.Second), 5*time.Second))
+	assert.True(t, nonces.valid(nonce, now.Add(nonceLifetime+time.Second), 5*time.Second))
+	assert.False(t, nonces.valid(nonce, now.Add(nonceLifetime+10*time.Second), 5*time.Second))
+
+	// nonces of another key are rejected, those of a replica sharing it accepted
+	other, err := newNonceSource(true, "")
+	assert.NoError(t, err)
+	assert.False(t, other.valid(nonce, now, 0))
+	assert.True(t, testNonces().valid(nonce, now, 0))
+}
+
+func testNonces() nonceSource {
+	return nonceSource{required: true, key: []byte("nonce-secret")}
+}
+
+func testDPoPKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	return key
+}
+
+// testDPoPProof returns a DPoP proof of the key for the request, changed by claims and header when given.
+func testDPoPProof(t *testing.T, key *ecdsa.PrivateKey, method, url string, claims func(jwt.MapClaims),
+	header func(map[string]interface{})) string {
+	pub, err := jwk.New(&key.PublicKey)
+	assert.NoError(t, err)
+	raw, err := json.Marshal(pub)
+	assert.NoError(t, err)
+	var publicKey map[string]interface{}
+	assert.NoError(t, json.Unmarshal(raw, &publicKey))
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"jti": uuid.New().String(),
+		"htm": method,
+		"htu": url,
+		"iat": time.Now().Unix(),
+	})
+	token.Header["typ"] = dpopProofType
+	token.Header["jwk"] = publicKey
+	if claims != nil {
+		claims(token.Claims.(jwt.MapClaims))
+	}
+	if header != nil {
+		header(token.Header)
+	}
+	proof, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return proof
+}
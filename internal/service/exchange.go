@@ -0,0 +1,104 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+// exchangeToken issues an access token to the client to call the requested audiences on behalf of the subject
+// of the subject token, see RFC 8693. The new token keeps the subject, records the client in its act claim
+// and has at most the scopes and lifetime of the subject token. The subject token must be an access token of
+// this service, meant for the client id when it is audience-restricted, and the exchange allowed by the policy
+// of the client.
+func (s *Service) exchangeToken(ctx context.Context, client models.Secret, req models.TokenRequest, cnf *models.Confirmation) (models.Token, error) {
+	appName := client.AppName
+	subject, err := s.parseClaims(ctx, req.SubjectToken, models.TokenUseAccess, "")
+	if errors.Is(err, errRevocationUnknown) {
+		return models.Token{}, err
+	}
+	if err != nil {
+		return models.Token{}, fmt.Errorf("%s may not exchange the token: %w: %w", appName, ErrInvalidSubjectToken, err)
+	}
+	// the app name is not unique, only the client id tells the client apart
+	if len(subject.Audience) > 0 && !slices.Contains(subject.Audience, req.ClientID) {
+		return models.Token{}, fmt.Errorf("%s may not exchange a token meant for others: %w", appName, ErrInvalidSubjectToken)
+	}
+	policy := client.TokenExchange
+	if len(policy.Subjects) > 0 && !slices.Contains(policy.Subjects, subject.ClientID) {
+		return models.Token{}, fmt.Errorf("%s may not exchange tokens of %s: %w", appName, subject.ClientID, ErrInvalidSubjectToken)
+	}
+
+	if len(req.Audience) == 0 {
+		return models.Token{}, fmt.Errorf("%s must exchange tokens for an audience: %w", appName, ErrAudienceNotAllowed)
+	}
+	for _, aud := range req.Audience {
+		if !slices.Contains(policy.Audiences, aud) {
+			return models.Token{}, fmt.Errorf("%s may not exchange tokens for audience %s: %w", appName, aud, ErrAudienceNotAllowed)
+		}
+	}
+	scope, err := narrow(strings.Fields(subject.Scope), req.Scope, ErrScopeNotAllowed)
+	if err != nil {
+		return models.Token{}, fmt.Errorf("%s may not widen the scope: %w", appName, err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.tokenExpiration(client, req.ExpiresIn))
+	if subject.ExpiresAt != nil && subject.ExpiresAt.Before(expiresAt) {
+		expiresAt = subject.ExpiresAt.Time
+	}
+	// the leeway may accept a subject token that already expired, which must not be exchanged for one as expired
+	if !expiresAt.After(now) {
+		return models.Token{}, fmt.Errorf("%s may not exchange an expired token: %w", appName, ErrInvalidSubjectToken)
+	}
+
+	accessToken, err := s.createToken(&Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Audience:  req.Audience,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    s.issuer,
+			Subject:   subject.Subject,
+		},
+		TokenUse:     models.TokenUseAccess,
+		Scope:        strings.Join(scope, " "),
+		ClientID:     req.ClientID,
+		Actor:        &models.Actor{Subject: appName, ClientID: req.ClientID, Actor: subject.Actor},
+		Confirmation: cnf,
+	})
+	if err != nil {
+		return models.Token{}, fmt.Errorf("could not generate access token for %s: %w", appName, err)
+	}
+
+	return models.Token{
+		AccessToken:     accessToken,
+		ExpiresIn:       int64(expiresAt.Sub(now).Seconds()),
+		Scope:           scope,
+		IssuedTokenType: models.TokenTypeAccessToken,
+		DPoP:            dpopBound(cnf),
+	}, nil
+}
@@ -0,0 +1,217 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+func TestService_GenerateToken_Exchange(t *testing.T) {
+	ctx := context.TODO()
+
+	type test struct {
+		// subject is the request of the subject token, by the first client
+		subject models.TokenRequest
+		// policy is the token exchange policy of the second client, the actor
+		policy   models.TokenExchange
+		audience []string
+		scope    []string
+		// revoke revokes the subject token before the exchange
+		revoke    bool
+		wantScope []string
+		err       error
+	}
+
+	subject := models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, Audience: []string{testClientID2}, Scope: []string{"read", "write"}}
+	policy := models.TokenExchange{Audiences: []string{"stock"}}
+
+	tests := map[string]test{
+		"exchange": {
+			subject:   subject,
+			policy:    policy,
+			audience:  []string{"stock"},
+			wantScope: []string{"read", "write"},
+		},
+		"narrowed_scope": {
+			subject:   subject,
+			policy:    policy,
+			audience:  []string{"stock"},
+			scope:     []string{"read"},
+			wantScope: []string{"read"},
+		},
+		"widened_scope": {
+			subject:  subject,
+			policy:   policy,
+			audience: []string{"stock"},
+			scope:    []string{"admin"},
+			err:      ErrScopeNotAllowed,
+		},
+		"subject_allowed": {
+			subject:   subject,
+			policy:    models.TokenExchange{Audiences: []string{"stock"}, Subjects: []string{testClientID1}},
+			audience:  []string{"stock"},
+			wantScope: []string{"read", "write"},
+		},
+		"subject_not_allowed": {
+			subject:  subject,
+			policy:   models.TokenExchange{Audiences: []string{"stock"}, Subjects: []string{"other"}},
+			audience: []string{"stock"},
+			err:      ErrInvalidSubjectToken,
+		},
+		"subject_token_for_others": {
+			subject:  models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, Audience: []string{"billing"}},
+			policy:   policy,
+			audience: []string{"stock"},
+			err:      ErrInvalidSubjectToken,
+		},
+		"subject_token_for_app_name": {
+			subject:  models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, Audience: []string{"atp"}},
+			policy:   policy,
+			audience: []string{"stock"},
+			err:      ErrInvalidSubjectToken,
+		},
+		"subject_token_revoked": {
+			subject:  subject,
+			policy:   policy,
+			audience: []string{"stock"},
+			revoke:   true,
+			err:      ErrInvalidSubjectToken,
+		},
+		"audience_missing": {
+			subject: subject,
+			policy:  policy,
+			err:     ErrAudienceNotAllowed,
+		},
+		"audience_not_allowed": {
+			subject:  subject,
+			policy:   policy,
+			audience: []string{"billing"},
+			err:      ErrAudienceNotAllowed,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestService()
+			caller := srv.IAM[testClientID1]
+			caller.Audiences = []string{testClientID2, "atp", "billing"}
+			caller.Scopes = []string{"read", "write"}
+			srv.IAM[testClientID1] = caller
+			actor := srv.IAM[testClientID2]
+			actor.GrantTypes = []string{models.GrantTypeTokenExchange}
+			actor.TokenExchange = tt.policy
+			srv.IAM[testClientID2] = actor
+
+			issued, err := srv.GenerateToken(ctx, tt.subject)
+			assert.NoError(t, err)
+			if tt.revoke {
+				assert.NoError(t, srv.RevokeToken(ctx, models.RevocationRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, Token: issued.AccessToken}))
+			}
+
+			exchanged, err := srv.GenerateToken(ctx, models.TokenRequest{
+				GrantType:    models.GrantTypeTokenExchange,
+				ClientID:     testClientID2,
+				ClientSecret: testClientSecret2,
+				SubjectToken: issued.AccessToken,
+				Audience:     tt.audience,
+				Scope:        tt.scope,
+			})
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantScope, exchanged.Scope)
+			assert.Equal(t, models.TokenTypeAccessToken, exchanged.IssuedTokenType)
+			assert.Empty(t, exchanged.IdentityToken)
+
+			introspection, err := srv.IntrospectToken(ctx, models.IntrospectionRequest{ClientID: testClientID2, ClientSecret: testClientSecret2, Token: exchanged.AccessToken})
+			assert.NoError(t, err)
+			assert.True(t, introspection.Active)
+			assert.Equal(t, "ocp", introspection.Subject)
+			assert.Equal(t, testClientID2, introspection.ClientID)
+			assert.Equal(t, tt.audience, introspection.Audience)
+			assert.Equal(t, &models.Actor{Subject: "atp", ClientID: testClientID2}, introspection.Actor)
+		})
+	}
+}
+
+func TestService_GenerateToken_ExchangeChain(t *testing.T) {
+	ctx := context.TODO()
+	srv := newTestService()
+	caller := srv.IAM[testClientID1]
+	caller.Audiences = []string{testClientID2}
+	srv.IAM[testClientID1] = caller
+	actor := srv.IAM[testClientID2]
+	actor.GrantTypes = []string{models.GrantTypeTokenExchange}
+	actor.TokenExchange = models.TokenExchange{Audiences: []string{testClientID2, "stock"}}
+	srv.IAM[testClientID2] = actor
+
+	issued, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, Audience: []string{testClientID2}, ExpiresIn: time.Minute})
+	assert.NoError(t, err)
+	first, err := srv.GenerateToken(ctx, models.TokenRequest{GrantType: models.GrantTypeTokenExchange, ClientID: testClientID2, ClientSecret: testClientSecret2, SubjectToken: issued.AccessToken, Audience: []string{testClientID2}})
+	assert.NoError(t, err)
+	// the exchanged token does not outlive the subject token
+	assert.LessOrEqual(t, first.ExpiresIn, int64(60))
+
+	// exchanging an exchanged token nests the actors
+	second, err := srv.GenerateToken(ctx, models.TokenRequest{GrantType: models.GrantTypeTokenExchange, ClientID: testClientID2, ClientSecret: testClientSecret2, SubjectToken: first.AccessToken, Audience: []string{"stock"}})
+	assert.NoError(t, err)
+	introspection, err := srv.IntrospectToken(ctx, models.IntrospectionRequest{ClientID: testClientID2, ClientSecret: testClientSecret2, Token: second.AccessToken})
+	assert.NoError(t, err)
+	assert.Equal(t, "ocp", introspection.Subject)
+	assert.Equal(t, &models.Actor{Subject: "atp", ClientID: testClientID2, Actor: &models.Actor{Subject: "atp", ClientID: testClientID2}}, introspection.Actor)
+
+	// clients not allowed the grant may not exchange tokens
+	_, err = srv.GenerateToken(ctx, models.TokenRequest{GrantType: models.GrantTypeTokenExchange, ClientID: testClientID1, ClientSecret: testClientSecret1, SubjectToken: issued.AccessToken, Audience: []string{testClientID2}})
+	assert.ErrorIs(t, err, ErrGrantTypeNotAllowed)
+}
+
+func TestService_GenerateToken_ExchangeExpired(t *testing.T) {
+	ctx := context.TODO()
+	srv := newTestService()
+	srv.validation.leeway = time.Minute
+	actor := srv.IAM[testClientID2]
+	actor.GrantTypes = []string{models.GrantTypeTokenExchange}
+	actor.TokenExchange = models.TokenExchange{Audiences: []string{"stock"}}
+	srv.IAM[testClientID2] = actor
+
+	// the subject token expired, but is still within the leeway
+	now := time.Now()
+	subject, err := srv.createToken(&Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Audience:  []string{testClientID2},
+			ExpiresAt: jwt.NewNumericDate(now.Add(-10 * time.Second)),
+			IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+			Issuer:    defaultIssuer,
+			Subject:   "ocp",
+		},
+		TokenUse: models.TokenUseAccess,
+		ClientID: testClientID1,
+	})
+	assert.NoError(t, err)
+
+	_, err = srv.GenerateToken(ctx, models.TokenRequest{GrantType: models.GrantTypeTokenExchange, ClientID: testClientID2, ClientSecret: testClientSecret2, SubjectToken: subject, Audience: []string{"stock"}})
+	assert.ErrorIs(t, err, ErrInvalidSubjectToken)
+}
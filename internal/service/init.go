@@ -15,12 +15,28 @@
 package service
 
 import (
+	"bytes"
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/ingka-group/iam-proxy/client/jwt"
+	"github.com/ingka-group/iam-proxy/client/paths"
 	"github.com/ingka-group/iam-proxy/internal/config"
+	"github.com/ingka-group/iam-proxy/internal/credentials"
+	"github.com/ingka-group/iam-proxy/internal/database"
+	"github.com/ingka-group/iam-proxy/internal/keys"
 	"github.com/ingka-group/iam-proxy/internal/models"
+	"github.com/ingka-group/iam-proxy/internal/refresh"
+	"github.com/ingka-group/iam-proxy/internal/replay"
+	"github.com/ingka-group/iam-proxy/internal/revocation"
 )
 
 // Config for iam-proxy-v1 Service
@@ -28,25 +44,362 @@ type Config struct {
 	*config.Config
 }
 
-// New creates and initializes iam-proxy-v1 Service
-func New(c Config) (Servicer, error) {
-	iam := new(models.IAM)
-	// load IAM configuration
-	iamUsers, err := jwt.Base64Decode(c.IAM.Users)
+// New creates and initializes iam-proxy-v1 Service. Its background work, rotating the signing keys and
+// reloading the client credentials, stops once the context is cancelled.
+func New(ctx context.Context, c Config) (_ Servicer, err error) {
+	svc := &Service{
+		expiration:            c.IAM.TokenTTL,
+		identityExpiration:    c.IAM.IdentityTokenTTL,
+		nonExpiringIdentity:   c.IAM.AllowNonExpiringIdentityTokens,
+		refreshExpiration:     c.IAM.RefreshTokenTTL,
+		refreshIdleExpiration: c.IAM.RefreshTokenIdleTTL,
+		issuer:                issuerURL(c.IAM.PublicURL),
+		assertionAudiences:    c.IAM.ClientAssertionAudiences,
+		tlsClientAuth:         len(c.TLS.ClientCAFile) > 0,
+		clientKeys:            newKeySetCache(),
+		validation: timeValidation{
+			leeway:            c.IAM.TokenLeeway,
+			requireExpiration: c.IAM.RequireExpiration,
+			requireIssuedAt:   c.IAM.RequireIssuedAt,
+			futureIssuedAt:    c.IAM.RejectFutureIssuedAt,
+		},
+	}
+	defer func() {
+		if err != nil {
+			svc.closeStores()
+		}
+	}()
+	svc.dpopNonces, err = newNonceSource(c.IAM.DPoPRequireNonce, c.IAM.DPoPNonceSecret)
 	if err != nil {
-		return nil, fmt.Errorf("could not decode iam users credentials: %w", err)
+		return nil, err
+	}
+	if c.IAM.TokenLeeway < 0 {
+		return nil, fmt.Errorf("token leeway must not be negative")
+	}
+	if c.IAM.MaxSecretVerifications < 0 {
+		return nil, fmt.Errorf("max secret verifications must not be negative")
+	}
+	svc.secretVerifications = newLimiter(cmp.Or(c.IAM.MaxSecretVerifications, defaultSecretVerifications), secretVerificationWait)
+	if svc.refreshExpiration <= 0 {
+		svc.refreshExpiration = refreshExpirationInterval
+	}
+	if svc.refreshIdleExpiration <= 0 {
+		svc.refreshIdleExpiration = refreshIdleExpirationInterval
+	}
+	if svc.nonExpiringIdentity && !svc.validation.requireExpiration {
+		c.Logger.Warn("identity tokens without an expiry are accepted")
+	}
+	if !strings.HasPrefix(svc.issuer, "https://") {
+		c.Logger.Warn("the server metadata is not served without an https public URL")
+	}
+
+	var file *credentials.File
+	switch {
+	case len(c.IAM.UsersDriver) > 0:
+		users, err := credentials.NewSQL(ctx, database.Config{
+			Driver: c.IAM.UsersDriver,
+			DSN:    c.IAM.UsersDSN,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to the client credentials database: %w", err)
+		}
+		svc.store = users
+		c.Logger.Infow("loading client credentials from database", "driver", c.IAM.UsersDriver)
+		// clients are looked up on demand, the initial ones are checked for plaintext and expired secrets
+		clients, err := svc.store.Clients(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not load the client credentials: %w", err)
+		}
+		credentials.Log(c.Logger, clients)
+	case len(c.IAM.UsersFile) > 0:
+		file, err = credentials.NewFile(credentials.FileConfig{
+			Path:     c.IAM.UsersFile,
+			Interval: c.IAM.UsersReloadInterval,
+			Logger:   c.Logger,
+		})
+		if err != nil {
+			return nil, err
+		}
+		svc.store = file
+	default:
+		svc.IAM, err = usersFromEnv(c.IAM.Users)
+		if err != nil {
+			return nil, err
+		}
+		credentials.Log(c.Logger, svc.IAM)
+	}
+
+	if len(c.IAM.RevocationDriver) > 0 {
+		revocations, err := revocation.NewSQL(ctx, database.Config{
+			Driver: c.IAM.RevocationDriver,
+			DSN:    c.IAM.RevocationDSN,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to the revocation database: %w", err)
+		}
+		svc.revocations = revocations
+		c.Logger.Infow("sharing revoked tokens in database", "driver", c.IAM.RevocationDriver)
+	} else {
+		svc.revocations = revocation.NewMemory()
+	}
+
+	if len(c.IAM.RefreshTokenDriver) > 0 {
+		refreshTokens, err := refresh.NewSQL(ctx, database.Config{
+			Driver: c.IAM.RefreshTokenDriver,
+			DSN:    c.IAM.RefreshTokenDSN,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to the refresh token database: %w", err)
+		}
+		svc.refreshTokens = refreshTokens
+		c.Logger.Infow("sharing refresh tokens in database", "driver", c.IAM.RefreshTokenDriver)
+	} else {
+		svc.refreshTokens = refresh.NewMemory()
+	}
+
+	if len(c.IAM.ReplayDriver) > 0 {
+		replays, err := replay.NewSQL(ctx, database.Config{
+			Driver: c.IAM.ReplayDriver,
+			DSN:    c.IAM.ReplayDSN,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to the replay database: %w", err)
+		}
+		svc.replays = replays
+		c.Logger.Infow("sharing used client assertions in database", "driver", c.IAM.ReplayDriver)
+	} else {
+		svc.replays = replay.NewMemory()
+	}
+
+	if len(c.IAM.KeyringDir) > 0 {
+		svc.rotator, err = keyRotator(ctx, c)
+		if err != nil {
+			return nil, fmt.Errorf("could not load signing keys: %w", err)
+		}
+	} else {
+		svc.ring, err = keyRing(c.IAM)
+		if err != nil {
+			return nil, fmt.Errorf("could not load signing keys: %w", err)
+		}
+	}
+
+	ring := svc.keyRing()
+	for _, k := range ring.Keys() {
+		c.Logger.Infow("loaded token key", "kid", k.ID, "alg", k.Method.Alg(), "active", k == ring.Active())
+	}
+
+	svc.identityKey, err = identityKey(c.IAM)
+	if err != nil {
+		return nil, fmt.Errorf("could not load identity signing key: %w", err)
+	}
+	if svc.identityKey != nil {
+		if _, ok := ring.Key(svc.identityKey.ID); ok {
+			return nil, fmt.Errorf("identity signing key %s also signs access tokens", svc.identityKey.ID)
+		}
+		c.Logger.Infow("loaded identity token key", "kid", svc.identityKey.ID, "alg", svc.identityKey.Method.Alg())
+	}
+	if lifetime := svc.rotatedTokenLifetime(); svc.rotator != nil && c.IAM.KeyRetention < lifetime {
+		return nil, fmt.Errorf("key retention %s must be at least the token lifetime %s", c.IAM.KeyRetention, lifetime)
+	}
+	if svc.rotator != nil {
+		svc.keyRetention = c.IAM.KeyRetention
+	}
+
+	if svc.rotator != nil {
+		go svc.rotator.Run(ctx)
+	}
+	if file != nil {
+		go file.Run(ctx)
+	}
+	return svc, nil
+}
+
+// closeStores closes the stores holding database connections.
+func (s *Service) closeStores() {
+	for _, store := range []any{s.store, s.revocations, s.refreshTokens, s.replays} {
+		if closer, ok := store.(io.Closer); ok {
+			_ = closer.Close()
+		}
 	}
-	err = json.Unmarshal(iamUsers, iam)
+}
+
+// usersFromEnv decodes the raw base64 encoded JSON client credentials.
+func usersFromEnv(users string) (models.IAM, error) {
+	iam := models.IAM{}
+	iamUsers, err := jwt.Base64Decode(users)
 	if err != nil {
+		return nil, fmt.Errorf("could not decode iam users credentials: %w", err)
+	}
+	if err := json.Unmarshal(iamUsers, &iam); err != nil {
 		return nil, fmt.Errorf("could not decode IAM information: %w", err)
 	}
+	if err := credentials.Validate(iam); err != nil {
+		return nil, fmt.Errorf("invalid IAM information: %w", err)
+	}
+	return iam, nil
+}
+
+// issuerURL returns the issuer of the tokens, the URL of the service under the public URL. Without a public URL
+// the tokens keep the issuer iam-proxy.
+func issuerURL(publicURL string) string {
+	if base := strings.TrimSuffix(publicURL, "/"); len(base) > 0 {
+		return base + paths.PathPrefix
+	}
+	return defaultIssuer
+}
+
+// rotatedTokenLifetime returns the longest default lifetime of the tokens signed by the key ring, which
+// the retention of replaced keys must cover.
+func (s *Service) rotatedTokenLifetime() time.Duration {
+	lifetime := s.tokenExpiration(models.Secret{}, 0)
+	if s.identityKey == nil {
+		lifetime = max(lifetime, s.identityTokenExpiration(models.Secret{}))
+	}
+	return lifetime
+}
+
+// keyRotator loads the automatically rotated keys, adding the configured keys to verify tokens
+// issued before rotation was enabled.
+func keyRotator(ctx context.Context, c Config) (*keys.Rotator, error) {
+	single, files, err := loadKeys(c.IAM)
+	if err != nil {
+		return nil, err
+	}
+	static := files
+	if !single.Empty() {
+		static = append(static, single)
+	}
+
+	return keys.NewRotator(ctx, keys.RotatorConfig{
+		Dir:       c.IAM.KeyringDir,
+		Algorithm: c.IAM.SigningAlgorithm,
+		Interval:  c.IAM.KeyRotationInterval,
+		Retention: c.IAM.KeyRetention,
+		Static:    static,
+		Logger:    c.Logger,
+	})
+}
+
+// keyRing loads the key files by key id along with the single signing key or shared secret.
+// Without key files the single key signs all tokens. Otherwise it only verifies tokens unless no
+// active key id is configured, which allows migrating to a key ring without invalidating tokens.
+func keyRing(c config.IAM) (*keys.Ring, error) {
+	single, files, err := loadKeys(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return keys.NewRing(single)
+	}
+
+	var (
+		active *keys.Key
+		others []*keys.Key
+	)
+	for _, key := range files {
+		if key.ID == c.ActiveKey {
+			active = key
+			continue
+		}
+		others = append(others, key)
+	}
+
+	switch {
+	case active != nil:
+	case len(c.ActiveKey) > 0:
+		return nil, fmt.Errorf("active key %s is not configured", c.ActiveKey)
+	case !single.Empty():
+		active = single
+	case len(others) == 1:
+		active, others = others[0], nil
+	default:
+		return nil, fmt.Errorf("the active key id must be configured")
+	}
+	if !single.Empty() && single != active {
+		others = append(others, single)
+	}
+	return keys.NewRing(active, others...)
+}
+
+// loadKeys loads the single signing key or shared secret and the key files ordered by key id.
+func loadKeys(c config.IAM) (*keys.Key, []*keys.Key, error) {
+	single, err := signingKey(c)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	for _, u := range *iam {
-		c.Logger.Infof("loaded user credentials for %s", u.AppName)
+	kids := make([]string, 0, len(c.KeyFiles))
+	for kid := range c.KeyFiles {
+		kids = append(kids, kid)
 	}
+	sort.Strings(kids)
 
-	return &Service{
-		IAM:    *iam,
-		secret: []byte(c.IAM.Secret),
-	}, nil
+	files := make([]*keys.Key, 0, len(kids))
+	for _, kid := range kids {
+		key, err := loadKeyFile(c.KeyFiles[kid], c.SigningAlgorithm)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not load key %s: %w", kid, err)
+		}
+		key.ID = kid
+		files = append(files, key)
+	}
+	return single, files, nil
+}
+
+// signingKey loads the configured private key, falling back to the shared secret.
+func signingKey(c config.IAM) (*keys.Key, error) {
+	pemData := []byte(c.SigningKey)
+	if len(c.SigningKeyFile) > 0 {
+		b, err := os.ReadFile(c.SigningKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", c.SigningKeyFile, err)
+		}
+		pemData = b
+	}
+
+	if len(pemData) == 0 {
+		return keys.NewSecret([]byte(c.Secret)), nil
+	}
+	return keys.ParsePEM(pemData, c.SigningAlgorithm)
+}
+
+// identityKey loads the private key signing identity tokens, nil when none is configured.
+func identityKey(c config.IAM) (*keys.Key, error) {
+	pemData := []byte(c.IdentitySigningKey)
+	if len(c.IdentitySigningKeyFile) > 0 {
+		b, err := os.ReadFile(c.IdentitySigningKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", c.IdentitySigningKeyFile, err)
+		}
+		pemData = b
+	}
+
+	if len(pemData) == 0 {
+		return nil, nil
+	}
+	key, err := keys.ParsePEM(pemData, "")
+	if err != nil {
+		return nil, err
+	}
+	if !key.CanSign() {
+		return nil, errors.New("the identity signing key must be a private key")
+	}
+	return key, nil
+}
+
+// loadKeyFile reads a PEM encoded key or a shared secret from a file.
+func loadKeyFile(file, alg string) (*keys.Key, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", file, err)
+	}
+	if keys.IsPEM(b) {
+		return keys.ParsePEM(b, alg)
+	}
+
+	secret := bytes.TrimRight(b, "\r\n")
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("%s is empty", file)
+	}
+	return keys.NewSecret(secret), nil
 }
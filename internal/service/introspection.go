@@ -0,0 +1,72 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+// IntrospectToken describes the access token to the authenticated client, see RFC 7662. Tokens that are not
+// valid access tokens of this service are inactive, only a failed client authentication is an error. When the
+// DPoP proof the token was presented with is given, DPoP-bound tokens are inactive unless it proves their key.
+func (s *Service) IntrospectToken(ctx context.Context, req models.IntrospectionRequest) (models.Introspection, error) {
+	if _, _, err := s.authenticate(ctx, req.ClientID, req.ClientSecret, req.ClientAssertion, req.ClientCertificate); err != nil {
+		return models.Introspection{}, fmt.Errorf("user not authorized to introspect tokens: %w", err)
+	}
+
+	claims, err := s.parseClaims(ctx, req.Token, models.TokenUseAccess, "")
+	if err != nil {
+		return models.Introspection{Active: false}, nil
+	}
+	if len(req.DPoP.Proof) > 0 {
+		err := s.verifyDPoPBinding(ctx, claims.Confirmation, req.Token, req.DPoP)
+		if errors.Is(err, ErrDPoPNonceRequired) {
+			return models.Introspection{}, err
+		}
+		if err != nil {
+			return models.Introspection{Active: false}, nil
+		}
+	}
+	return models.Introspection{
+		Active:       true,
+		ClientID:     claims.ClientID,
+		Subject:      claims.Subject,
+		Scope:        strings.Fields(claims.Scope),
+		Audience:     claims.Audience,
+		Issuer:       claims.Issuer,
+		ExpiresAt:    numericTime(claims.ExpiresAt),
+		IssuedAt:     numericTime(claims.IssuedAt),
+		NotBefore:    numericTime(claims.NotBefore),
+		JWTID:        claims.ID,
+		Actor:        claims.Actor,
+		Confirmation: claims.Confirmation,
+	}, nil
+}
+
+// numericTime returns the time of the claim, the zero time when it is missing.
+func numericTime(date *jwt.NumericDate) time.Time {
+	if date == nil {
+		return time.Time{}
+	}
+	return date.Time
+}
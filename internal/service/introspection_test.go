@@ -0,0 +1,92 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+func TestService_IntrospectToken(t *testing.T) {
+	srv := newTestService()
+	client := srv.IAM[testClientID1]
+	client.Audiences = []string{"billing"}
+	client.Scopes = []string{"read"}
+	srv.IAM[testClientID1] = client
+
+	issued, err := srv.GenerateToken(context.TODO(), models.TokenRequest{
+		ClientID:     testClientID1,
+		ClientSecret: testClientSecret1,
+		Audience:     []string{"billing"},
+		Scope:        []string{"read"},
+	})
+	assert.NoError(t, err)
+
+	type test struct {
+		req  models.IntrospectionRequest
+		want models.Introspection
+		err  error
+	}
+
+	tests := map[string]test{
+		"access_token": {
+			req: models.IntrospectionRequest{ClientID: testClientID2, ClientSecret: testClientSecret2, Token: issued.AccessToken},
+			want: models.Introspection{
+				Active:   true,
+				ClientID: testClientID1,
+				Subject:  "ocp",
+				Scope:    []string{"read"},
+				Audience: []string{"billing"},
+				Issuer:   defaultIssuer,
+			},
+		},
+		"identity_token": {
+			req: models.IntrospectionRequest{ClientID: testClientID2, ClientSecret: testClientSecret2, Token: issued.IdentityToken},
+		},
+		"invalid_token": {
+			req: models.IntrospectionRequest{ClientID: testClientID2, ClientSecret: testClientSecret2, Token: "token"},
+		},
+		"invalid_client": {
+			req: models.IntrospectionRequest{ClientID: testClientID2, ClientSecret: testClientSecret1, Token: issued.AccessToken},
+			err: ErrInvalidCredentials,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := srv.IntrospectToken(context.TODO(), tt.req)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			if !tt.want.Active {
+				assert.Equal(t, models.Introspection{}, got)
+				return
+			}
+			assert.NotEmpty(t, got.JWTID)
+			assert.WithinDuration(t, time.Now().Add(time.Hour), got.ExpiresAt, time.Minute)
+			assert.WithinDuration(t, time.Now(), got.IssuedAt, time.Minute)
+			assert.Equal(t, got.IssuedAt, got.NotBefore)
+			got.JWTID, got.ExpiresAt, got.IssuedAt, got.NotBefore = "", time.Time{}, time.Time{}, time.Time{}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
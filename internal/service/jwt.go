@@ -18,104 +18,528 @@
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 
+	"github.com/ingka-group/iam-proxy/client/jwk"
+	"github.com/ingka-group/iam-proxy/internal/credentials"
+	"github.com/ingka-group/iam-proxy/internal/keys"
 	"github.com/ingka-group/iam-proxy/internal/models"
+	"github.com/ingka-group/iam-proxy/internal/secret"
 )
 
 const (
-	issuer             = "iam-proxy"
+	defaultIssuer      = "iam-proxy"
 	invalidTokenError  = "token is invalid"
 	invalidIssuer      = "issuer is invalid"
+	invalidTokenUse    = "token use is invalid"
+	missingExpiration  = "token does not expire"
+	missingIssuedAt    = "token has no issue time"
+	revokedToken       = "token is revoked"
 	parseTokenError    = "could not parse token"
 	expirationInterval = 1 * time.Hour
+	// refreshExpirationInterval and refreshIdleExpirationInterval are the default refresh token lifetimes.
+	refreshExpirationInterval     = 30 * 24 * time.Hour
+	refreshIdleExpirationInterval = 24 * time.Hour
+	// defaultSecretVerifications bounds the client secrets verified at once unless configured, each waiting
+	// for its turn for up to secretVerificationWait.
+	defaultSecretVerifications = 16
+	secretVerificationWait     = time.Second
+	// accessTokenType is the typ header of access tokens, see RFC 9068.
+	accessTokenType = "at+jwt"
 )
 
+// Reasons a client secret is rejected.
+var (
+	ErrSecretMismatch    = errors.New("client secret does not match")
+	ErrSecretExpired     = errors.New("client secret expired")
+	ErrSecretNotYetValid = errors.New("client secret is not valid yet")
+	ErrClientDisabled    = errors.New("client is disabled")
+)
+
+// ErrInvalidCredentials marks a failed client authentication, wrapping the reason.
+var ErrInvalidCredentials = errors.New("invalid client credentials")
+
+// ErrBusy marks a client authentication refused as too many client secrets are being verified.
+var ErrBusy = errors.New("too many client secrets are being verified")
+
+// Reasons a token request of an authenticated client is refused.
+var (
+	ErrGrantTypeNotAllowed = errors.New("grant type is not allowed for the client")
+	ErrAudienceNotAllowed  = errors.New("audience is not allowed for the client")
+	ErrScopeNotAllowed     = errors.New("scope is not allowed for the client")
+	// ErrInvalidGrant marks refresh tokens that are invalid, expired, revoked or issued to another client.
+	ErrInvalidGrant         = errors.New("refresh token is invalid")
+	ErrUnsupportedGrantType = errors.New("grant type is not supported")
+	// ErrInvalidSubjectToken marks subject tokens of a token exchange that are invalid or that the client
+	// may not exchange.
+	ErrInvalidSubjectToken = errors.New("subject token is invalid")
+)
+
+// ErrTokenNotIssuedToClient marks a revocation or refresh of a token issued to another client.
+var ErrTokenNotIssuedToClient = errors.New("token was not issued to the client")
+
+// errRevocationUnknown marks tokens whose revocation could not be checked.
+var errRevocationUnknown = errors.New("could not check token revocation")
+
+// ErrInsufficientScope marks a valid access token lacking a required scope.
+var ErrInsufficientScope = errors.New("token lacks the required scope")
+
 // Claims defines the token claims.
 type Claims struct {
 	jwt.RegisteredClaims
+	// TokenUse tells access and identity tokens apart.
+	TokenUse models.TokenUse `json:"token_use,omitempty"`
+	// Scope is the space-delimited list of scopes granted to an access token.
+	Scope string `json:"scope,omitempty"`
+	// ClientID is the client a token was issued to, see RFC 9068.
+	ClientID string `json:"client_id,omitempty"`
+	// Actor is the chain of actors of an exchanged token, see RFC 8693.
+	Actor *models.Actor `json:"act,omitempty"`
+	// Confirmation is the key a sender-constrained access token is bound to, see RFC 8705.
+	Confirmation *models.Confirmation `json:"cnf,omitempty"`
 }
 
 // verifyUser checks the iam privileges for the given client id and secret.
-func (s *Service) verifyUser(clientID, clientSecret string) (string, error) {
+func (s *Service) verifyUser(ctx context.Context, clientID, clientSecret string) (models.Secret, error) {
 	if len(clientID) == 0 {
-		return "", fmt.Errorf("no client Id provided")
+		return models.Secret{}, fmt.Errorf("%w: no client Id provided", ErrInvalidCredentials)
 	}
 	if len(clientSecret) == 0 {
-		return "", fmt.Errorf("no client secret provided")
+		return models.Secret{}, fmt.Errorf("%w: no client secret provided", ErrInvalidCredentials)
+	}
+
+	client, err := s.credentialStore().Client(ctx, models.ClientID(clientID))
+	if err != nil && !errors.Is(err, credentials.ErrNotFound) {
+		return models.Secret{}, fmt.Errorf("could not look up client: %w", err)
+	}
+	release, busy := s.secretVerifications.acquire(ctx)
+	if busy != nil {
+		return models.Secret{}, busy
+	}
+	defer release()
+	if err != nil {
+		secret.VerifyDummy(clientSecret)
+		return models.Secret{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
 	}
 
-	clID := models.ClientID(clientID)
-	if _, ok := s.IAM[clID]; !ok {
-		return "", fmt.Errorf("client id does not exist")
+	// every secret is checked, so the time taken does not tell which one matched
+	now := time.Now()
+	matched := ErrSecretMismatch
+	for _, cs := range client.Secrets() {
+		valid, err := secret.Verify(cs.Secret, clientSecret)
+		if err != nil {
+			return models.Secret{}, fmt.Errorf("could not verify client secret: %w", err)
+		}
+		switch {
+		case !valid:
+		case cs.Expired(now):
+			if matched == ErrSecretMismatch {
+				matched = ErrSecretExpired
+			}
+		case cs.Pending(now):
+			if matched == ErrSecretMismatch {
+				matched = ErrSecretNotYetValid
+			}
+		default:
+			matched = nil
+		}
+	}
+	if matched != nil {
+		return models.Secret{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, matched)
+	}
+	if !client.UsesClientSecret() {
+		return models.Secret{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, ErrAuthMethodMismatch)
+	}
+	// told only to clients presenting a valid secret
+	if client.Disabled {
+		return models.Secret{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, ErrClientDisabled)
+	}
+	return client, nil
+}
+
+// limiter bounds the work done at once, each slot held by one unit of work. A zero limiter bounds nothing.
+type limiter struct {
+	slots chan struct{}
+	// wait is how long work waits for a slot before it is refused with ErrBusy.
+	wait time.Duration
+}
+
+func newLimiter(size int, wait time.Duration) limiter {
+	return limiter{slots: make(chan struct{}, size), wait: wait}
+}
+
+// acquire takes a slot, returning the function giving it back.
+func (l limiter) acquire(ctx context.Context) (func(), error) {
+	if l.slots == nil {
+		return func() {}, nil
 	}
-	secret := s.IAM[clID].ClientSecret
-	if secret != clientSecret {
-		return "", fmt.Errorf("client secret does not match")
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	case <-timer.C:
+		return nil, ErrBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	return s.IAM[clID].AppName, nil
 }
 
-// GenerateToken generates a secret token for the provided app.
-func (s *Service) GenerateToken(_ context.Context, clientID, clientSecret string) (string, string, int64, error) {
-	appName, err := s.verifyUser(clientID, clientSecret)
+// GenerateToken generates the access and identity tokens for the provided app.
+func (s *Service) GenerateToken(ctx context.Context, req models.TokenRequest) (models.Token, error) {
+	clientID, client, err := s.authenticate(ctx, req.ClientID, req.ClientSecret, req.ClientAssertion, req.ClientCertificate)
+	if err != nil {
+		return models.Token{}, fmt.Errorf("user not authorized to use iam service: %w", err)
+	}
+	req.ClientID = clientID
+	appName := client.AppName
+	cnf, err := s.confirmation(ctx, client, req)
 	if err != nil {
-		return "", "", 0, fmt.Errorf("user not authorized to use iam service: %w", err)
+		return models.Token{}, err
+	}
+	grantType := req.GrantType
+	if len(grantType) == 0 {
+		grantType = models.GrantTypeClientCredentials
+	}
+	if !client.AllowsGrantType(grantType) {
+		return models.Token{}, fmt.Errorf("%s may not use grant type %s: %w", appName, grantType, ErrGrantTypeNotAllowed)
+	}
+	var previous *models.RefreshToken
+	switch grantType {
+	case models.GrantTypeClientCredentials:
+	case models.GrantTypeTokenExchange:
+		return s.exchangeToken(ctx, client, req, cnf)
+	case models.GrantTypeRefreshToken:
+		used, err := s.refreshToken(ctx, req)
+		if err != nil {
+			return models.Token{}, fmt.Errorf("%s may not refresh tokens: %w", appName, err)
+		}
+		previous = &used
+		req.Audience, err = narrow(used.Audience, req.Audience, ErrAudienceNotAllowed)
+		if err != nil {
+			return models.Token{}, fmt.Errorf("%s may not widen the audience: %w", appName, err)
+		}
+		req.Scope, err = narrow(used.Scope, req.Scope, ErrScopeNotAllowed)
+		if err != nil {
+			return models.Token{}, fmt.Errorf("%s may not widen the scope: %w", appName, err)
+		}
+	default:
+		return models.Token{}, fmt.Errorf("grant type %s: %w", grantType, ErrUnsupportedGrantType)
+	}
+	for _, aud := range req.Audience {
+		if !slices.Contains(client.Audiences, aud) {
+			return models.Token{}, fmt.Errorf("%s may not request tokens for audience %s: %w", appName, aud, ErrAudienceNotAllowed)
+		}
+	}
+	for _, scope := range req.Scope {
+		if !slices.Contains(client.Scopes, scope) {
+			return models.Token{}, fmt.Errorf("%s may not request scope %s: %w", appName, scope, ErrScopeNotAllowed)
+		}
 	}
 
-	expiration := time.Now().Add(expirationInterval)
+	expiration := s.tokenExpiration(client, req.ExpiresIn)
+	now := time.Now()
+	accessTokenID := uuid.New().String()
 
-	accessToken, err := s.createToken(&jwt.RegisteredClaims{
-		ID:        uuid.New().String(),
-		ExpiresAt: jwt.NewNumericDate(expiration),
-		Issuer:    issuer,
+	accessToken, err := s.createToken(&Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        accessTokenID,
+			Audience:  req.Audience,
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    s.issuer,
+			Subject:   appName,
+		},
+		TokenUse:     models.TokenUseAccess,
+		Scope:        strings.Join(req.Scope, " "),
+		ClientID:     req.ClientID,
+		Confirmation: cnf,
 	})
 	if err != nil {
-		return "", "", 0, fmt.Errorf("could not generate access token for %s: %w", appName, err)
+		return models.Token{}, fmt.Errorf("could not generate access token for %s: %w", appName, err)
 	}
 
-	identityToken, err := s.createToken(&jwt.RegisteredClaims{
-		Issuer:  issuer,
-		Subject: appName,
+	identityToken, err := s.createToken(&Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.identityTokenExpiration(client))),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    s.issuer,
+			Subject:   appName,
+		},
+		TokenUse: models.TokenUseIdentity,
+		ClientID: req.ClientID,
 	})
 	if err != nil {
-		return "", "", 0, fmt.Errorf("could not generate identity token for %s: %w", appName, err)
+		return models.Token{}, fmt.Errorf("could not generate identity token for %s: %w", appName, err)
+	}
+
+	token := models.Token{
+		AccessToken:   accessToken,
+		IdentityToken: identityToken,
+		ExpiresIn:     int64(expiration.Seconds()),
+		Scope:         req.Scope,
+		DPoP:          dpopBound(cnf),
+	}
+	if client.AllowsGrantType(models.GrantTypeRefreshToken) {
+		token.RefreshToken, err = s.issueRefreshToken(ctx, req, previous, models.RefreshToken{
+			AccessTokenID:        accessTokenID,
+			AccessTokenExpiresAt: now.Add(expiration),
+			IssuedAt:             now,
+		})
+		if err != nil {
+			return models.Token{}, fmt.Errorf("could not generate refresh token for %s: %w", appName, err)
+		}
+	}
+	return token, nil
+}
+
+// confirmation returns the keys the access tokens of the request are bound to, nil for bearer tokens: the
+// certificate of the client, see RFC 8705, and the key of its DPoP proof, see RFC 9449.
+func (s *Service) confirmation(ctx context.Context, client models.Secret, req models.TokenRequest) (*models.Confirmation, error) {
+	thumbprint, err := certificateBinding(client, req)
+	if err != nil {
+		return nil, err
+	}
+	jkt, err := s.dpopBinding(ctx, client, req)
+	if err != nil {
+		return nil, fmt.Errorf("%s may not bind tokens: %w", client.AppName, err)
+	}
+	if len(thumbprint) == 0 && len(jkt) == 0 {
+		return nil, nil
 	}
+	return &models.Confirmation{X509Thumbprint: thumbprint, JWKThumbprint: jkt}, nil
+}
 
-	return accessToken, identityToken, int64(expirationInterval.Seconds()), nil
+// tokenExpiration returns the lifetime of the client's access tokens, the requested one when it is shorter.
+// It does not outlast the retention of rotated keys.
+func (s *Service) tokenExpiration(client models.Secret, requested time.Duration) time.Duration {
+	expiration := expirationInterval
+	if s.expiration > 0 {
+		expiration = s.expiration
+	}
+	if client.ExpiresIn > 0 {
+		expiration = time.Duration(client.ExpiresIn) * time.Second
+	}
+	if s.keyRetention > 0 {
+		expiration = min(expiration, s.keyRetention)
+	}
+	if requested > 0 && requested < expiration {
+		return requested
+	}
+	return expiration
 }
 
-func (s *Service) createToken(claims *jwt.RegisteredClaims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
-	tokenString, err := token.SignedString(s.secret)
+func (s *Service) createToken(claims *Claims) (string, error) {
+	key := s.keyRing().Active()
+	if claims.TokenUse == models.TokenUseIdentity && s.identityKey != nil {
+		key = s.identityKey
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	if claims.TokenUse == models.TokenUseAccess {
+		token.Header["typ"] = accessTokenType
+	}
+	tokenString, err := token.SignedString(key.SigningKey())
 	if err != nil {
 		return "", fmt.Errorf("could not generate token: %w", err)
 	}
 	return tokenString, nil
 }
 
-// ParseToken parses the token and confirms its validity.
-func (s *Service) ParseToken(tokenString string) (string, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// ParseToken parses the token and confirms its validity for the given use. A token must be intended for the
+// audience, when one is given, and carry all the given scopes.
+func (s *Service) ParseToken(ctx context.Context, tokenString string, use models.TokenUse, audience string, scopes ...string) (string, error) {
+	claims, err := s.parseClaims(ctx, tokenString, use, audience)
+	if err != nil {
+		return "", err
+	}
+	if err := requireScopes(claims, scopes); err != nil {
+		return "", err
+	}
+	return claims.Subject, nil
+}
+
+// ValidateToken checks that the token is a valid access token for the request like ParseToken, and that the
+// request presents the certificate or the DPoP proof of the key a bound token is bound to.
+func (s *Service) ValidateToken(ctx context.Context, req models.ValidationRequest) error {
+	claims, err := s.parseClaims(ctx, req.Token, models.TokenUseAccess, req.Audience)
+	if err != nil {
+		return err
+	}
+	if err := requireScopes(claims, req.Scope); err != nil {
+		return err
+	}
+	if err := verifyCertificateBinding(claims.Confirmation, req.ClientCertificate); err != nil {
+		return err
+	}
+	return s.verifyDPoPBinding(ctx, claims.Confirmation, req.Token, req.DPoP)
+}
+
+// requireScopes checks that the token was granted the scopes, ErrInsufficientScope otherwise.
+func requireScopes(claims *Claims, scopes []string) error {
+	granted := strings.Fields(claims.Scope)
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			return fmt.Errorf("%w: %s", ErrInsufficientScope, scope)
 		}
-		return s.secret, nil
-	})
+	}
+	return nil
+}
+
+// parseClaims parses the token like ParseToken, returning its claims.
+func (s *Service) parseClaims(ctx context.Context, tokenString string, use models.TokenUse, audience string) (*Claims, error) {
+	opts := s.validation.parserOptions()
+	if len(audience) > 0 {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		candidates := s.verificationKeys(token, use)
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("no key %q for signing method %v", kid, token.Header["alg"])
+		}
+		set := jwt.VerificationKeySet{}
+		for _, key := range candidates {
+			set.Keys = append(set.Keys, key.VerificationKey())
+		}
+		return set, nil
+	}, opts...)
 
 	if err != nil {
-		return "", fmt.Errorf("%s: %w", parseTokenError, err)
+		return nil, fmt.Errorf("%s: %w", parseTokenError, err)
 	}
 
-	if claims, ok := token.Claims.(*jwt.RegisteredClaims); ok && token.Valid {
-		if claims.Issuer != issuer {
-			return "", errors.New(invalidIssuer)
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		if claims.Issuer != s.issuer {
+			return nil, errors.New(invalidIssuer)
+		}
+		if tokenUse(token, claims) != use {
+			return nil, errors.New(invalidTokenUse)
+		}
+		if claims.ExpiresAt == nil && !(use == models.TokenUseIdentity && s.nonExpiringIdentity) {
+			return nil, errors.New(missingExpiration)
+		}
+		if claims.IssuedAt == nil && s.validation.requireIssuedAt {
+			return nil, errors.New(missingIssuedAt)
 		}
-		return claims.Subject, nil
+		// fails closed, a token cannot be told valid while the revocations are unknown
+		revoked, err := s.revocations.Revoked(ctx, claims.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errRevocationUnknown, err)
+		}
+		if revoked {
+			return nil, errors.New(revokedToken)
+		}
+		return claims, nil
 	}
 
-	return "", errors.New(invalidTokenError)
+	return nil, errors.New(invalidTokenError)
+}
+
+// parserOptions returns the options validating the time claims.
+func (v timeValidation) parserOptions() []jwt.ParserOption {
+	opts := []jwt.ParserOption{jwt.WithLeeway(v.leeway)}
+	if v.requireExpiration {
+		opts = append(opts, jwt.WithExpirationRequired())
+	}
+	if v.futureIssuedAt {
+		opts = append(opts, jwt.WithIssuedAt())
+	}
+	return opts
+}
+
+// identityTokenExpiration returns the lifetime of the client's identity tokens. Unless the identity key signs
+// them, it does not outlast the retention of rotated keys.
+func (s *Service) identityTokenExpiration(client models.Secret) time.Duration {
+	expiration := expirationInterval
+	if s.identityExpiration > 0 {
+		expiration = s.identityExpiration
+	}
+	if client.IdentityExpiresIn > 0 {
+		expiration = time.Duration(client.IdentityExpiresIn) * time.Second
+	}
+	if s.keyRetention > 0 && s.identityKey == nil {
+		expiration = min(expiration, s.keyRetention)
+	}
+	return expiration
+}
+
+// verificationKeys returns the keys that may have signed the token. Identity tokens are verified with the
+// identity key when one is configured, so access tokens can never be verified with it.
+func (s *Service) verificationKeys(token *jwt.Token, use models.TokenUse) []*keys.Key {
+	kid, _ := token.Header["kid"].(string)
+	claims, _ := token.Claims.(*Claims)
+
+	if use == models.TokenUseIdentity && s.identityKey != nil && claims != nil && claims.TokenUse == use {
+		if (len(kid) == 0 || kid == s.identityKey.ID) && s.identityKey.Accepts(token.Method) {
+			return []*keys.Key{s.identityKey}
+		}
+		return nil
+	}
+	return s.keyRing().VerificationKeys(kid, token.Method)
+}
+
+// tokenUse returns the use of the token, empty when it is ambiguous. Tokens issued before the use was
+// recorded are told apart by their expiry, as back then only access tokens expired.
+func tokenUse(token *jwt.Token, claims *Claims) models.TokenUse {
+	typ, _ := token.Header["typ"].(string)
+	if strings.EqualFold(typ, accessTokenType) {
+		if claims.TokenUse != models.TokenUseAccess {
+			return ""
+		}
+		return models.TokenUseAccess
+	}
+
+	switch claims.TokenUse {
+	case "":
+		if claims.ExpiresAt != nil {
+			return models.TokenUseAccess
+		}
+		return models.TokenUseIdentity
+	case models.TokenUseIdentity:
+		return models.TokenUseIdentity
+	}
+	// access tokens always carry their type header
+	return ""
+}
+
+// JWKS returns the public keys that verify the issued tokens. Shared secrets are never published.
+func (s *Service) JWKS(_ context.Context) (jwk.Set, error) {
+	set := jwk.Set{Keys: []jwk.Key{}}
+
+	verifying := s.keyRing().Keys()
+	if s.identityKey != nil {
+		verifying = append(verifying, s.identityKey)
+	}
+	for _, key := range verifying {
+		if key.Symmetric() {
+			continue
+		}
+		pub, err := key.JWK()
+		if err != nil {
+			return jwk.Set{}, fmt.Errorf("could not publish key %s: %w", key.ID, err)
+		}
+		set.Keys = append(set.Keys, pub)
+	}
+	return set, nil
+}
+
+// keyRing returns the current keys, an empty shared secret when none are set.
+func (s *Service) keyRing() *keys.Ring {
+	if s.rotator != nil {
+		return s.rotator.Ring()
+	}
+	if s.ring == nil {
+		ring, _ := keys.NewRing(keys.NewSecret(nil))
+		return ring
+	}
+	return s.ring
 }
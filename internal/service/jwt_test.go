@@ -16,6 +16,14 @@
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -24,7 +32,11 @@
 	"github.com/stretchr/testify/assert"
 
 	jwtmodule "github.com/ingka-group/iam-proxy/client/jwt"
+	"github.com/ingka-group/iam-proxy/internal/keys"
 	"github.com/ingka-group/iam-proxy/internal/models"
+	"github.com/ingka-group/iam-proxy/internal/refresh"
+	"github.com/ingka-group/iam-proxy/internal/replay"
+	"github.com/ingka-group/iam-proxy/internal/revocation"
 )
 
 const (
@@ -39,13 +51,15 @@ func TestService_GenerateToken(t *testing.T) {
 
 	ctx := context.TODO()
 
-	token, ocp, _, err := srv.GenerateToken(ctx, testClientID1, testClientSecret1)
+	issued, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	token, ocp := issued.AccessToken, issued.IdentityToken
 
 	assert.NoError(t, err)
 	assert.NotEmpty(t, token)
 	assertIdentity(t, "ocp", ocp)
 
-	otherToken, atp, _, err := srv.GenerateToken(ctx, testClientID2, testClientSecret2)
+	issued, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID2, ClientSecret: testClientSecret2})
+	otherToken, atp := issued.AccessToken, issued.IdentityToken
 	assert.NoError(t, err)
 	assert.NotEmpty(t, token)
 	assertIdentity(t, "atp", atp)
@@ -53,14 +67,139 @@ func TestService_GenerateToken(t *testing.T) {
 	assert.NotEqual(t, token, otherToken)
 }
 
+func TestService_GenerateToken_Secrets(t *testing.T) {
+	now := time.Now()
+	srv := newTestService()
+	srv.IAM[testClientID1] = models.Secret{
+		AppName:        "ocp",
+		ClientSecret:   "expired",
+		ExpirationDate: now.Add(-time.Hour),
+		ClientSecrets: []models.ClientSecret{
+			{Secret: "current", NotBefore: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)},
+			{Secret: "next", NotBefore: now.Add(time.Hour)},
+			{Secret: "lasting"},
+		},
+	}
+
+	type test struct {
+		secret string
+		err    error
+	}
+
+	tests := map[string]test{
+		"current":       {secret: "current"},
+		"lasting":       {secret: "lasting"},
+		"expired":       {secret: "expired", err: ErrSecretExpired},
+		"not yet valid": {secret: "next", err: ErrSecretNotYetValid},
+		"mismatch":      {secret: "other", err: ErrSecretMismatch},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := srv.GenerateToken(context.TODO(), models.TokenRequest{ClientID: testClientID1, ClientSecret: tt.secret})
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestService_GenerateToken_Busy(t *testing.T) {
+	ctx := context.TODO()
+	srv := newTestService()
+	srv.secretVerifications = newLimiter(1, time.Millisecond)
+
+	release, err := srv.secretVerifications.acquire(ctx)
+	assert.NoError(t, err)
+	_, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	assert.ErrorIs(t, err, ErrBusy)
+	_, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: "unknown", ClientSecret: testClientSecret1})
+	assert.ErrorIs(t, err, ErrBusy)
+
+	release()
+	_, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	assert.NoError(t, err)
+}
+
+func TestService_GenerateToken_ClientPolicy(t *testing.T) {
+	type test struct {
+		client models.Secret
+		req    models.TokenRequest
+		err    error
+	}
+
+	tests := map[string]test{
+		"enabled": {
+			client: models.Secret{AppName: "ocp", ClientSecret: testClientSecret1},
+			req:    models.TokenRequest{GrantType: models.GrantTypeClientCredentials},
+		},
+		"disabled": {
+			client: models.Secret{AppName: "ocp", ClientSecret: testClientSecret1, Disabled: true},
+			err:    ErrClientDisabled,
+		},
+		"disabled with wrong secret": {
+			client: models.Secret{AppName: "ocp", ClientSecret: "other", Disabled: true},
+			err:    ErrSecretMismatch,
+		},
+		"grant type allowed": {
+			client: models.Secret{AppName: "ocp", ClientSecret: testClientSecret1, GrantTypes: []string{"refresh_token", models.GrantTypeClientCredentials}},
+		},
+		"grant type not allowed": {
+			client: models.Secret{AppName: "ocp", ClientSecret: testClientSecret1, GrantTypes: []string{"refresh_token"}},
+			err:    ErrGrantTypeNotAllowed,
+		},
+		"grant type not allowed by default": {
+			client: models.Secret{AppName: "ocp", ClientSecret: testClientSecret1},
+			req:    models.TokenRequest{GrantType: "refresh_token"},
+			err:    ErrGrantTypeNotAllowed,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestService()
+			srv.IAM[testClientID1] = tt.client
+			tt.req.ClientID = testClientID1
+			tt.req.ClientSecret = testClientSecret1
+			_, err := srv.GenerateToken(context.TODO(), tt.req)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestService_GenerateToken_IdentityLifetime(t *testing.T) {
+	srv := newTestService()
+	srv.identityExpiration = time.Hour
+	srv.IAM[testClientID1] = models.Secret{AppName: "ocp", ClientSecret: testClientSecret1, IdentityExpiresIn: 300}
+
+	issued, err := srv.GenerateToken(context.TODO(), models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	identity := issued.IdentityToken
+	assert.NoError(t, err)
+	claims := unverifiedClaims(t, identity)
+	assert.Equal(t, 5*time.Minute, claims.ExpiresAt.Sub(claims.IssuedAt.Time))
+
+	issued, err = srv.GenerateToken(context.TODO(), models.TokenRequest{ClientID: testClientID2, ClientSecret: testClientSecret2})
+	identity = issued.IdentityToken
+	assert.NoError(t, err)
+	claims = unverifiedClaims(t, identity)
+	assert.Equal(t, time.Hour, claims.ExpiresAt.Sub(claims.IssuedAt.Time))
+}
+
 func TestService_ParseToken(t *testing.T) {
 
 	srv := newTestService()
 
-	token, _, _, err := srv.GenerateToken(context.TODO(), testClientID1, testClientSecret1)
+	issued, err := srv.GenerateToken(context.TODO(), models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	token := issued.AccessToken
 	assert.NoError(t, err)
 
-	_, err = srv.ParseToken(token)
+	_, err = srv.ParseToken(context.TODO(), token, models.TokenUseAccess, "")
 	assert.NoError(t, err)
 }
 
@@ -69,10 +208,11 @@ func TestService_ParseToken_MixedInstance(t *testing.T) {
 	genService := newTestService()
 	parseService := newTestService()
 
-	token, _, _, err := genService.GenerateToken(context.TODO(), testClientID1, testClientSecret1)
+	issued, err := genService.GenerateToken(context.TODO(), models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	token := issued.AccessToken
 	assert.NoError(t, err)
 
-	_, err = parseService.ParseToken(token)
+	_, err = parseService.ParseToken(context.TODO(), token, models.TokenUseAccess, "")
 	assert.NoError(t, err)
 }
 
@@ -80,7 +220,7 @@ func TestService_ParseToken_ParseError(t *testing.T) {
 
 	srv := newTestService()
 
-	_, err := srv.ParseToken("")
+	_, err := srv.ParseToken(context.TODO(), "", models.TokenUseAccess, "")
 	assert.Error(t, err)
 	assert.True(t, strings.HasPrefix(err.Error(), parseTokenError))
 }
@@ -90,13 +230,13 @@ func TestService_ParseToken_Expired(t *testing.T) {
 
 	claims := &jwt.RegisteredClaims{
 		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-1 * time.Second)),
-		Issuer:    issuer,
+		Issuer:    defaultIssuer,
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(make([]byte, 0))
 	assert.NoError(t, err)
 
-	_, err = srv.ParseToken(tokenString)
+	_, err = srv.ParseToken(context.TODO(), tokenString, models.TokenUseAccess, "")
 	assert.Error(t, err)
 	assert.True(t, strings.Contains(err.Error(), "token is expired"))
 	assert.True(t, strings.Contains(err.Error(), parseTokenError))
@@ -113,14 +253,504 @@ func TestService_ParseToken_IssuerError(t *testing.T) {
 	tokenString, err := token.SignedString(make([]byte, 0))
 	assert.NoError(t, err)
 
-	_, err = srv.ParseToken(tokenString)
+	_, err = srv.ParseToken(context.TODO(), tokenString, models.TokenUseAccess, "")
 	assert.Error(t, err)
 	assert.True(t, strings.Contains(err.Error(), invalidIssuer))
 }
 
+func TestService_ParseToken_Asymmetric(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	type test struct {
+		key interface{}
+		alg string
+	}
+
+	tests := map[string]test{
+		"rs256": {key: rsaKey, alg: "RS256"},
+		"ps256": {key: rsaKey, alg: "PS256"},
+		"es384": {key: ecKey, alg: "ES384"},
+		"eddsa": {key: edKey, alg: "EdDSA"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			key, err := keys.ParsePEM(privateKeyPEM(t, tt.key), tt.alg)
+			assert.NoError(t, err)
+
+			srv := newTestService()
+			srv.ring, err = keys.NewRing(key)
+			assert.NoError(t, err)
+
+			issued, err := srv.GenerateToken(context.TODO(), models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+			token, identity := issued.AccessToken, issued.IdentityToken
+			assert.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.alg, parsed.Method.Alg())
+			assert.Equal(t, key.ID, parsed.Header["kid"])
+
+			_, err = srv.ParseToken(context.TODO(), token, models.TokenUseAccess, "")
+			assert.NoError(t, err)
+			sub, err := srv.ParseToken(context.TODO(), identity, models.TokenUseIdentity, "")
+			assert.NoError(t, err)
+			assert.Equal(t, "ocp", sub)
+
+			// tokens signed with the shared secret are not accepted anymore
+			hmacSrv := newTestService()
+			_, err = hmacSrv.ParseToken(context.TODO(), token, models.TokenUseAccess, "")
+			assert.Error(t, err)
+			issued, err = hmacSrv.GenerateToken(context.TODO(), models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+			hmacToken := issued.AccessToken
+			assert.NoError(t, err)
+			_, err = srv.ParseToken(context.TODO(), hmacToken, models.TokenUseAccess, "")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestService_ParseToken_Rotation(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	newKey, err := keys.ParsePEM(privateKeyPEM(t, ecKey), "")
+	assert.NoError(t, err)
+	newKey.ID = "new"
+	oldKey := keys.NewSecret([]byte("old"))
+	oldKey.ID = "old"
+
+	ctx := context.TODO()
+	srv := newTestService()
+
+	// tokens of the old key
+	srv.ring, err = keys.NewRing(oldKey)
+	assert.NoError(t, err)
+	issued, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	oldToken := issued.AccessToken
+	assert.NoError(t, err)
+	assertKeyID(t, "old", oldToken)
+
+	// the new key is added, verifying only
+	srv.ring, err = keys.NewRing(oldKey, newKey)
+	assert.NoError(t, err)
+	issued, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	token := issued.AccessToken
+	assert.NoError(t, err)
+	assertKeyID(t, "old", token)
+
+	// the new key is promoted
+	srv.ring, err = keys.NewRing(newKey, oldKey)
+	assert.NoError(t, err)
+	issued, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	newToken := issued.AccessToken
+	assert.NoError(t, err)
+	assertKeyID(t, "new", newToken)
+
+	_, err = srv.ParseToken(ctx, oldToken, models.TokenUseAccess, "")
+	assert.NoError(t, err)
+	_, err = srv.ParseToken(ctx, newToken, models.TokenUseAccess, "")
+	assert.NoError(t, err)
+
+	// the old key is retired
+	srv.ring, err = keys.NewRing(newKey)
+	assert.NoError(t, err)
+	_, err = srv.ParseToken(ctx, oldToken, models.TokenUseAccess, "")
+	assert.Error(t, err)
+	_, err = srv.ParseToken(ctx, newToken, models.TokenUseAccess, "")
+	assert.NoError(t, err)
+
+	// a token of a key that was never in the ring
+	other := keys.NewSecret([]byte("other"))
+	other.ID = "new"
+	srv.ring, err = keys.NewRing(other)
+	assert.NoError(t, err)
+	issued, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	forged := issued.AccessToken
+	assert.NoError(t, err)
+	srv.ring, err = keys.NewRing(newKey)
+	assert.NoError(t, err)
+	_, err = srv.ParseToken(ctx, forged, models.TokenUseAccess, "")
+	assert.Error(t, err)
+}
+
+func TestService_ParseToken_WithoutKeyID(t *testing.T) {
+	srv := newTestService()
+	secret := keys.NewSecret([]byte("legacy"))
+	var err error
+	srv.ring, err = keys.NewRing(keys.NewSecret([]byte("current")), secret)
+	assert.NoError(t, err)
+
+	// tokens issued before key ids were introduced are checked against every key
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, &jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+		Issuer:    defaultIssuer,
+	})
+	tokenString, err := token.SignedString([]byte("legacy"))
+	assert.NoError(t, err)
+
+	_, err = srv.ParseToken(context.TODO(), tokenString, models.TokenUseAccess, "")
+	assert.NoError(t, err)
+}
+
+func TestService_ParseToken_TokenUse(t *testing.T) {
+	srv := newTestService()
+
+	issued, err := srv.GenerateToken(context.TODO(), models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	access, identity := issued.AccessToken, issued.IdentityToken
+	assert.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(access, &Claims{})
+	assert.NoError(t, err)
+	assert.Equal(t, accessTokenType, parsed.Header["typ"])
+	assert.Equal(t, models.TokenUseAccess, parsed.Claims.(*Claims).TokenUse)
+
+	sign := func(header map[string]interface{}, claims *Claims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+		for k, v := range header {
+			token.Header[k] = v
+		}
+		tokenString, err := token.SignedString(make([]byte, 0))
+		assert.NoError(t, err)
+		return tokenString
+	}
+	expiring := jwt.RegisteredClaims{Issuer: defaultIssuer, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+	lasting := jwt.RegisteredClaims{Issuer: defaultIssuer, Subject: "ocp"}
+
+	type test struct {
+		token string
+		use   models.TokenUse
+		err   bool
+	}
+
+	tests := map[string]test{
+		"access token":              {token: access, use: models.TokenUseAccess},
+		"access token as identity":  {token: access, use: models.TokenUseIdentity, err: true},
+		"identity token":            {token: identity, use: models.TokenUseIdentity},
+		"identity token as access":  {token: identity, use: models.TokenUseAccess, err: true},
+		"legacy access token":       {token: sign(nil, &Claims{RegisteredClaims: expiring}), use: models.TokenUseAccess},
+		"legacy access as identity": {token: sign(nil, &Claims{RegisteredClaims: expiring}), use: models.TokenUseIdentity, err: true},
+		"legacy identity token":     {token: sign(nil, &Claims{RegisteredClaims: lasting}), use: models.TokenUseIdentity, err: true},
+		"legacy identity as access": {token: sign(nil, &Claims{RegisteredClaims: lasting}), use: models.TokenUseAccess, err: true},
+		"access use without type":   {token: sign(nil, &Claims{RegisteredClaims: expiring, TokenUse: models.TokenUseAccess}), use: models.TokenUseAccess, err: true},
+		"access type of identity":   {token: sign(map[string]interface{}{"typ": accessTokenType}, &Claims{RegisteredClaims: lasting, TokenUse: models.TokenUseIdentity}), use: models.TokenUseAccess, err: true},
+		"access type without use":   {token: sign(map[string]interface{}{"typ": accessTokenType}, &Claims{RegisteredClaims: expiring}), use: models.TokenUseAccess, err: true},
+		"unknown use":               {token: sign(nil, &Claims{RegisteredClaims: lasting, TokenUse: "refresh"}), use: models.TokenUseIdentity, err: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := srv.ParseToken(context.TODO(), tt.token, tt.use, "")
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestService_ParseToken_IdentityExpiration(t *testing.T) {
+	srv := newTestService()
+	srv.identityExpiration = 5 * time.Minute
+
+	issued, err := srv.GenerateToken(context.TODO(), models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	identity := issued.IdentityToken
+	assert.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(identity, &Claims{})
+	assert.NoError(t, err)
+	claims := parsed.Claims.(*Claims)
+	assert.NotEmpty(t, claims.ID)
+	assert.NotNil(t, claims.IssuedAt)
+	assert.NotNil(t, claims.NotBefore)
+	assert.Equal(t, 5*time.Minute, claims.ExpiresAt.Sub(claims.IssuedAt.Time))
+
+	sign := func(claims *Claims) string {
+		tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString(make([]byte, 0))
+		assert.NoError(t, err)
+		return tokenString
+	}
+	expired := sign(&Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    defaultIssuer,
+			Subject:   "ocp",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-1 * time.Second)),
+		},
+		TokenUse: models.TokenUseIdentity,
+	})
+	lasting := sign(&Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Issuer: defaultIssuer, Subject: "ocp"},
+		TokenUse:         models.TokenUseIdentity,
+	})
+	legacy := sign(&Claims{RegisteredClaims: jwt.RegisteredClaims{Issuer: defaultIssuer, Subject: "ocp"}})
+
+	_, err = srv.ParseToken(context.TODO(), expired, models.TokenUseIdentity, "")
+	assert.Error(t, err)
+	_, err = srv.ParseToken(context.TODO(), lasting, models.TokenUseIdentity, "")
+	assert.EqualError(t, err, missingExpiration)
+	_, err = srv.ParseToken(context.TODO(), legacy, models.TokenUseIdentity, "")
+	assert.EqualError(t, err, missingExpiration)
+
+	// identity tokens without an expiry are accepted during the migration
+	srv.nonExpiringIdentity = true
+	sub, err := srv.ParseToken(context.TODO(), lasting, models.TokenUseIdentity, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "ocp", sub)
+	_, err = srv.ParseToken(context.TODO(), legacy, models.TokenUseIdentity, "")
+	assert.NoError(t, err)
+	_, err = srv.ParseToken(context.TODO(), expired, models.TokenUseIdentity, "")
+	assert.Error(t, err)
+}
+
+func TestService_ParseToken_Audience(t *testing.T) {
+	srv := newTestService()
+	client := srv.IAM[testClientID1]
+	client.Audiences = []string{"billing", "orders"}
+	srv.IAM[testClientID1] = client
+
+	ctx := context.TODO()
+	issued, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, Audience: []string{"billing"}})
+	token := issued.AccessToken
+	assert.NoError(t, err)
+	assert.Equal(t, jwt.ClaimStrings{"billing"}, unverifiedClaims(t, token).Audience)
+
+	_, err = srv.ParseToken(ctx, token, models.TokenUseAccess, "billing")
+	assert.NoError(t, err)
+	_, err = srv.ParseToken(ctx, token, models.TokenUseAccess, "")
+	assert.NoError(t, err)
+	_, err = srv.ParseToken(ctx, token, models.TokenUseAccess, "orders")
+	assert.Error(t, err)
+
+	// tokens without an audience are rejected when one is expected
+	issued, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	unrestricted := issued.AccessToken
+	assert.NoError(t, err)
+	_, err = srv.ParseToken(ctx, unrestricted, models.TokenUseAccess, "billing")
+	assert.Error(t, err)
+
+	// audiences outside of the allowlist cannot be requested
+	_, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, Audience: []string{"billing", "payroll"}})
+	assert.Error(t, err)
+	_, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID2, ClientSecret: testClientSecret2, Audience: []string{"billing"}})
+	assert.Error(t, err)
+}
+
+func TestService_ParseToken_Scope(t *testing.T) {
+	srv := newTestService()
+	client := srv.IAM[testClientID1]
+	client.Scopes = []string{"read", "write"}
+	srv.IAM[testClientID1] = client
+
+	ctx := context.TODO()
+	issued, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, Scope: []string{"read"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"read"}, issued.Scope)
+	assert.Equal(t, "read", unverifiedClaims(t, issued.AccessToken).Scope)
+
+	_, err = srv.ParseToken(ctx, issued.AccessToken, models.TokenUseAccess, "")
+	assert.NoError(t, err)
+	_, err = srv.ParseToken(ctx, issued.AccessToken, models.TokenUseAccess, "", "read")
+	assert.NoError(t, err)
+	_, err = srv.ParseToken(ctx, issued.AccessToken, models.TokenUseAccess, "", "read", "write")
+	assert.ErrorIs(t, err, ErrInsufficientScope)
+
+	// tokens requested without a scope carry none
+	issued, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	assert.NoError(t, err)
+	assert.Empty(t, issued.Scope)
+	_, err = srv.ParseToken(ctx, issued.AccessToken, models.TokenUseAccess, "", "read")
+	assert.ErrorIs(t, err, ErrInsufficientScope)
+
+	// scopes outside of the allowlist cannot be requested
+	_, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, Scope: []string{"read", "admin"}})
+	assert.ErrorIs(t, err, ErrScopeNotAllowed)
+}
+
+func TestService_ParseToken_TimeValidation(t *testing.T) {
+	now := time.Now()
+	sign := func(claims jwt.RegisteredClaims) string {
+		claims.Issuer = defaultIssuer
+		token := jwt.NewWithClaims(jwt.SigningMethodHS512, &Claims{RegisteredClaims: claims, TokenUse: models.TokenUseAccess})
+		token.Header["typ"] = accessTokenType
+		tokenString, err := token.SignedString(make([]byte, 0))
+		assert.NoError(t, err)
+		return tokenString
+	}
+	expiry := jwt.NewNumericDate(now.Add(time.Hour))
+
+	type test struct {
+		token      string
+		validation timeValidation
+		err        bool
+	}
+
+	tests := map[string]test{
+		"just expired": {
+			token: sign(jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(-5 * time.Second))}),
+			err:   true,
+		},
+		"just expired within leeway": {
+			token:      sign(jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(-5 * time.Second))}),
+			validation: timeValidation{leeway: 10 * time.Second},
+		},
+		"not yet valid": {
+			token: sign(jwt.RegisteredClaims{ExpiresAt: expiry, NotBefore: jwt.NewNumericDate(now.Add(5 * time.Second))}),
+			err:   true,
+		},
+		"not yet valid within leeway": {
+			token:      sign(jwt.RegisteredClaims{ExpiresAt: expiry, NotBefore: jwt.NewNumericDate(now.Add(5 * time.Second))}),
+			validation: timeValidation{leeway: 10 * time.Second},
+		},
+		"issued in the future": {
+			token: sign(jwt.RegisteredClaims{ExpiresAt: expiry, IssuedAt: jwt.NewNumericDate(now.Add(time.Minute))}),
+		},
+		"issued in the future rejected": {
+			token:      sign(jwt.RegisteredClaims{ExpiresAt: expiry, IssuedAt: jwt.NewNumericDate(now.Add(time.Minute))}),
+			validation: timeValidation{leeway: 10 * time.Second, futureIssuedAt: true},
+			err:        true,
+		},
+		"issued in the future within leeway": {
+			token:      sign(jwt.RegisteredClaims{ExpiresAt: expiry, IssuedAt: jwt.NewNumericDate(now.Add(5 * time.Second))}),
+			validation: timeValidation{leeway: 10 * time.Second, futureIssuedAt: true},
+		},
+		"without issue time": {
+			token: sign(jwt.RegisteredClaims{ExpiresAt: expiry}),
+		},
+		"without issue time required": {
+			token:      sign(jwt.RegisteredClaims{ExpiresAt: expiry}),
+			validation: timeValidation{requireIssuedAt: true},
+			err:        true,
+		},
+		"with issue time required": {
+			token:      sign(jwt.RegisteredClaims{ExpiresAt: expiry, IssuedAt: jwt.NewNumericDate(now)}),
+			validation: timeValidation{requireIssuedAt: true, requireExpiration: true},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestService()
+			srv.validation = tt.validation
+			_, err := srv.ParseToken(context.TODO(), tt.token, models.TokenUseAccess, "")
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	// legacy identity tokens are rejected when an expiry is required
+	srv := newTestService()
+	srv.nonExpiringIdentity = true
+	srv.validation.requireExpiration = true
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS512, &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Issuer: defaultIssuer, Subject: "ocp"},
+	}).SignedString(make([]byte, 0))
+	assert.NoError(t, err)
+	_, err = srv.ParseToken(context.TODO(), legacy, models.TokenUseIdentity, "")
+	assert.Error(t, err)
+}
+
+func TestService_ParseToken_IdentityKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	identityKey, err := keys.ParsePEM(privateKeyPEM(t, ecKey), "")
+	assert.NoError(t, err)
+
+	srv := newTestService()
+	issued, err := srv.GenerateToken(context.TODO(), models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	shared, sharedIdentity := issued.AccessToken, issued.IdentityToken
+	assert.NoError(t, err)
+
+	srv.identityKey = identityKey
+	issued, err = srv.GenerateToken(context.TODO(), models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	access, identity := issued.AccessToken, issued.IdentityToken
+	assert.NoError(t, err)
+	assertKeyID(t, identityKey.ID, identity)
+
+	sub, err := srv.ParseToken(context.TODO(), identity, models.TokenUseIdentity, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "ocp", sub)
+	_, err = srv.ParseToken(context.TODO(), access, models.TokenUseAccess, "")
+	assert.NoError(t, err)
+	_, err = srv.ParseToken(context.TODO(), shared, models.TokenUseAccess, "")
+	assert.NoError(t, err)
+
+	// identity tokens signed with the access token keys are rejected
+	_, err = srv.ParseToken(context.TODO(), sharedIdentity, models.TokenUseIdentity, "")
+	assert.Error(t, err)
+
+	// an access token signed with the identity key is rejected
+	token := jwt.NewWithClaims(identityKey.Method, &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Issuer: defaultIssuer, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		TokenUse:         models.TokenUseAccess,
+	})
+	token.Header["kid"] = identityKey.ID
+	token.Header["typ"] = accessTokenType
+	forged, err := token.SignedString(identityKey.SigningKey())
+	assert.NoError(t, err)
+	_, err = srv.ParseToken(context.TODO(), forged, models.TokenUseAccess, "")
+	assert.Error(t, err)
+
+	set, err := srv.JWKS(context.TODO())
+	assert.NoError(t, err)
+	_, ok := set.Lookup(identityKey.ID)
+	assert.True(t, ok)
+}
+
+func TestService_JWKS(t *testing.T) {
+	srv := newTestService()
+
+	set, err := srv.JWKS(context.TODO())
+	assert.NoError(t, err)
+	assert.Empty(t, set.Keys)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	key, err := keys.ParsePEM(privateKeyPEM(t, ecKey), "")
+	assert.NoError(t, err)
+	srv.ring, err = keys.NewRing(key, keys.NewSecret([]byte("secret")))
+	assert.NoError(t, err)
+
+	set, err = srv.JWKS(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, set.Keys, 1)
+
+	pub, ok := set.Lookup(key.ID)
+	assert.True(t, ok)
+	assert.Equal(t, "ES256", pub.Algorithm)
+	assert.Equal(t, "sig", pub.Use)
+
+	// a verifier holding only the published key can check the tokens
+	issued, err := srv.GenerateToken(context.TODO(), models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	token := issued.AccessToken
+	assert.NoError(t, err)
+	_, err = jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		k, ok := set.Lookup(token.Header["kid"].(string))
+		if !ok {
+			return nil, fmt.Errorf("unknown key")
+		}
+		return k.PublicKey()
+	})
+	assert.NoError(t, err)
+}
+
 func newTestService() Service {
 	return Service{
-		Config: Config{},
+		Config:                Config{},
+		issuer:                defaultIssuer,
+		revocations:           revocation.NewMemory(),
+		refreshTokens:         refresh.NewMemory(),
+		refreshExpiration:     refreshExpirationInterval,
+		refreshIdleExpiration: refreshIdleExpirationInterval,
+		replays:               replay.NewMemory(),
+		clientKeys:            newKeySetCache(),
 		IAM: map[models.ClientID]models.Secret{
 			testClientID1: {
 				AppName:      "ocp",
@@ -134,6 +764,24 @@ func newTestService() Service {
 	}
 }
 
+func privateKeyPEM(t *testing.T, key interface{}) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func unverifiedClaims(t *testing.T, token string) *Claims {
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	assert.NoError(t, err)
+	return parsed.Claims.(*Claims)
+}
+
+func assertKeyID(t *testing.T, exp, token string) {
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+	assert.NoError(t, err)
+	assert.Equal(t, exp, parsed.Header["kid"])
+}
+
 func assertIdentity(t *testing.T, exp, actual string) {
 	claims, err := jwtmodule.DecodeToken(actual)
 	assert.NoError(t, err)
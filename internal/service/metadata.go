@@ -0,0 +1,62 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/ingka-group/iam-proxy/internal/keys"
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+// ErrNoIssuerURL marks the metadata of a service whose issuer is not an https URL, which RFC 8414 section 2 requires.
+// The issuer is one once the public URL is configured.
+var ErrNoIssuerURL = errors.New("issuer is not an https URL")
+
+// Metadata returns the capabilities of the service published in the authorization server metadata, see RFC 8414.
+// Client certificates are only advertised when the server accepts them.
+func (s *Service) Metadata(_ context.Context) (models.Metadata, error) {
+	if !strings.HasPrefix(s.issuer, "https://") {
+		return models.Metadata{}, ErrNoIssuerURL
+	}
+	authMethods := []string{models.AuthMethodClientSecret, models.AuthMethodClientSecretPost, models.AuthMethodPrivateKeyJWT}
+	if s.tlsClientAuth {
+		authMethods = append(authMethods, models.AuthMethodTLSClientAuth)
+	}
+
+	return models.Metadata{
+		Issuer:                       s.issuer,
+		GrantTypes:                   []string{models.GrantTypeClientCredentials, models.GrantTypeRefreshToken, models.GrantTypeTokenExchange},
+		AuthMethods:                  authMethods,
+		AssertionSigningAlgs:         slices.Clone(assertionMethods),
+		DPoPSigningAlgs:              slices.Clone(assertionMethods),
+		TokenSigningAlgs:             signingAlgs(s.keyRing().Keys()),
+		CertificateBoundAccessTokens: s.tlsClientAuth,
+	}, nil
+}
+
+// signingAlgs returns the distinct signing algorithms of the keys.
+func signingAlgs(verifying []*keys.Key) []string {
+	var algs []string
+	for _, key := range verifying {
+		if alg := key.Method.Alg(); !slices.Contains(algs, alg) {
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
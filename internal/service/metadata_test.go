@@ -0,0 +1,125 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ingka-group/iam-proxy/internal/keys"
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+func TestService_Metadata(t *testing.T) {
+	ctx := context.TODO()
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	signing, err := keys.ParsePEM(privateKeyPEM(t, ecKey), "")
+	assert.NoError(t, err)
+
+	type test struct {
+		ring          []*keys.Key
+		tlsClientAuth bool
+		want          models.Metadata
+	}
+
+	tests := map[string]test{
+		"shared_secret": {
+			want: models.Metadata{
+				AuthMethods:      []string{"client_secret_basic", "client_secret_post", "private_key_jwt"},
+				TokenSigningAlgs: []string{"HS512"},
+			},
+		},
+		"rotated_keys": {
+			ring: []*keys.Key{signing, keys.NewSecret([]byte("secret")), keys.NewSecret([]byte("older"))},
+			want: models.Metadata{
+				AuthMethods:      []string{"client_secret_basic", "client_secret_post", "private_key_jwt"},
+				TokenSigningAlgs: []string{"ES256", "HS512"},
+			},
+		},
+		"tls_client_auth": {
+			tlsClientAuth: true,
+			want: models.Metadata{
+				AuthMethods:                  []string{"client_secret_basic", "client_secret_post", "private_key_jwt", "tls_client_auth"},
+				TokenSigningAlgs:             []string{"HS512"},
+				CertificateBoundAccessTokens: true,
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestService()
+			srv.issuer = issuerURL("https://iam.example.com")
+			if len(tt.ring) > 0 {
+				srv.ring, err = keys.NewRing(tt.ring[0], tt.ring[1:]...)
+				assert.NoError(t, err)
+			}
+			srv.tlsClientAuth = tt.tlsClientAuth
+
+			metadata, err := srv.Metadata(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{models.GrantTypeClientCredentials, models.GrantTypeRefreshToken, models.GrantTypeTokenExchange}, metadata.GrantTypes)
+			assert.Equal(t, assertionMethods, metadata.AssertionSigningAlgs)
+			assert.Equal(t, assertionMethods, metadata.DPoPSigningAlgs)
+			assert.Equal(t, "https://iam.example.com/iam/v1", metadata.Issuer)
+			metadata.Issuer, metadata.GrantTypes, metadata.AssertionSigningAlgs, metadata.DPoPSigningAlgs = "", nil, nil, nil
+			assert.Equal(t, tt.want, metadata)
+		})
+	}
+}
+
+func TestService_Metadata_Issuer(t *testing.T) {
+	ctx := context.TODO()
+
+	tests := map[string]struct {
+		publicURL string
+		want      string
+		err       error
+	}{
+		"default":    {err: ErrNoIssuerURL},
+		"http":       {publicURL: "http://iam.example.com", err: ErrNoIssuerURL},
+		"public_url": {publicURL: "https://iam.example.com/", want: "https://iam.example.com/iam/v1"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestService()
+			srv.issuer = issuerURL(tt.publicURL)
+
+			// the published issuer is the iss claim of the tokens, which assertions may be meant for
+			metadata, err := srv.Metadata(ctx)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, metadata.Issuer)
+			token, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+			assert.NoError(t, err)
+			assert.Equal(t, metadata.Issuer, unverifiedClaims(t, token.AccessToken).Issuer)
+			assert.Equal(t, metadata.Issuer, unverifiedClaims(t, token.IdentityToken).Issuer)
+			assert.True(t, srv.acceptsAssertionAudience(metadata.Issuer))
+
+			_, err = srv.ParseToken(ctx, token.AccessToken, models.TokenUseAccess, "")
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -21,9 +21,12 @@
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	health "github.com/ingka-group/iam-proxy/client/health"
+	jwk "github.com/ingka-group/iam-proxy/client/jwk"
+	models "github.com/ingka-group/iam-proxy/internal/models"
 )
 
 // MockServicer is a mock of Servicer interface.
@@ -49,21 +52,122 @@ func (m *MockServicer) EXPECT() *MockServicerMockRecorder {
 	return m.recorder
 }
 
-// GenerateToken mocks base method.
-func (m *MockServicer) GenerateToken(ctx context.Context, key, secret string) (string, string, int64, error) {
+// AuthorizeAdmin mocks base method.
+func (m *MockServicer) AuthorizeAdmin(ctx context.Context, req models.ValidationRequest) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GenerateToken", ctx, key, secret)
-	ret0, _ := ret[0].(string)
+	ret := m.ctrl.Call(m, "AuthorizeAdmin", ctx, req)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AuthorizeAdmin indicates an expected call of AuthorizeAdmin.
+func (mr *MockServicerMockRecorder) AuthorizeAdmin(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthorizeAdmin", reflect.TypeOf((*MockServicer)(nil).AuthorizeAdmin), ctx, req)
+}
+
+// Client mocks base method.
+func (m *MockServicer) Client(ctx context.Context, id models.ClientID) (models.Secret, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Client", ctx, id)
+	ret0, _ := ret[0].(models.Secret)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Client indicates an expected call of Client.
+func (mr *MockServicerMockRecorder) Client(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Client", reflect.TypeOf((*MockServicer)(nil).Client), ctx, id)
+}
+
+// Clients mocks base method.
+func (m *MockServicer) Clients(ctx context.Context) (models.IAM, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Clients", ctx)
+	ret0, _ := ret[0].(models.IAM)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Clients indicates an expected call of Clients.
+func (mr *MockServicerMockRecorder) Clients(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Clients", reflect.TypeOf((*MockServicer)(nil).Clients), ctx)
+}
+
+// CreateClient mocks base method.
+func (m *MockServicer) CreateClient(ctx context.Context, id models.ClientID, client models.Secret) (models.ClientID, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateClient", ctx, id, client)
+	ret0, _ := ret[0].(models.ClientID)
 	ret1, _ := ret[1].(string)
-	ret2, _ := ret[2].(int64)
-	ret3, _ := ret[3].(error)
-	return ret0, ret1, ret2, ret3
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// CreateClient indicates an expected call of CreateClient.
+func (mr *MockServicerMockRecorder) CreateClient(ctx, id, client interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateClient", reflect.TypeOf((*MockServicer)(nil).CreateClient), ctx, id, client)
+}
+
+// DPoPNonce mocks base method.
+func (m *MockServicer) DPoPNonce(ctx context.Context) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DPoPNonce", ctx)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DPoPNonce indicates an expected call of DPoPNonce.
+func (mr *MockServicerMockRecorder) DPoPNonce(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DPoPNonce", reflect.TypeOf((*MockServicer)(nil).DPoPNonce), ctx)
+}
+
+// DeleteClient mocks base method.
+func (m *MockServicer) DeleteClient(ctx context.Context, id models.ClientID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteClient", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteClient indicates an expected call of DeleteClient.
+func (mr *MockServicerMockRecorder) DeleteClient(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteClient", reflect.TypeOf((*MockServicer)(nil).DeleteClient), ctx, id)
+}
+
+// DisableClient mocks base method.
+func (m *MockServicer) DisableClient(ctx context.Context, id models.ClientID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableClient", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableClient indicates an expected call of DisableClient.
+func (mr *MockServicerMockRecorder) DisableClient(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableClient", reflect.TypeOf((*MockServicer)(nil).DisableClient), ctx, id)
+}
+
+// GenerateToken mocks base method.
+func (m *MockServicer) GenerateToken(ctx context.Context, req models.TokenRequest) (models.Token, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GenerateToken", ctx, req)
+	ret0, _ := ret[0].(models.Token)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // GenerateToken indicates an expected call of GenerateToken.
-func (mr *MockServicerMockRecorder) GenerateToken(ctx, key, secret interface{}) *gomock.Call {
+func (mr *MockServicerMockRecorder) GenerateToken(ctx, req interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateToken", reflect.TypeOf((*MockServicer)(nil).GenerateToken), ctx, key, secret)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateToken", reflect.TypeOf((*MockServicer)(nil).GenerateToken), ctx, req)
 }
 
 // Health mocks base method.
@@ -81,19 +185,69 @@ func (mr *MockServicerMockRecorder) Health(ctx interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Health", reflect.TypeOf((*MockServicer)(nil).Health), ctx)
 }
 
+// IntrospectToken mocks base method.
+func (m *MockServicer) IntrospectToken(ctx context.Context, req models.IntrospectionRequest) (models.Introspection, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IntrospectToken", ctx, req)
+	ret0, _ := ret[0].(models.Introspection)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IntrospectToken indicates an expected call of IntrospectToken.
+func (mr *MockServicerMockRecorder) IntrospectToken(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IntrospectToken", reflect.TypeOf((*MockServicer)(nil).IntrospectToken), ctx, req)
+}
+
+// JWKS mocks base method.
+func (m *MockServicer) JWKS(ctx context.Context) (jwk.Set, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JWKS", ctx)
+	ret0, _ := ret[0].(jwk.Set)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// JWKS indicates an expected call of JWKS.
+func (mr *MockServicerMockRecorder) JWKS(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JWKS", reflect.TypeOf((*MockServicer)(nil).JWKS), ctx)
+}
+
+// Metadata mocks base method.
+func (m *MockServicer) Metadata(ctx context.Context) (models.Metadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Metadata", ctx)
+	ret0, _ := ret[0].(models.Metadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Metadata indicates an expected call of Metadata.
+func (mr *MockServicerMockRecorder) Metadata(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Metadata", reflect.TypeOf((*MockServicer)(nil).Metadata), ctx)
+}
+
 // ParseToken mocks base method.
-func (m *MockServicer) ParseToken(tokenString string) (string, error) {
+func (m *MockServicer) ParseToken(ctx context.Context, tokenString string, use models.TokenUse, audience string, scopes ...string) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ParseToken", tokenString)
+	varargs := []interface{}{ctx, tokenString, use, audience}
+	for _, a := range scopes {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ParseToken", varargs...)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // ParseToken indicates an expected call of ParseToken.
-func (mr *MockServicerMockRecorder) ParseToken(tokenString interface{}) *gomock.Call {
+func (mr *MockServicerMockRecorder) ParseToken(ctx, tokenString, use, audience interface{}, scopes ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ParseToken", reflect.TypeOf((*MockServicer)(nil).ParseToken), tokenString)
+	varargs := append([]interface{}{ctx, tokenString, use, audience}, scopes...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ParseToken", reflect.TypeOf((*MockServicer)(nil).ParseToken), varargs...)
 }
 
 // Ready mocks base method.
@@ -109,3 +263,435 @@ func (mr *MockServicerMockRecorder) Ready(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ready", reflect.TypeOf((*MockServicer)(nil).Ready), ctx)
 }
+
+// RevokeToken mocks base method.
+func (m *MockServicer) RevokeToken(ctx context.Context, req models.RevocationRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeToken", ctx, req)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeToken indicates an expected call of RevokeToken.
+func (mr *MockServicerMockRecorder) RevokeToken(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeToken", reflect.TypeOf((*MockServicer)(nil).RevokeToken), ctx, req)
+}
+
+// RotateClientSecret mocks base method.
+func (m *MockServicer) RotateClientSecret(ctx context.Context, id models.ClientID, overlap time.Duration) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateClientSecret", ctx, id, overlap)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateClientSecret indicates an expected call of RotateClientSecret.
+func (mr *MockServicerMockRecorder) RotateClientSecret(ctx, id, overlap interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateClientSecret", reflect.TypeOf((*MockServicer)(nil).RotateClientSecret), ctx, id, overlap)
+}
+
+// UpdateClient mocks base method.
+func (m *MockServicer) UpdateClient(ctx context.Context, id models.ClientID, client models.Secret) (models.Secret, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateClient", ctx, id, client)
+	ret0, _ := ret[0].(models.Secret)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateClient indicates an expected call of UpdateClient.
+func (mr *MockServicerMockRecorder) UpdateClient(ctx, id, client interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateClient", reflect.TypeOf((*MockServicer)(nil).UpdateClient), ctx, id, client)
+}
+
+// ValidateToken mocks base method.
+func (m *MockServicer) ValidateToken(ctx context.Context, req models.ValidationRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidateToken", ctx, req)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ValidateToken indicates an expected call of ValidateToken.
+func (mr *MockServicerMockRecorder) ValidateToken(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateToken", reflect.TypeOf((*MockServicer)(nil).ValidateToken), ctx, req)
+}
+
+// MockCredentialStore is a mock of CredentialStore interface.
+type MockCredentialStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockCredentialStoreMockRecorder
+}
+
+// MockCredentialStoreMockRecorder is the mock recorder for MockCredentialStore.
+type MockCredentialStoreMockRecorder struct {
+	mock *MockCredentialStore
+}
+
+// NewMockCredentialStore creates a new mock instance.
+func NewMockCredentialStore(ctrl *gomock.Controller) *MockCredentialStore {
+	mock := &MockCredentialStore{ctrl: ctrl}
+	mock.recorder = &MockCredentialStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCredentialStore) EXPECT() *MockCredentialStoreMockRecorder {
+	return m.recorder
+}
+
+// Client mocks base method.
+func (m *MockCredentialStore) Client(ctx context.Context, id models.ClientID) (models.Secret, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Client", ctx, id)
+	ret0, _ := ret[0].(models.Secret)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Client indicates an expected call of Client.
+func (mr *MockCredentialStoreMockRecorder) Client(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Client", reflect.TypeOf((*MockCredentialStore)(nil).Client), ctx, id)
+}
+
+// Clients mocks base method.
+func (m *MockCredentialStore) Clients(ctx context.Context) (models.IAM, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Clients", ctx)
+	ret0, _ := ret[0].(models.IAM)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Clients indicates an expected call of Clients.
+func (mr *MockCredentialStoreMockRecorder) Clients(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Clients", reflect.TypeOf((*MockCredentialStore)(nil).Clients), ctx)
+}
+
+// Health mocks base method.
+func (m *MockCredentialStore) Health(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Health", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Health indicates an expected call of Health.
+func (mr *MockCredentialStoreMockRecorder) Health(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Health", reflect.TypeOf((*MockCredentialStore)(nil).Health), ctx)
+}
+
+// MockWritableCredentialStore is a mock of WritableCredentialStore interface.
+type MockWritableCredentialStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockWritableCredentialStoreMockRecorder
+}
+
+// MockWritableCredentialStoreMockRecorder is the mock recorder for MockWritableCredentialStore.
+type MockWritableCredentialStoreMockRecorder struct {
+	mock *MockWritableCredentialStore
+}
+
+// NewMockWritableCredentialStore creates a new mock instance.
+func NewMockWritableCredentialStore(ctrl *gomock.Controller) *MockWritableCredentialStore {
+	mock := &MockWritableCredentialStore{ctrl: ctrl}
+	mock.recorder = &MockWritableCredentialStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWritableCredentialStore) EXPECT() *MockWritableCredentialStoreMockRecorder {
+	return m.recorder
+}
+
+// Client mocks base method.
+func (m *MockWritableCredentialStore) Client(ctx context.Context, id models.ClientID) (models.Secret, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Client", ctx, id)
+	ret0, _ := ret[0].(models.Secret)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Client indicates an expected call of Client.
+func (mr *MockWritableCredentialStoreMockRecorder) Client(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Client", reflect.TypeOf((*MockWritableCredentialStore)(nil).Client), ctx, id)
+}
+
+// Clients mocks base method.
+func (m *MockWritableCredentialStore) Clients(ctx context.Context) (models.IAM, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Clients", ctx)
+	ret0, _ := ret[0].(models.IAM)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Clients indicates an expected call of Clients.
+func (mr *MockWritableCredentialStoreMockRecorder) Clients(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Clients", reflect.TypeOf((*MockWritableCredentialStore)(nil).Clients), ctx)
+}
+
+// CreateClient mocks base method.
+func (m *MockWritableCredentialStore) CreateClient(ctx context.Context, id models.ClientID, client models.Secret) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateClient", ctx, id, client)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateClient indicates an expected call of CreateClient.
+func (mr *MockWritableCredentialStoreMockRecorder) CreateClient(ctx, id, client interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateClient", reflect.TypeOf((*MockWritableCredentialStore)(nil).CreateClient), ctx, id, client)
+}
+
+// DeleteClient mocks base method.
+func (m *MockWritableCredentialStore) DeleteClient(ctx context.Context, id models.ClientID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteClient", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteClient indicates an expected call of DeleteClient.
+func (mr *MockWritableCredentialStoreMockRecorder) DeleteClient(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteClient", reflect.TypeOf((*MockWritableCredentialStore)(nil).DeleteClient), ctx, id)
+}
+
+// Health mocks base method.
+func (m *MockWritableCredentialStore) Health(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Health", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Health indicates an expected call of Health.
+func (mr *MockWritableCredentialStoreMockRecorder) Health(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Health", reflect.TypeOf((*MockWritableCredentialStore)(nil).Health), ctx)
+}
+
+// UpdateClient mocks base method.
+func (m *MockWritableCredentialStore) UpdateClient(ctx context.Context, id models.ClientID, client models.Secret) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateClient", ctx, id, client)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateClient indicates an expected call of UpdateClient.
+func (mr *MockWritableCredentialStoreMockRecorder) UpdateClient(ctx, id, client interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateClient", reflect.TypeOf((*MockWritableCredentialStore)(nil).UpdateClient), ctx, id, client)
+}
+
+// MockRevocationStore is a mock of RevocationStore interface.
+type MockRevocationStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockRevocationStoreMockRecorder
+}
+
+// MockRevocationStoreMockRecorder is the mock recorder for MockRevocationStore.
+type MockRevocationStoreMockRecorder struct {
+	mock *MockRevocationStore
+}
+
+// NewMockRevocationStore creates a new mock instance.
+func NewMockRevocationStore(ctrl *gomock.Controller) *MockRevocationStore {
+	mock := &MockRevocationStore{ctrl: ctrl}
+	mock.recorder = &MockRevocationStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRevocationStore) EXPECT() *MockRevocationStoreMockRecorder {
+	return m.recorder
+}
+
+// Health mocks base method.
+func (m *MockRevocationStore) Health(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Health", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Health indicates an expected call of Health.
+func (mr *MockRevocationStoreMockRecorder) Health(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Health", reflect.TypeOf((*MockRevocationStore)(nil).Health), ctx)
+}
+
+// Revoke mocks base method.
+func (m *MockRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revoke", ctx, jti, expiresAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Revoke indicates an expected call of Revoke.
+func (mr *MockRevocationStoreMockRecorder) Revoke(ctx, jti, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revoke", reflect.TypeOf((*MockRevocationStore)(nil).Revoke), ctx, jti, expiresAt)
+}
+
+// Revoked mocks base method.
+func (m *MockRevocationStore) Revoked(ctx context.Context, jti string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revoked", ctx, jti)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Revoked indicates an expected call of Revoked.
+func (mr *MockRevocationStoreMockRecorder) Revoked(ctx, jti interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revoked", reflect.TypeOf((*MockRevocationStore)(nil).Revoked), ctx, jti)
+}
+
+// MockRefreshTokenStore is a mock of RefreshTokenStore interface.
+type MockRefreshTokenStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockRefreshTokenStoreMockRecorder
+}
+
+// MockRefreshTokenStoreMockRecorder is the mock recorder for MockRefreshTokenStore.
+type MockRefreshTokenStoreMockRecorder struct {
+	mock *MockRefreshTokenStore
+}
+
+// NewMockRefreshTokenStore creates a new mock instance.
+func NewMockRefreshTokenStore(ctrl *gomock.Controller) *MockRefreshTokenStore {
+	mock := &MockRefreshTokenStore{ctrl: ctrl}
+	mock.recorder = &MockRefreshTokenStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRefreshTokenStore) EXPECT() *MockRefreshTokenStoreMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockRefreshTokenStore) Create(ctx context.Context, token models.RefreshToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockRefreshTokenStoreMockRecorder) Create(ctx, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRefreshTokenStore)(nil).Create), ctx, token)
+}
+
+// Health mocks base method.
+func (m *MockRefreshTokenStore) Health(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Health", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Health indicates an expected call of Health.
+func (mr *MockRefreshTokenStoreMockRecorder) Health(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Health", reflect.TypeOf((*MockRefreshTokenStore)(nil).Health), ctx)
+}
+
+// RevokeFamily mocks base method.
+func (m *MockRefreshTokenStore) RevokeFamily(ctx context.Context, family string) ([]models.RefreshToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeFamily", ctx, family)
+	ret0, _ := ret[0].([]models.RefreshToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokeFamily indicates an expected call of RevokeFamily.
+func (mr *MockRefreshTokenStoreMockRecorder) RevokeFamily(ctx, family interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeFamily", reflect.TypeOf((*MockRefreshTokenStore)(nil).RevokeFamily), ctx, family)
+}
+
+// Use mocks base method.
+func (m *MockRefreshTokenStore) Use(ctx context.Context, id string) (models.RefreshToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Use", ctx, id)
+	ret0, _ := ret[0].(models.RefreshToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Use indicates an expected call of Use.
+func (mr *MockRefreshTokenStoreMockRecorder) Use(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Use", reflect.TypeOf((*MockRefreshTokenStore)(nil).Use), ctx, id)
+}
+
+// MockReplayStore is a mock of ReplayStore interface.
+type MockReplayStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockReplayStoreMockRecorder
+}
+
+// MockReplayStoreMockRecorder is the mock recorder for MockReplayStore.
+type MockReplayStoreMockRecorder struct {
+	mock *MockReplayStore
+}
+
+// NewMockReplayStore creates a new mock instance.
+func NewMockReplayStore(ctrl *gomock.Controller) *MockReplayStore {
+	mock := &MockReplayStore{ctrl: ctrl}
+	mock.recorder = &MockReplayStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockReplayStore) EXPECT() *MockReplayStoreMockRecorder {
+	return m.recorder
+}
+
+// Health mocks base method.
+func (m *MockReplayStore) Health(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Health", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Health indicates an expected call of Health.
+func (mr *MockReplayStoreMockRecorder) Health(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Health", reflect.TypeOf((*MockReplayStore)(nil).Health), ctx)
+}
+
+// Use mocks base method.
+func (m *MockReplayStore) Use(ctx context.Context, id string, expiresAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Use", ctx, id, expiresAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Use indicates an expected call of Use.
+func (mr *MockReplayStoreMockRecorder) Use(ctx, id, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Use", reflect.TypeOf((*MockReplayStore)(nil).Use), ctx, id, expiresAt)
+}
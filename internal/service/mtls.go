@@ -0,0 +1,115 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+
+	"github.com/ingka-group/iam-proxy/internal/credentials"
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+// Reasons a client certificate is rejected.
+var (
+	ErrCertificateMismatch = errors.New("client certificate does not match")
+	// ErrCertificateRequired marks requests lacking the client certificate that their tokens are bound to.
+	ErrCertificateRequired = errors.New("client certificate is required")
+)
+
+// verifyCertificate authenticates the client of tls_client_auth with its TLS client certificate, see RFC 8705
+// section 2.1. The certificate chain was verified by the TLS handshake, its subject must match the client.
+func (s *Service) verifyCertificate(ctx context.Context, clientID string, certificate *x509.Certificate) (models.Secret, error) {
+	if len(clientID) == 0 {
+		return models.Secret{}, fmt.Errorf("%w: no client Id provided", ErrInvalidCredentials)
+	}
+	client, err := s.credentialStore().Client(ctx, models.ClientID(clientID))
+	if errors.Is(err, credentials.ErrNotFound) {
+		return models.Secret{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	if err != nil {
+		return models.Secret{}, fmt.Errorf("could not look up client: %w", err)
+	}
+	if !client.UsesTLSClientAuth() {
+		return models.Secret{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, ErrAuthMethodMismatch)
+	}
+	if !matchesCertificate(client.TLSClientAuth, certificate) {
+		return models.Secret{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, ErrCertificateMismatch)
+	}
+	if client.Disabled {
+		return models.Secret{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, ErrClientDisabled)
+	}
+	return client, nil
+}
+
+// matchesCertificate tells whether the certificate has the subject or subject alternative name of the client.
+func matchesCertificate(auth models.TLSClientAuth, certificate *x509.Certificate) bool {
+	switch {
+	case len(auth.SubjectDN) > 0:
+		return certificate.Subject.String() == auth.SubjectDN
+	case len(auth.SANDNS) > 0:
+		return slices.Contains(certificate.DNSNames, auth.SANDNS)
+	case len(auth.SANURI) > 0:
+		return slices.ContainsFunc(certificate.URIs, func(uri *url.URL) bool { return uri.String() == auth.SANURI })
+	case len(auth.SANIP) > 0:
+		ip := net.ParseIP(auth.SANIP)
+		return slices.ContainsFunc(certificate.IPAddresses, ip.Equal)
+	case len(auth.SANEmail) > 0:
+		return slices.Contains(certificate.EmailAddresses, auth.SANEmail)
+	}
+	return false
+}
+
+// certificateThumbprint returns the x5t#S256 confirmation of the certificate, see RFC 8705 section 3.1.
+func certificateThumbprint(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// certificateBinding returns the thumbprint of the certificate the access tokens of the request are bound to,
+// empty for bearer tokens. Tokens of clients authenticating with their certificate, or asking for
+// certificate-bound tokens, are bound to it.
+func certificateBinding(client models.Secret, req models.TokenRequest) (string, error) {
+	if !client.UsesTLSClientAuth() && !client.TLSClientCertificateBoundAccessTokens {
+		return "", nil
+	}
+	if req.ClientCertificate == nil {
+		return "", fmt.Errorf("%s must present its certificate: %w", client.AppName, ErrCertificateRequired)
+	}
+	return certificateThumbprint(req.ClientCertificate), nil
+}
+
+// verifyCertificateBinding checks that the request presents the certificate the token is bound to, if any.
+func verifyCertificateBinding(cnf *models.Confirmation, certificate *x509.Certificate) error {
+	if cnf == nil || len(cnf.X509Thumbprint) == 0 {
+		return nil
+	}
+	if certificate == nil {
+		return fmt.Errorf("token is bound to a certificate: %w", ErrCertificateRequired)
+	}
+	thumbprint := certificateThumbprint(certificate)
+	if subtle.ConstantTimeCompare([]byte(thumbprint), []byte(cnf.X509Thumbprint)) != 1 {
+		return ErrCertificateMismatch
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ingka-group/iam-proxy/internal/models"
+	"github.com/ingka-group/iam-proxy/internal/testutil"
+)
+
+const testCertificateClientID = "certificate-client"
+
+func TestService_GenerateToken_ClientCertificate(t *testing.T) {
+	ctx := context.TODO()
+	spiffe, err := url.Parse("spiffe://example.com/billing")
+	assert.NoError(t, err)
+	certificate := testCertificate(t, &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "billing", Organization: []string{"Example"}},
+		DNSNames:       []string{"billing.example.com"},
+		URIs:           []*url.URL{spiffe},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+		EmailAddresses: []string{"billing@example.com"},
+	})
+	other := testCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "stock"}})
+
+	type test struct {
+		auth        models.TLSClientAuth
+		certificate *x509.Certificate
+		secret      string
+		err         error
+	}
+
+	tests := map[string]test{
+		"subject_dn": {
+			auth:        models.TLSClientAuth{SubjectDN: "CN=billing,O=Example"},
+			certificate: certificate,
+		},
+		"san_dns": {
+			auth:        models.TLSClientAuth{SANDNS: "billing.example.com"},
+			certificate: certificate,
+		},
+		"san_uri": {
+			auth:        models.TLSClientAuth{SANURI: "spiffe://example.com/billing"},
+			certificate: certificate,
+		},
+		"san_ip": {
+			auth:        models.TLSClientAuth{SANIP: "10.0.0.1"},
+			certificate: certificate,
+		},
+		"san_email": {
+			auth:        models.TLSClientAuth{SANEmail: "billing@example.com"},
+			certificate: certificate,
+		},
+		"subject_dn_mismatch": {
+			auth:        models.TLSClientAuth{SubjectDN: "CN=billing,O=Example"},
+			certificate: other,
+			err:         ErrCertificateMismatch,
+		},
+		"san_dns_mismatch": {
+			auth:        models.TLSClientAuth{SANDNS: "stock.example.com"},
+			certificate: certificate,
+			err:         ErrCertificateMismatch,
+		},
+		"certificate_missing": {
+			auth: models.TLSClientAuth{SANDNS: "billing.example.com"},
+			err:  ErrInvalidCredentials,
+		},
+		"secret": {
+			auth:        models.TLSClientAuth{SANDNS: "billing.example.com"},
+			certificate: certificate,
+			secret:      testClientSecret1,
+			err:         ErrSecretMismatch,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestService()
+			srv.IAM[testCertificateClientID] = models.Secret{AppName: "billing", TokenEndpointAuthMethod: models.AuthMethodTLSClientAuth, TLSClientAuth: tt.auth}
+
+			issued, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: testCertificateClientID, ClientSecret: tt.secret, ClientCertificate: tt.certificate})
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+				return
+			}
+			assert.NoError(t, err)
+
+			// the access token is bound to the certificate
+			introspection, err := srv.IntrospectToken(ctx, models.IntrospectionRequest{ClientID: testCertificateClientID, ClientCertificate: tt.certificate, Token: issued.AccessToken})
+			assert.NoError(t, err)
+			assert.Equal(t, &models.Confirmation{X509Thumbprint: certificateThumbprint(tt.certificate)}, introspection.Confirmation)
+			assert.NoError(t, srv.ValidateToken(ctx, models.ValidationRequest{Token: issued.AccessToken, ClientCertificate: tt.certificate}))
+			assert.ErrorIs(t, srv.ValidateToken(ctx, models.ValidationRequest{Token: issued.AccessToken, ClientCertificate: other}), ErrCertificateMismatch)
+			assert.ErrorIs(t, srv.ValidateToken(ctx, models.ValidationRequest{Token: issued.AccessToken}), ErrCertificateRequired)
+		})
+	}
+}
+
+func TestService_GenerateToken_CertificateBound(t *testing.T) {
+	ctx := context.TODO()
+	certificate := testCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ocp"}})
+	srv := newTestService()
+
+	// bearer tokens validate with or without a certificate
+	issued, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, ClientCertificate: certificate})
+	assert.NoError(t, err)
+	assert.Nil(t, unverifiedClaims(t, issued.AccessToken).Confirmation)
+	assert.NoError(t, srv.ValidateToken(ctx, models.ValidationRequest{Token: issued.AccessToken}))
+	assert.NoError(t, srv.ValidateToken(ctx, models.ValidationRequest{Token: issued.AccessToken, ClientCertificate: certificate}))
+
+	// clients authenticating with a secret may ask for certificate-bound tokens
+	client := srv.IAM[testClientID1]
+	client.TLSClientCertificateBoundAccessTokens = true
+	srv.IAM[testClientID1] = client
+	issued, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, ClientCertificate: certificate})
+	assert.NoError(t, err)
+	assert.Equal(t, certificateThumbprint(certificate), unverifiedClaims(t, issued.AccessToken).Confirmation.X509Thumbprint)
+	assert.NoError(t, srv.ValidateToken(ctx, models.ValidationRequest{Token: issued.AccessToken, ClientCertificate: certificate}))
+	assert.ErrorIs(t, srv.ValidateToken(ctx, models.ValidationRequest{Token: issued.AccessToken}), ErrCertificateRequired)
+
+	_, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	assert.ErrorIs(t, err, ErrCertificateRequired)
+
+	// so are admin tokens
+	other := testCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "stock"}})
+	client.Scopes = []string{models.ScopeAdmin}
+	srv.IAM[testClientID1] = client
+	issued, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, Scope: []string{models.ScopeAdmin}, ClientCertificate: certificate})
+	assert.NoError(t, err)
+	assert.NoError(t, srv.AuthorizeAdmin(ctx, models.ValidationRequest{Token: issued.AccessToken, ClientCertificate: certificate}))
+	assert.ErrorIs(t, srv.AuthorizeAdmin(ctx, models.ValidationRequest{Token: issued.AccessToken, ClientCertificate: other}), ErrCertificateMismatch)
+	assert.ErrorIs(t, srv.AuthorizeAdmin(ctx, models.ValidationRequest{Token: issued.AccessToken}), ErrCertificateRequired)
+
+	// the certificate does not authenticate clients of other methods
+	_, err = srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientCertificate: certificate})
+	assert.ErrorIs(t, err, ErrAuthMethodMismatch)
+}
+
+func testCertificate(t *testing.T, template *x509.Certificate) *x509.Certificate {
+	certificate, _, _, err := testutil.Certificate(template)
+	assert.NoError(t, err)
+	return certificate
+}
@@ -0,0 +1,169 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ingka-group/iam-proxy/internal/models"
+	"github.com/ingka-group/iam-proxy/internal/refresh"
+	"github.com/ingka-group/iam-proxy/internal/secret"
+)
+
+// refreshTokenID is the key of the refresh token in the store, refresh tokens themselves are not stored.
+func refreshTokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// refreshToken returns the refresh token of the request, which is rotated: it cannot be used twice. It is
+// only checked here, and used up once the next one is issued, see issueRefreshToken, so a refused request
+// leaves it usable. A refresh token presented again, or by another client, leaked; its family is revoked
+// with the access tokens issued along.
+func (s *Service) refreshToken(ctx context.Context, req models.TokenRequest) (models.RefreshToken, error) {
+	if len(req.RefreshToken) == 0 {
+		return models.RefreshToken{}, fmt.Errorf("%w: refresh token is missing", ErrInvalidGrant)
+	}
+	used, err := s.refreshTokens.Get(ctx, refreshTokenID(req.RefreshToken))
+	switch {
+	case errors.Is(err, refresh.ErrNotFound):
+		return models.RefreshToken{}, fmt.Errorf("%w: %w", ErrInvalidGrant, err)
+	case err != nil:
+		return models.RefreshToken{}, fmt.Errorf("could not look up refresh token: %w", err)
+	case used.Used:
+		return models.RefreshToken{}, s.refreshReused(ctx, used.Family)
+	}
+	if used.ClientID != req.ClientID {
+		if err := s.revokeRefreshFamily(ctx, used.Family); err != nil {
+			return models.RefreshToken{}, err
+		}
+		return models.RefreshToken{}, fmt.Errorf("%w: %w", ErrInvalidGrant, ErrTokenNotIssuedToClient)
+	}
+	if time.Now().After(used.ExpiresAt) {
+		return models.RefreshToken{}, fmt.Errorf("%w: refresh token expired", ErrInvalidGrant)
+	}
+	return used, nil
+}
+
+// refreshReused revokes the family of a refresh token presented again, returning the error of the request.
+func (s *Service) refreshReused(ctx context.Context, family string) error {
+	if err := s.revokeRefreshFamily(ctx, family); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidGrant, refresh.ErrReused)
+}
+
+// revokeRefreshFamily revokes the refresh tokens of the family and the access tokens issued along.
+func (s *Service) revokeRefreshFamily(ctx context.Context, family string) error {
+	tokens, err := s.refreshTokens.RevokeFamily(ctx, family)
+	if err != nil {
+		return fmt.Errorf("could not revoke refresh tokens: %w", err)
+	}
+	for _, t := range tokens {
+		if len(t.AccessTokenID) == 0 || time.Now().After(t.AccessTokenExpiresAt.Add(s.validation.leeway)) {
+			continue
+		}
+		if err := s.revocations.Revoke(ctx, t.AccessTokenID, t.AccessTokenExpiresAt.Add(s.validation.leeway)); err != nil {
+			return fmt.Errorf("could not revoke access token: %w", err)
+		}
+	}
+	return nil
+}
+
+// issueRefreshToken creates the refresh token issued along the access token described by issued. It
+// continues the family of the previous refresh token, if any, which is used up in its place, or starts a
+// new one.
+func (s *Service) issueRefreshToken(ctx context.Context, req models.TokenRequest, previous *models.RefreshToken,
+	issued models.RefreshToken) (string, error) {
+	token, err := secret.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	issued.ID = refreshTokenID(token)
+	issued.ClientID = req.ClientID
+	issued.Scope = req.Scope
+	issued.Audience = req.Audience
+	if previous != nil {
+		issued.Family = previous.Family
+		issued.FamilyExpiresAt = previous.FamilyExpiresAt
+	} else {
+		issued.Family = uuid.New().String()
+		issued.FamilyExpiresAt = issued.IssuedAt.Add(s.refreshExpiration)
+	}
+	issued.ExpiresAt = issued.IssuedAt.Add(s.refreshIdleExpiration)
+	if issued.ExpiresAt.After(issued.FamilyExpiresAt) {
+		issued.ExpiresAt = issued.FamilyExpiresAt
+	}
+
+	if previous == nil {
+		if err := s.refreshTokens.Create(ctx, issued); err != nil {
+			return "", err
+		}
+		return token, nil
+	}
+	err = s.refreshTokens.Rotate(ctx, previous.ID, issued)
+	switch {
+	// a concurrent request used the previous refresh token first
+	case errors.Is(err, refresh.ErrReused):
+		return "", s.refreshReused(ctx, previous.Family)
+	case errors.Is(err, refresh.ErrNotFound):
+		return "", fmt.Errorf("%w: %w", ErrInvalidGrant, err)
+	case err != nil:
+		return "", err
+	}
+	return token, nil
+}
+
+// revokeRefreshToken revokes the family of the refresh token for the client. Refresh tokens that do not
+// exist need no revocation and are ignored.
+func (s *Service) revokeRefreshToken(ctx context.Context, client models.Secret, req models.RevocationRequest) error {
+	used, err := s.refreshTokens.Get(ctx, refreshTokenID(req.Token))
+	if errors.Is(err, refresh.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not find refresh token: %w", err)
+	}
+	// a refresh token held by another client leaked, it is revoked either way
+	if err := s.revokeRefreshFamily(ctx, used.Family); err != nil {
+		return err
+	}
+	if used.ClientID != req.ClientID && !slices.Contains(client.Scopes, models.ScopeAdmin) {
+		return fmt.Errorf("%s may not revoke the token: %w", req.ClientID, ErrTokenNotIssuedToClient)
+	}
+	return nil
+}
+
+// narrow returns requested, which must be a subset of granted, or granted when nothing is requested.
+func narrow(granted, requested []string, notAllowed error) ([]string, error) {
+	if len(requested) == 0 {
+		return granted, nil
+	}
+	for _, r := range requested {
+		if !slices.Contains(granted, r) {
+			return nil, fmt.Errorf("%s was not granted: %w", r, notAllowed)
+		}
+	}
+	return requested, nil
+}
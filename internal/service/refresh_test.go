@@ -0,0 +1,191 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+func TestService_GenerateToken_Refresh(t *testing.T) {
+	ctx := context.TODO()
+	owner := models.TokenRequest{GrantType: models.GrantTypeRefreshToken, ClientID: testClientID1, ClientSecret: testClientSecret1}
+
+	type test struct {
+		req models.TokenRequest
+		// reuse presents the refresh token a second time
+		reuse bool
+		// idle and absolute override the refresh token lifetimes
+		idle     time.Duration
+		absolute time.Duration
+		scope    []string
+		// change changes the service once the refresh token is issued
+		change func(srv *Service)
+		err    error
+		// retry is the scope of a request succeeding after the refused one, the refresh token is kept
+		retry []string
+	}
+
+	tests := map[string]test{
+		"refresh": {
+			req:   owner,
+			scope: []string{"read", "write"},
+		},
+		"narrowed_scope": {
+			req:   models.TokenRequest{GrantType: owner.GrantType, ClientID: owner.ClientID, ClientSecret: owner.ClientSecret, Scope: []string{"read"}},
+			scope: []string{"read"},
+		},
+		"widened_scope": {
+			req:   models.TokenRequest{GrantType: owner.GrantType, ClientID: owner.ClientID, ClientSecret: owner.ClientSecret, Scope: []string{"admin"}},
+			err:   ErrScopeNotAllowed,
+			retry: []string{"read", "write"},
+		},
+		"scope_removed": {
+			req: owner,
+			change: func(srv *Service) {
+				client := srv.IAM[testClientID1]
+				client.Scopes = []string{"read"}
+				srv.IAM[testClientID1] = client
+			},
+			err:   ErrScopeNotAllowed,
+			retry: []string{"read"},
+		},
+		"reused": {
+			req:   owner,
+			reuse: true,
+			err:   ErrInvalidGrant,
+		},
+		"other_client": {
+			req: models.TokenRequest{GrantType: owner.GrantType, ClientID: testClientID2, ClientSecret: testClientSecret2},
+			err: ErrInvalidGrant,
+		},
+		"idle_expired": {
+			req:  owner,
+			idle: time.Nanosecond,
+			err:  ErrInvalidGrant,
+		},
+		"absolute_expired": {
+			req:      owner,
+			absolute: time.Nanosecond,
+			err:      ErrInvalidGrant,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestService()
+			for _, id := range []models.ClientID{testClientID1, testClientID2} {
+				client := srv.IAM[id]
+				client.GrantTypes = []string{models.GrantTypeClientCredentials, models.GrantTypeRefreshToken}
+				client.Scopes = []string{"read", "write", "admin"}
+				srv.IAM[id] = client
+			}
+			if tt.idle > 0 {
+				srv.refreshIdleExpiration = tt.idle
+			}
+			if tt.absolute > 0 {
+				srv.refreshExpiration = tt.absolute
+			}
+			issued, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, Scope: []string{"read", "write"}})
+			assert.NoError(t, err)
+			assert.NotEmpty(t, issued.RefreshToken)
+			time.Sleep(time.Millisecond)
+
+			if tt.change != nil {
+				tt.change(&srv)
+			}
+
+			req := tt.req
+			req.RefreshToken = issued.RefreshToken
+			if tt.reuse {
+				_, err = srv.GenerateToken(ctx, req)
+				assert.NoError(t, err)
+			}
+			refreshed, err := srv.GenerateToken(ctx, req)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				if tt.retry != nil {
+					refreshed, err = srv.GenerateToken(ctx, models.TokenRequest{GrantType: owner.GrantType, ClientID: owner.ClientID,
+						ClientSecret: owner.ClientSecret, Scope: tt.retry, RefreshToken: issued.RefreshToken})
+					assert.NoError(t, err)
+					assert.Equal(t, tt.retry, refreshed.Scope)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.scope, refreshed.Scope)
+			assert.NotEqual(t, issued.RefreshToken, refreshed.RefreshToken)
+			scope, err := srv.ParseToken(ctx, refreshed.AccessToken, models.TokenUseAccess, "", tt.scope...)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, scope)
+
+			// the rotated refresh token is used up
+			_, err = srv.GenerateToken(ctx, req)
+			assert.ErrorIs(t, err, ErrInvalidGrant)
+		})
+	}
+}
+
+func TestService_GenerateToken_RefreshReuse(t *testing.T) {
+	ctx := context.TODO()
+	srv := newTestService()
+	client := srv.IAM[testClientID1]
+	client.GrantTypes = []string{models.GrantTypeClientCredentials, models.GrantTypeRefreshToken}
+	srv.IAM[testClientID1] = client
+
+	first, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	assert.NoError(t, err)
+	req := models.TokenRequest{GrantType: models.GrantTypeRefreshToken, ClientID: testClientID1, ClientSecret: testClientSecret1, RefreshToken: first.RefreshToken}
+	second, err := srv.GenerateToken(ctx, req)
+	assert.NoError(t, err)
+
+	// presenting the first refresh token again revokes the family and the access tokens issued along
+	_, err = srv.GenerateToken(ctx, req)
+	assert.ErrorIs(t, err, ErrInvalidGrant)
+	for _, token := range []string{first.AccessToken, second.AccessToken} {
+		_, err = srv.ParseToken(ctx, token, models.TokenUseAccess, "")
+		assert.Error(t, err)
+	}
+	req.RefreshToken = second.RefreshToken
+	_, err = srv.GenerateToken(ctx, req)
+	assert.ErrorIs(t, err, ErrInvalidGrant)
+
+	// revoking a refresh token revokes its family too
+	third, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	assert.NoError(t, err)
+	assert.NoError(t, srv.RevokeToken(ctx, models.RevocationRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, Token: third.RefreshToken}))
+	_, err = srv.ParseToken(ctx, third.AccessToken, models.TokenUseAccess, "")
+	assert.Error(t, err)
+	req.RefreshToken = third.RefreshToken
+	_, err = srv.GenerateToken(ctx, req)
+	assert.ErrorIs(t, err, ErrInvalidGrant)
+}
+
+func TestService_GenerateToken_NoRefresh(t *testing.T) {
+	ctx := context.TODO()
+	srv := newTestService()
+
+	// clients not allowed the refresh_token grant receive no refresh token, nor may refresh
+	issued, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	assert.NoError(t, err)
+	assert.Empty(t, issued.RefreshToken)
+	_, err = srv.GenerateToken(ctx, models.TokenRequest{GrantType: models.GrantTypeRefreshToken, ClientID: testClientID1, ClientSecret: testClientSecret1, RefreshToken: "token"})
+	assert.ErrorIs(t, err, ErrGrantTypeNotAllowed)
+}
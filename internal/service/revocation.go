@@ -0,0 +1,69 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ingka-group/iam-proxy/internal/models"
+)
+
+// RevokeToken revokes the access, identity or refresh token for the authenticated client, see RFC 7009.
+// Clients revoke their own tokens, clients allowed the admin scope any token. Tokens that are not valid
+// already need no revocation and are ignored. Revoking a refresh token revokes its family along with the
+// access tokens issued with it.
+func (s *Service) RevokeToken(ctx context.Context, req models.RevocationRequest) error {
+	clientID, client, err := s.authenticate(ctx, req.ClientID, req.ClientSecret, req.ClientAssertion, req.ClientCertificate)
+	if err != nil {
+		return fmt.Errorf("user not authorized to revoke tokens: %w", err)
+	}
+	req.ClientID = clientID
+	// refresh tokens are opaque, not signed tokens of three parts
+	if strings.Count(req.Token, ".") != 2 {
+		return s.revokeRefreshToken(ctx, client, req)
+	}
+
+	claims, err := s.parseClaims(ctx, req.Token, models.TokenUseAccess, "")
+	if err != nil && !errors.Is(err, errRevocationUnknown) {
+		claims, err = s.parseClaims(ctx, req.Token, models.TokenUseIdentity, "")
+	}
+	if errors.Is(err, errRevocationUnknown) {
+		return err
+	}
+	if err != nil {
+		return nil
+	}
+	if claims.ClientID != req.ClientID && !slices.Contains(client.Scopes, models.ScopeAdmin) {
+		return fmt.Errorf("%s may not revoke the token: %w", req.ClientID, ErrTokenNotIssuedToClient)
+	}
+	if len(claims.ID) == 0 {
+		return errors.New("token has no id to revoke")
+	}
+
+	// kept as long as the token passes validation
+	var expiresAt time.Time
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Add(s.validation.leeway)
+	}
+	if err := s.revocations.Revoke(ctx, claims.ID, expiresAt); err != nil {
+		return fmt.Errorf("could not revoke token: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright © 2024 Ingka Holding B.V. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// You may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ingka-group/iam-proxy/internal/models"
+	"github.com/ingka-group/iam-proxy/internal/revocation"
+)
+
+func TestService_RevokeToken(t *testing.T) {
+	ctx := context.TODO()
+	owner := models.RevocationRequest{ClientID: testClientID1, ClientSecret: testClientSecret1}
+	other := models.RevocationRequest{ClientID: testClientID2, ClientSecret: testClientSecret2}
+
+	type test struct {
+		req models.RevocationRequest
+		// admin allows the revoking client the admin scope
+		admin    bool
+		identity bool
+		err      error
+		revoked  bool
+	}
+
+	tests := map[string]test{
+		"access_token": {
+			req:     owner,
+			revoked: true,
+		},
+		"identity_token": {
+			req:      owner,
+			identity: true,
+			revoked:  true,
+		},
+		"other_client": {
+			req: other,
+			err: ErrTokenNotIssuedToClient,
+		},
+		"admin": {
+			req:     other,
+			admin:   true,
+			revoked: true,
+		},
+		"invalid_client": {
+			req: models.RevocationRequest{ClientID: testClientID1, ClientSecret: testClientSecret2},
+			err: ErrInvalidCredentials,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestService()
+			if tt.admin {
+				client := srv.IAM[testClientID2]
+				client.Scopes = []string{models.ScopeAdmin}
+				srv.IAM[testClientID2] = client
+			}
+			issued, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+			assert.NoError(t, err)
+			token, use := issued.AccessToken, models.TokenUseAccess
+			if tt.identity {
+				token, use = issued.IdentityToken, models.TokenUseIdentity
+			}
+
+			req := tt.req
+			req.Token = token
+			err = srv.RevokeToken(ctx, req)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			_, err = srv.ParseToken(ctx, token, use, "")
+			assert.Equal(t, tt.revoked, err != nil)
+			// the other token of the response stays valid
+			if tt.revoked && !tt.identity {
+				_, err = srv.ParseToken(ctx, issued.IdentityToken, models.TokenUseIdentity, "")
+				assert.NoError(t, err)
+			}
+			if tt.revoked {
+				// revoking again is harmless
+				assert.NoError(t, srv.RevokeToken(ctx, req))
+			}
+		})
+	}
+
+	// invalid tokens need no revocation
+	srv := newTestService()
+	assert.NoError(t, srv.RevokeToken(ctx, models.RevocationRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, Token: "token"}))
+}
+
+func TestService_RevokeToken_StoreError(t *testing.T) {
+	ctx := context.TODO()
+	srv := newTestService()
+	issued, err := srv.GenerateToken(ctx, models.TokenRequest{ClientID: testClientID1, ClientSecret: testClientSecret1})
+	assert.NoError(t, err)
+
+	// tokens are rejected while the revocations cannot be checked, and not told revoked
+	srv.revocations = failingRevocations{}
+	_, err = srv.ParseToken(ctx, issued.AccessToken, models.TokenUseAccess, "")
+	assert.Error(t, err)
+	err = srv.RevokeToken(ctx, models.RevocationRequest{ClientID: testClientID1, ClientSecret: testClientSecret1, Token: issued.AccessToken})
+	assert.Error(t, err)
+	assert.Error(t, srv.Ready(ctx))
+
+	// the lookup is bound to the context of the request
+	srv.revocations = contextRevocations{revocation.NewMemory()}
+	_, err = srv.ParseToken(ctx, issued.AccessToken, models.TokenUseAccess, "")
+	assert.NoError(t, err)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = srv.ParseToken(cancelled, issued.AccessToken, models.TokenUseAccess, "")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// contextRevocations is a RevocationStore whose lookups fail once the context is done.
+type contextRevocations struct {
+	*revocation.Memory
+}
+
+func (r contextRevocations) Revoked(ctx context.Context, jti string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return r.Memory.Revoked(ctx, jti)
+}
+
+// failingRevocations is a RevocationStore that cannot be reached.
+type failingRevocations struct{}
+
+func (failingRevocations) Revoke(context.Context, string, time.Time) error {
+	return errors.New("unreachable")
+}
+
+func (failingRevocations) Revoked(context.Context, string) (bool, error) {
+	return false, errors.New("unreachable")
+}
+
+func (failingRevocations) Health(context.Context) error {
+	return errors.New("unreachable")
+}
@@ -20,8 +20,14 @@
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/ingka-group/iam-proxy/client/health"
+	"github.com/ingka-group/iam-proxy/client/jwk"
+	"github.com/ingka-group/iam-proxy/internal/credentials"
+	"github.com/ingka-group/iam-proxy/internal/keys"
 	"github.com/ingka-group/iam-proxy/internal/models"
 )
 
@@ -29,26 +35,177 @@
 type Servicer interface {
 	Health(ctx context.Context) (health.Health, error)
 	Ready(ctx context.Context) error
-	GenerateToken(ctx context.Context, key, secret string) (string, string, int64, error)
-	ParseToken(tokenString string) (string, error)
+	GenerateToken(ctx context.Context, req models.TokenRequest) (models.Token, error)
+	ParseToken(ctx context.Context, tokenString string, use models.TokenUse, audience string, scopes ...string) (string, error)
+	ValidateToken(ctx context.Context, req models.ValidationRequest) error
+	IntrospectToken(ctx context.Context, req models.IntrospectionRequest) (models.Introspection, error)
+	RevokeToken(ctx context.Context, req models.RevocationRequest) error
+	JWKS(ctx context.Context) (jwk.Set, error)
+	Metadata(ctx context.Context) (models.Metadata, error)
+	DPoPNonce(ctx context.Context) (string, error)
+	AuthorizeAdmin(ctx context.Context, req models.ValidationRequest) error
+	Clients(ctx context.Context) (models.IAM, error)
+	Client(ctx context.Context, id models.ClientID) (models.Secret, error)
+	CreateClient(ctx context.Context, id models.ClientID, client models.Secret) (models.ClientID, string, error)
+	UpdateClient(ctx context.Context, id models.ClientID, client models.Secret) (models.Secret, error)
+	DisableClient(ctx context.Context, id models.ClientID) error
+	DeleteClient(ctx context.Context, id models.ClientID) error
+	RotateClientSecret(ctx context.Context, id models.ClientID, overlap time.Duration) (string, error)
+}
+
+// CredentialStore provides the client credentials.
+type CredentialStore interface {
+	// Client returns the credentials of the client, credentials.ErrNotFound when it does not exist.
+	Client(ctx context.Context, id models.ClientID) (models.Secret, error)
+	// Clients returns all client credentials.
+	Clients(ctx context.Context) (models.IAM, error)
+	// Health returns an error when the store cannot be reached, wrapping credentials.ErrStale when it
+	// serves outdated credentials.
+	Health(ctx context.Context) error
+}
+
+// WritableCredentialStore is a CredentialStore whose clients can be changed.
+type WritableCredentialStore interface {
+	CredentialStore
+	// CreateClient adds the client, credentials.ErrExists when it exists already.
+	CreateClient(ctx context.Context, id models.ClientID, client models.Secret) error
+	// UpdateClient replaces the client, credentials.ErrNotFound when it does not exist.
+	UpdateClient(ctx context.Context, id models.ClientID, client models.Secret) error
+	// DeleteClient removes the client, credentials.ErrNotFound when it does not exist.
+	DeleteClient(ctx context.Context, id models.ClientID) error
+}
+
+// RevocationStore keeps the ids of revoked tokens until the tokens expire.
+type RevocationStore interface {
+	// Revoke denies the token id until expiresAt, forever for the zero time.
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	// Revoked tells whether the token id is denied.
+	Revoked(ctx context.Context, jti string) (bool, error)
+	// Health returns an error when the store cannot be reached.
+	Health(ctx context.Context) error
+}
+
+// RefreshTokenStore keeps the refresh tokens.
+type RefreshTokenStore interface {
+	// Create adds the refresh token.
+	Create(ctx context.Context, token models.RefreshToken) error
+	// Get returns the refresh token, refresh.ErrNotFound when it does not exist.
+	Get(ctx context.Context, id string) (models.RefreshToken, error)
+	// Rotate marks the refresh token used and adds the next one at once, refresh.ErrReused when it was used
+	// already and refresh.ErrNotFound when it does not exist.
+	Rotate(ctx context.Context, id string, next models.RefreshToken) error
+	// RevokeFamily deletes the refresh tokens of the family and returns them.
+	RevokeFamily(ctx context.Context, family string) ([]models.RefreshToken, error)
+	// Health returns an error when the store cannot be reached.
+	Health(ctx context.Context) error
+}
+
+// ReplayStore keeps the ids of one-time tokens, e.g. client assertions.
+type ReplayStore interface {
+	// Use records the id until expiresAt, returning replay.ErrReplayed when it was used already.
+	Use(ctx context.Context, id string, expiresAt time.Time) error
+	// Health returns an error when the store cannot be reached.
+	Health(ctx context.Context) error
 }
 
 // Service implements business logic of iam-proxy-v1 Service
 type Service struct {
 	Config
-	IAM    models.IAM
-	secret []byte
+	IAM models.IAM
+	// store optionally provides the client credentials, replacing IAM.
+	store   CredentialStore
+	ring    *keys.Ring
+	rotator *keys.Rotator
+	// keyRetention is how long the rotator keeps replaced keys, which caps the lifetime of the tokens they
+	// sign. It is zero without rotation.
+	keyRetention time.Duration
+	// revocations holds the ids of revoked tokens.
+	revocations RevocationStore
+	// refreshTokens holds the issued refresh tokens.
+	refreshTokens RefreshTokenStore
+	// refreshExpiration is the absolute lifetime of a refresh token family.
+	refreshExpiration time.Duration
+	// refreshIdleExpiration is the lifetime of an unused refresh token.
+	refreshIdleExpiration time.Duration
+	// replays holds the ids of used client assertions.
+	replays ReplayStore
+	// issuer is the iss claim of the tokens, published as the issuer of the server metadata.
+	issuer string
+	// assertionAudiences are the accepted audiences of client assertions besides the issuer.
+	assertionAudiences []string
+	// secretVerifications bounds the client secrets verified at once.
+	secretVerifications limiter
+	// tlsClientAuth tells whether clients may present TLS client certificates.
+	tlsClientAuth bool
+	// dpopNonces issues and checks the nonces of DPoP proofs.
+	dpopNonces nonceSource
+	// clientKeys caches the key sets of clients authenticating with client assertions.
+	clientKeys *keySetCache
+	// identityKey optionally signs identity tokens apart from access tokens.
+	identityKey *keys.Key
+	// expiration is the default lifetime of access tokens.
+	expiration time.Duration
+	// identityExpiration is the lifetime of identity tokens, the access token lifetime when unset.
+	identityExpiration time.Duration
+	// nonExpiringIdentity accepts identity tokens issued without an expiry.
+	nonExpiringIdentity bool
+	// validation tunes the validation of the token time claims.
+	validation timeValidation
+}
+
+// timeValidation holds the options validating the time claims of tokens.
+type timeValidation struct {
+	leeway            time.Duration
+	requireExpiration bool
+	requireIssuedAt   bool
+	futureIssuedAt    bool
 }
 
 // Health performs health checks and returns the health of the service
-func (s *Service) Health(_ context.Context) (health.Health, error) {
-	if len(s.IAM) == 0 {
+func (s *Service) Health(ctx context.Context) (health.Health, error) {
+	store := s.credentialStore()
+	storeErr := store.Health(ctx)
+	if storeErr != nil && !errors.Is(storeErr, credentials.ErrStale) {
+		return health.Health{
+			Status: health.StatusUnavailable,
+			IAM:    "client credentials cannot be reached",
+		}, nil
+	}
+	// clients held in memory are counted, a database is only pinged as clients are looked up on demand
+	if _, database := store.(*credentials.SQL); !database {
+		clients, err := store.Clients(ctx)
+		if err != nil || len(clients) == 0 {
+			return health.Health{
+				Status: health.StatusUnavailable,
+				IAM:    "No client credentials available",
+			}, nil
+		}
+	}
+	if storeErr != nil {
+		return health.Health{
+			Status: health.StatusDegraded,
+			IAM:    "client credentials could not be reloaded",
+		}, nil
+	}
+	if err := s.revocations.Health(ctx); err != nil {
+		return health.Health{
+			Status: health.StatusUnavailable,
+			IAM:    "revoked tokens cannot be reached",
+		}, nil
+	}
+	if err := s.refreshTokens.Health(ctx); err != nil {
+		return health.Health{
+			Status: health.StatusUnavailable,
+			IAM:    "refresh tokens cannot be reached",
+		}, nil
+	}
+	if err := s.replays.Health(ctx); err != nil {
 		return health.Health{
 			Status: health.StatusUnavailable,
-			IAM:    "No client credentials available",
+			IAM:    "used client assertions cannot be reached",
 		}, nil
 	}
-	if len(s.secret) == 0 {
+	if s.keyRing().Active().Empty() {
 		return health.Health{
 			Status: health.StatusDegraded,
 			IAM:    "insecure secret",
@@ -59,7 +216,28 @@ func (s *Service) Health(_ context.Context) (health.Health, error) {
 	}, nil
 }
 
+// credentialStore returns the store of the client credentials, IAM when none is set.
+func (s *Service) credentialStore() CredentialStore {
+	if s.store != nil {
+		return s.store
+	}
+	return credentials.Static(s.IAM)
+}
+
 // Ready returns non-nil response if service is ready to receive requests
-func (s *Service) Ready(_ context.Context) error {
+func (s *Service) Ready(ctx context.Context) error {
+	// stale credentials are still served
+	if err := s.credentialStore().Health(ctx); err != nil && !errors.Is(err, credentials.ErrStale) {
+		return fmt.Errorf("client credentials cannot be reached: %w", err)
+	}
+	if err := s.revocations.Health(ctx); err != nil {
+		return fmt.Errorf("revoked tokens cannot be reached: %w", err)
+	}
+	if err := s.refreshTokens.Health(ctx); err != nil {
+		return fmt.Errorf("refresh tokens cannot be reached: %w", err)
+	}
+	if err := s.replays.Health(ctx); err != nil {
+		return fmt.Errorf("used client assertions cannot be reached: %w", err)
+	}
 	return nil
 }
@@ -24,6 +24,8 @@
 	"time"
 
 	"github.com/ingka-group/iam-proxy/client/health"
+	"github.com/ingka-group/iam-proxy/client/jwk"
+	"github.com/ingka-group/iam-proxy/internal/models"
 	"go.opencensus.io/plugin/ochttp"
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
@@ -69,8 +71,225 @@ func NewWithMetrics(base Servicer, instanceName string) Servicer {
 	}
 }
 
+// AuthorizeAdmin implements Servicer
+func (_d ServicerWithMetrics) AuthorizeAdmin(ctx context.Context, req models.ValidationRequest) (err error) {
+	_since := time.Now()
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+
+		_ctx, err := tag.New(context.Background(),
+			tag.Insert(servicerHistogramInstanceNameTag, _d.instanceName),
+			tag.Insert(servicerHistogramMethodNameTag, "AuthorizeAdmin"),
+			tag.Insert(servicerHistogramResultTag, result),
+		)
+		if err != nil {
+			log.Printf("could not create tag with context for instance (%v) method (%v): %v",
+				_d.instanceName,
+				"AuthorizeAdmin",
+				err,
+			)
+			return
+		}
+		stats.Record(
+			_ctx,
+			servicerHistogram.M(float64(time.Since(_since)/time.Millisecond)),
+		)
+	}()
+
+	return _d.base.AuthorizeAdmin(ctx, req)
+}
+
+// Client implements Servicer
+func (_d ServicerWithMetrics) Client(ctx context.Context, id models.ClientID) (s1 models.Secret, err error) {
+	_since := time.Now()
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+
+		_ctx, err := tag.New(context.Background(),
+			tag.Insert(servicerHistogramInstanceNameTag, _d.instanceName),
+			tag.Insert(servicerHistogramMethodNameTag, "Client"),
+			tag.Insert(servicerHistogramResultTag, result),
+		)
+		if err != nil {
+			log.Printf("could not create tag with context for instance (%v) method (%v): %v",
+				_d.instanceName,
+				"Client",
+				err,
+			)
+			return
+		}
+		stats.Record(
+			_ctx,
+			servicerHistogram.M(float64(time.Since(_since)/time.Millisecond)),
+		)
+	}()
+
+	return _d.base.Client(ctx, id)
+}
+
+// Clients implements Servicer
+func (_d ServicerWithMetrics) Clients(ctx context.Context) (i1 models.IAM, err error) {
+	_since := time.Now()
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+
+		_ctx, err := tag.New(context.Background(),
+			tag.Insert(servicerHistogramInstanceNameTag, _d.instanceName),
+			tag.Insert(servicerHistogramMethodNameTag, "Clients"),
+			tag.Insert(servicerHistogramResultTag, result),
+		)
+		if err != nil {
+			log.Printf("could not create tag with context for instance (%v) method (%v): %v",
+				_d.instanceName,
+				"Clients",
+				err,
+			)
+			return
+		}
+		stats.Record(
+			_ctx,
+			servicerHistogram.M(float64(time.Since(_since)/time.Millisecond)),
+		)
+	}()
+
+	return _d.base.Clients(ctx)
+}
+
+// CreateClient implements Servicer
+func (_d ServicerWithMetrics) CreateClient(ctx context.Context, id models.ClientID, client models.Secret) (c1 models.ClientID, s1 string, err error) {
+	_since := time.Now()
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+
+		_ctx, err := tag.New(context.Background(),
+			tag.Insert(servicerHistogramInstanceNameTag, _d.instanceName),
+			tag.Insert(servicerHistogramMethodNameTag, "CreateClient"),
+			tag.Insert(servicerHistogramResultTag, result),
+		)
+		if err != nil {
+			log.Printf("could not create tag with context for instance (%v) method (%v): %v",
+				_d.instanceName,
+				"CreateClient",
+				err,
+			)
+			return
+		}
+		stats.Record(
+			_ctx,
+			servicerHistogram.M(float64(time.Since(_since)/time.Millisecond)),
+		)
+	}()
+
+	return _d.base.CreateClient(ctx, id, client)
+}
+
+// DPoPNonce implements Servicer
+func (_d ServicerWithMetrics) DPoPNonce(ctx context.Context) (s1 string, err error) {
+	_since := time.Now()
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+
+		_ctx, err := tag.New(context.Background(),
+			tag.Insert(servicerHistogramInstanceNameTag, _d.instanceName),
+			tag.Insert(servicerHistogramMethodNameTag, "DPoPNonce"),
+			tag.Insert(servicerHistogramResultTag, result),
+		)
+		if err != nil {
+			log.Printf("could not create tag with context for instance (%v) method (%v): %v",
+				_d.instanceName,
+				"DPoPNonce",
+				err,
+			)
+			return
+		}
+		stats.Record(
+			_ctx,
+			servicerHistogram.M(float64(time.Since(_since)/time.Millisecond)),
+		)
+	}()
+
+	return _d.base.DPoPNonce(ctx)
+}
+
+// DeleteClient implements Servicer
+func (_d ServicerWithMetrics) DeleteClient(ctx context.Context, id models.ClientID) (err error) {
+	_since := time.Now()
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+
+		_ctx, err := tag.New(context.Background(),
+			tag.Insert(servicerHistogramInstanceNameTag, _d.instanceName),
+			tag.Insert(servicerHistogramMethodNameTag, "DeleteClient"),
+			tag.Insert(servicerHistogramResultTag, result),
+		)
+		if err != nil {
+			log.Printf("could not create tag with context for instance (%v) method (%v): %v",
+				_d.instanceName,
+				"DeleteClient",
+				err,
+			)
+			return
+		}
+		stats.Record(
+			_ctx,
+			servicerHistogram.M(float64(time.Since(_since)/time.Millisecond)),
+		)
+	}()
+
+	return _d.base.DeleteClient(ctx, id)
+}
+
+// DisableClient implements Servicer
+func (_d ServicerWithMetrics) DisableClient(ctx context.Context, id models.ClientID) (err error) {
+	_since := time.Now()
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+
+		_ctx, err := tag.New(context.Background(),
+			tag.Insert(servicerHistogramInstanceNameTag, _d.instanceName),
+			tag.Insert(servicerHistogramMethodNameTag, "DisableClient"),
+			tag.Insert(servicerHistogramResultTag, result),
+		)
+		if err != nil {
+			log.Printf("could not create tag with context for instance (%v) method (%v): %v",
+				_d.instanceName,
+				"DisableClient",
+				err,
+			)
+			return
+		}
+		stats.Record(
+			_ctx,
+			servicerHistogram.M(float64(time.Since(_since)/time.Millisecond)),
+		)
+	}()
+
+	return _d.base.DisableClient(ctx, id)
+}
+
 // GenerateToken implements Servicer
-func (_d ServicerWithMetrics) GenerateToken(ctx context.Context, key string, secret string) (s1 string, s2 string, i1 int64, err error) {
+func (_d ServicerWithMetrics) GenerateToken(ctx context.Context, req models.TokenRequest) (t1 models.Token, err error) {
 	_since := time.Now()
 	defer func() {
 		result := "ok"
@@ -97,7 +316,7 @@ func (_d ServicerWithMetrics) GenerateToken(ctx context.Context, key string, sec
 		)
 	}()
 
-	return _d.base.GenerateToken(ctx, key, secret)
+	return _d.base.GenerateToken(ctx, req)
 }
 
 // Health implements Servicer
@@ -131,8 +350,101 @@ func (_d ServicerWithMetrics) Health(ctx context.Context) (h1 health.Health, err
 	return _d.base.Health(ctx)
 }
 
+// IntrospectToken implements Servicer
+func (_d ServicerWithMetrics) IntrospectToken(ctx context.Context, req models.IntrospectionRequest) (i1 models.Introspection, err error) {
+	_since := time.Now()
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+
+		_ctx, err := tag.New(context.Background(),
+			tag.Insert(servicerHistogramInstanceNameTag, _d.instanceName),
+			tag.Insert(servicerHistogramMethodNameTag, "IntrospectToken"),
+			tag.Insert(servicerHistogramResultTag, result),
+		)
+		if err != nil {
+			log.Printf("could not create tag with context for instance (%v) method (%v): %v",
+				_d.instanceName,
+				"IntrospectToken",
+				err,
+			)
+			return
+		}
+		stats.Record(
+			_ctx,
+			servicerHistogram.M(float64(time.Since(_since)/time.Millisecond)),
+		)
+	}()
+
+	return _d.base.IntrospectToken(ctx, req)
+}
+
+// JWKS implements Servicer
+func (_d ServicerWithMetrics) JWKS(ctx context.Context) (s1 jwk.Set, err error) {
+	_since := time.Now()
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+
+		_ctx, err := tag.New(context.Background(),
+			tag.Insert(servicerHistogramInstanceNameTag, _d.instanceName),
+			tag.Insert(servicerHistogramMethodNameTag, "JWKS"),
+			tag.Insert(servicerHistogramResultTag, result),
+		)
+		if err != nil {
+			log.Printf("could not create tag with context for instance (%v) method (%v): %v",
+				_d.instanceName,
+				"JWKS",
+				err,
+			)
+			return
+		}
+		stats.Record(
+			_ctx,
+			servicerHistogram.M(float64(time.Since(_since)/time.Millisecond)),
+		)
+	}()
+
+	return _d.base.JWKS(ctx)
+}
+
+// Metadata implements Servicer
+func (_d ServicerWithMetrics) Metadata(ctx context.Context) (m1 models.Metadata, err error) {
+	_since := time.Now()
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+
+		_ctx, err := tag.New(context.Background(),
+			tag.Insert(servicerHistogramInstanceNameTag, _d.instanceName),
+			tag.Insert(servicerHistogramMethodNameTag, "Metadata"),
+			tag.Insert(servicerHistogramResultTag, result),
+		)
+		if err != nil {
+			log.Printf("could not create tag with context for instance (%v) method (%v): %v",
+				_d.instanceName,
+				"Metadata",
+				err,
+			)
+			return
+		}
+		stats.Record(
+			_ctx,
+			servicerHistogram.M(float64(time.Since(_since)/time.Millisecond)),
+		)
+	}()
+
+	return _d.base.Metadata(ctx)
+}
+
 // ParseToken implements Servicer
-func (_d ServicerWithMetrics) ParseToken(tokenString string) (s1 string, err error) {
+func (_d ServicerWithMetrics) ParseToken(ctx context.Context, tokenString string, use models.TokenUse, audience string, scopes ...string) (s1 string, err error) {
 	_since := time.Now()
 	defer func() {
 		result := "ok"
@@ -159,7 +471,7 @@ func (_d ServicerWithMetrics) ParseToken(tokenString string) (s1 string, err err
 		)
 	}()
 
-	return _d.base.ParseToken(tokenString)
+	return _d.base.ParseToken(ctx, tokenString, use, audience, scopes...)
 }
 
 // Ready implements Servicer
@@ -192,3 +504,127 @@ func (_d ServicerWithMetrics) Ready(ctx context.Context) (err error) {
 
 	return _d.base.Ready(ctx)
 }
+
+// RevokeToken implements Servicer
+func (_d ServicerWithMetrics) RevokeToken(ctx context.Context, req models.RevocationRequest) (err error) {
+	_since := time.Now()
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+
+		_ctx, err := tag.New(context.Background(),
+			tag.Insert(servicerHistogramInstanceNameTag, _d.instanceName),
+			tag.Insert(servicerHistogramMethodNameTag, "RevokeToken"),
+			tag.Insert(servicerHistogramResultTag, result),
+		)
+		if err != nil {
+			log.Printf("could not create tag with context for instance (%v) method (%v): %v",
+				_d.instanceName,
+				"RevokeToken",
+				err,
+			)
+			return
+		}
+		stats.Record(
+			_ctx,
+			servicerHistogram.M(float64(time.Since(_since)/time.Millisecond)),
+		)
+	}()
+
+	return _d.base.RevokeToken(ctx, req)
+}
+
+// RotateClientSecret implements Servicer
+func (_d ServicerWithMetrics) RotateClientSecret(ctx context.Context, id models.ClientID, overlap time.Duration) (s1 string, err error) {
+	_since := time.Now()
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+
+		_ctx, err := tag.New(context.Background(),
+			tag.Insert(servicerHistogramInstanceNameTag, _d.instanceName),
+			tag.Insert(servicerHistogramMethodNameTag, "RotateClientSecret"),
+			tag.Insert(servicerHistogramResultTag, result),
+		)
+		if err != nil {
+			log.Printf("could not create tag with context for instance (%v) method (%v): %v",
+				_d.instanceName,
+				"RotateClientSecret",
+				err,
+			)
+			return
+		}
+		stats.Record(
+			_ctx,
+			servicerHistogram.M(float64(time.Since(_since)/time.Millisecond)),
+		)
+	}()
+
+	return _d.base.RotateClientSecret(ctx, id, overlap)
+}
+
+// UpdateClient implements Servicer
+func (_d ServicerWithMetrics) UpdateClient(ctx context.Context, id models.ClientID, client models.Secret) (s1 models.Secret, err error) {
+	_since := time.Now()
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+
+		_ctx, err := tag.New(context.Background(),
+			tag.Insert(servicerHistogramInstanceNameTag, _d.instanceName),
+			tag.Insert(servicerHistogramMethodNameTag, "UpdateClient"),
+			tag.Insert(servicerHistogramResultTag, result),
+		)
+		if err != nil {
+			log.Printf("could not create tag with context for instance (%v) method (%v): %v",
+				_d.instanceName,
+				"UpdateClient",
+				err,
+			)
+			return
+		}
+		stats.Record(
+			_ctx,
+			servicerHistogram.M(float64(time.Since(_since)/time.Millisecond)),
+		)
+	}()
+
+	return _d.base.UpdateClient(ctx, id, client)
+}
+
+// ValidateToken implements Servicer
+func (_d ServicerWithMetrics) ValidateToken(ctx context.Context, req models.ValidationRequest) (err error) {
+	_since := time.Now()
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+
+		_ctx, err := tag.New(context.Background(),
+			tag.Insert(servicerHistogramInstanceNameTag, _d.instanceName),
+			tag.Insert(servicerHistogramMethodNameTag, "ValidateToken"),
+			tag.Insert(servicerHistogramResultTag, result),
+		)
+		if err != nil {
+			log.Printf("could not create tag with context for instance (%v) method (%v): %v",
+				_d.instanceName,
+				"ValidateToken",
+				err,
+			)
+			return
+		}
+		stats.Record(
+			_ctx,
+			servicerHistogram.M(float64(time.Since(_since)/time.Millisecond)),
+		)
+	}()
+
+	return _d.base.ValidateToken(ctx, req)
+}
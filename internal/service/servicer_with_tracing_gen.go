@@ -20,8 +20,11 @@
 
 import (
 	"context"
+	"time"
 
 	"github.com/ingka-group/iam-proxy/client/health"
+	"github.com/ingka-group/iam-proxy/client/jwk"
+	"github.com/ingka-group/iam-proxy/internal/models"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/codes"
 )
@@ -41,8 +44,113 @@ func NewWithTracing(base Servicer, instanceName string) Servicer {
 	}
 }
 
+// AuthorizeAdmin implements Servicer
+func (_d ServicerWithTracing) AuthorizeAdmin(ctx context.Context, req models.ValidationRequest) (err error) {
+	ctx, span := otel.Tracer(_d.instanceName).Start(ctx, "AuthorizeAdmin")
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	return _d.base.AuthorizeAdmin(ctx, req)
+}
+
+// Client implements Servicer
+func (_d ServicerWithTracing) Client(ctx context.Context, id models.ClientID) (s1 models.Secret, err error) {
+	ctx, span := otel.Tracer(_d.instanceName).Start(ctx, "Client")
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	return _d.base.Client(ctx, id)
+}
+
+// Clients implements Servicer
+func (_d ServicerWithTracing) Clients(ctx context.Context) (i1 models.IAM, err error) {
+	ctx, span := otel.Tracer(_d.instanceName).Start(ctx, "Clients")
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	return _d.base.Clients(ctx)
+}
+
+// CreateClient implements Servicer
+func (_d ServicerWithTracing) CreateClient(ctx context.Context, id models.ClientID, client models.Secret) (c1 models.ClientID, s1 string, err error) {
+	ctx, span := otel.Tracer(_d.instanceName).Start(ctx, "CreateClient")
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	return _d.base.CreateClient(ctx, id, client)
+}
+
+// DPoPNonce implements Servicer
+func (_d ServicerWithTracing) DPoPNonce(ctx context.Context) (s1 string, err error) {
+	ctx, span := otel.Tracer(_d.instanceName).Start(ctx, "DPoPNonce")
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	return _d.base.DPoPNonce(ctx)
+}
+
+// DeleteClient implements Servicer
+func (_d ServicerWithTracing) DeleteClient(ctx context.Context, id models.ClientID) (err error) {
+	ctx, span := otel.Tracer(_d.instanceName).Start(ctx, "DeleteClient")
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	return _d.base.DeleteClient(ctx, id)
+}
+
+// DisableClient implements Servicer
+func (_d ServicerWithTracing) DisableClient(ctx context.Context, id models.ClientID) (err error) {
+	ctx, span := otel.Tracer(_d.instanceName).Start(ctx, "DisableClient")
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	return _d.base.DisableClient(ctx, id)
+}
+
 // GenerateToken implements Servicer
-func (_d ServicerWithTracing) GenerateToken(ctx context.Context, key string, secret string) (s1 string, s2 string, i1 int64, err error) {
+func (_d ServicerWithTracing) GenerateToken(ctx context.Context, req models.TokenRequest) (t1 models.Token, err error) {
 	ctx, span := otel.Tracer(_d.instanceName).Start(ctx, "GenerateToken")
 
 	defer func() {
@@ -53,7 +161,7 @@ func (_d ServicerWithTracing) GenerateToken(ctx context.Context, key string, sec
 		span.End()
 	}()
 
-	return _d.base.GenerateToken(ctx, key, secret)
+	return _d.base.GenerateToken(ctx, req)
 }
 
 // Health implements Servicer
@@ -62,9 +170,54 @@ func (_d ServicerWithTracing) Health(ctx context.Context) (h1 health.Health, err
 	return _d.base.Health(ctx)
 }
 
+// IntrospectToken implements Servicer
+func (_d ServicerWithTracing) IntrospectToken(ctx context.Context, req models.IntrospectionRequest) (i1 models.Introspection, err error) {
+	ctx, span := otel.Tracer(_d.instanceName).Start(ctx, "IntrospectToken")
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	return _d.base.IntrospectToken(ctx, req)
+}
+
+// JWKS implements Servicer
+func (_d ServicerWithTracing) JWKS(ctx context.Context) (s1 jwk.Set, err error) {
+	ctx, span := otel.Tracer(_d.instanceName).Start(ctx, "JWKS")
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	return _d.base.JWKS(ctx)
+}
+
+// Metadata implements Servicer
+func (_d ServicerWithTracing) Metadata(ctx context.Context) (m1 models.Metadata, err error) {
+	ctx, span := otel.Tracer(_d.instanceName).Start(ctx, "Metadata")
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	return _d.base.Metadata(ctx)
+}
+
 // ParseToken implements Servicer
-func (_d ServicerWithTracing) ParseToken(tokenString string) (s1 string, err error) {
-	_, span := otel.Tracer(_d.instanceName).Start(context.Background(), "ParseToken")
+func (_d ServicerWithTracing) ParseToken(ctx context.Context, tokenString string, use models.TokenUse, audience string, scopes ...string) (s1 string, err error) {
+	ctx, span := otel.Tracer(_d.instanceName).Start(ctx, "ParseToken")
 
 	defer func() {
 		if err != nil {
@@ -74,7 +227,7 @@ func (_d ServicerWithTracing) ParseToken(tokenString string) (s1 string, err err
 		span.End()
 	}()
 
-	return _d.base.ParseToken(tokenString)
+	return _d.base.ParseToken(ctx, tokenString, use, audience, scopes...)
 }
 
 // Ready implements Servicer
@@ -82,3 +235,63 @@ func (_d ServicerWithTracing) Ready(ctx context.Context) (err error) {
 
 	return _d.base.Ready(ctx)
 }
+
+// RevokeToken implements Servicer
+func (_d ServicerWithTracing) RevokeToken(ctx context.Context, req models.RevocationRequest) (err error) {
+	ctx, span := otel.Tracer(_d.instanceName).Start(ctx, "RevokeToken")
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	return _d.base.RevokeToken(ctx, req)
+}
+
+// RotateClientSecret implements Servicer
+func (_d ServicerWithTracing) RotateClientSecret(ctx context.Context, id models.ClientID, overlap time.Duration) (s1 string, err error) {
+	ctx, span := otel.Tracer(_d.instanceName).Start(ctx, "RotateClientSecret")
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	return _d.base.RotateClientSecret(ctx, id, overlap)
+}
+
+// UpdateClient implements Servicer
+func (_d ServicerWithTracing) UpdateClient(ctx context.Context, id models.ClientID, client models.Secret) (s1 models.Secret, err error) {
+	ctx, span := otel.Tracer(_d.instanceName).Start(ctx, "UpdateClient")
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	return _d.base.UpdateClient(ctx, id, client)
+}
+
+// ValidateToken implements Servicer
+func (_d ServicerWithTracing) ValidateToken(ctx context.Context, req models.ValidationRequest) (err error) {
+	ctx, span := otel.Tracer(_d.instanceName).Start(ctx, "ValidateToken")
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	return _d.base.ValidateToken(ctx, req)
+}